@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/caddyserver/buildworker"
+	"github.com/caddyserver/releaser/internal/releaser"
+)
+
+// defaultBuildSeconds is how long a platform is expected to
+// take to build if it has never been timed on this machine
+// and average_build_seconds is not configured.
+const defaultBuildSeconds = 60
+
+// confirmPlatforms lists the platforms that will be built
+// and about how long building them all will take, and asks
+// the operator whether to go ahead now.
+func confirmPlatforms(platforms []buildworker.Platform) error {
+	printPlatforms(platforms)
+	estimate, timed := estimateBuildTime(platforms, loadBuildTimes(), cfg.BuildConcurrency)
+	logger.Printf("This will build %d platforms, %d at a time: ~%s", len(platforms), cfg.BuildConcurrency, formatEstimate(estimate))
+	if timed < len(platforms) {
+		logger.Printf(" (%d of them not timed before)", len(platforms)-timed)
+	}
+	logger.Printf("\n\n")
+
+	confirmed, err := askYesNo("Build them now?")
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return fmt.Errorf("deploy cancelled by user")
+	}
+	return nil
+}
+
+// estimateBuildTime returns about how long building platforms
+// with the given concurrency will take, if each takes as long
+// as it did last time according to times, in seconds keyed
+// by platform, and the number of platforms that were timed.
+// Builds are started in order as others finish, as Deploy
+// does. Uploads, which happen alongside, are not counted.
+func estimateBuildTime(platforms []buildworker.Platform, times map[string]float64, concurrency int) (time.Duration, int) {
+	fallback := float64(defaultBuildSeconds)
+	if cfg.AverageBuildSeconds > 0 {
+		fallback = cfg.AverageBuildSeconds
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// each slot is when its build will finish
+	slots := make([]float64, concurrency)
+	var timed int
+	for _, plat := range platforms {
+		secs, ok := times[plat.String()]
+		if ok {
+			timed++
+		} else {
+			secs = fallback
+		}
+		next := 0
+		for i := range slots {
+			if slots[i] < slots[next] {
+				next = i
+			}
+		}
+		slots[next] += secs
+	}
+
+	var total float64
+	for _, end := range slots {
+		if end > total {
+			total = end
+		}
+	}
+	return time.Duration(total * float64(time.Second)), timed
+}
+
+// formatEstimate formats d roughly, such as "12 minutes".
+func formatEstimate(d time.Duration) string {
+	if d < time.Minute {
+		return "1 minute"
+	}
+	if d < 2*time.Hour {
+		return fmt.Sprintf("%d minutes", int(d.Round(time.Minute)/time.Minute))
+	}
+	return d.Round(time.Minute).String()
+}
+
+// buildTimesPath returns the path of the file that records
+// how long each platform took to build the last time it was
+// built, or "" if there is nowhere to put it.
+func buildTimesPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "release-caddy", "build-times.json")
+}
+
+// loadBuildTimes returns the build times recorded by
+// recordBuildTimes, or nil if there are none.
+func loadBuildTimes() map[string]float64 {
+	path := buildTimesPath()
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var times map[string]float64
+	if err := json.Unmarshal(data, &times); err != nil {
+		logger.Warnf("Reading build times %s: %v", path, err)
+		return nil
+	}
+	return times
+}
+
+// recordBuildTimes records how long each platform that was
+// built successfully in result took, for estimating the
+// next build. Failing to do so only makes estimates worse.
+func recordBuildTimes(result *releaser.Result) {
+	path := buildTimesPath()
+	if path == "" {
+		return
+	}
+	failed := make(map[string]bool)
+	for _, plat := range result.FailedPlatforms {
+		failed[plat] = true
+	}
+	times := loadBuildTimes()
+	if times == nil {
+		times = make(map[string]float64)
+	}
+	for plat, secs := range result.BuildDurations {
+		if !failed[plat] {
+			times[plat] = secs
+		}
+	}
+
+	data, err := json.MarshalIndent(times, "", "\t")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(path, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		logger.Warnf("Recording build times: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/caddyserver/releaser/internal/releaser"
+)
+
+// Exit statuses of the program, besides 0 for success,
+// so scripts can tell how a deploy failed.
+const (
+	// exitFailure is the exit status when the deploy
+	// fails in a way that has no status of its own.
+	exitFailure = 1
+
+	// exitPreflight is the exit status when the deploy
+	// can't be started: bad flags or configuration, missing
+	// credentials or tools, or a failed preflight check.
+	exitPreflight = 2
+
+	// exitChecksFailed is the exit status when the tests
+	// or build checks failed, so nothing was tagged.
+	exitChecksFailed = 3
+
+	// exitTagPush is the exit status when the tag could
+	// not be made or pushed, or already exists.
+	exitTagPush = 4
+
+	// exitRelease is the exit status when the release
+	// could not be created or published.
+	exitRelease = 5
+
+	// exitUploadPartial is the exit status when some
+	// platforms could not be built or uploaded, or some
+	// assets can't be downloaded.
+	exitUploadPartial = 6
+
+	// exitBuildServer is the exit status when the deploy
+	// to the build server failed or was not confirmed.
+	exitBuildServer = 7
+
+	// exitInterrupted is the exit status when a deploy is
+	// interrupted, distinct from the status of a failed one.
+	exitInterrupted = 130
+)
+
+// exitStatus returns the exit status for err, an
+// error from a deploy, according to its kind.
+func exitStatus(err error) int {
+	switch {
+	case errors.Is(err, releaser.ErrInterrupted):
+		return exitInterrupted
+	case errors.Is(err, releaser.ErrPreflight):
+		return exitPreflight
+	case errors.Is(err, releaser.ErrChecksFailed):
+		return exitChecksFailed
+	case errors.Is(err, releaser.ErrTagExists), errors.Is(err, releaser.ErrTagPush):
+		return exitTagPush
+	case errors.Is(err, releaser.ErrReleaseCreate):
+		return exitRelease
+	case errors.Is(err, releaser.ErrUploadPartial), errors.Is(err, releaser.ErrDownloadUnreachable):
+		return exitUploadPartial
+	case errors.Is(err, releaser.ErrBuildServerDeploy):
+		return exitBuildServer
+	}
+	return exitFailure
+}
+
+// isTerminal returns true if f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// isInteractive returns true if the program is run by
+// someone at a terminal, rather than by CI or a script.
+func isInteractive() bool {
+	return isTerminal(os.Stdin) && isTerminal(os.Stderr)
+}
+
+// ringBell rings the terminal bell to get the operator's
+// attention, since a deploy can take many minutes. It does
+// nothing with -no-bell or if the program isn't interactive.
+func ringBell() {
+	if noBell || !isInteractive() {
+		return
+	}
+	fmt.Fprint(os.Stderr, "\a")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/caddyserver/releaser/internal/releaser"
+)
+
+// cancelOnInterrupt returns a context that is cancelled when
+// the process gets SIGINT or SIGTERM, so the deploy can stop
+// cleanly. A second signal kills the process as usual.
+func cancelOnInterrupt() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+		logger.Warnf("Got %v; stopping the deploy (send it again to quit immediately)", sig)
+		cancel()
+	}()
+	return ctx
+}
+
+// printInterrupted describes how far an interrupted deploy
+// of the given number of platforms got, and how to resume it.
+func printInterrupted(result *releaser.Result, platforms int) {
+	logger.Println("\nThe deploy was interrupted. State of the release:")
+	if !result.TagPushed {
+		logger.Printf("  Tag %s was not pushed.\n", result.Tag)
+		logger.Printf("\nTo start over, delete the local tag if it exists (git tag -d %s)\n", result.Tag)
+		logger.Println("and run this program again; or, if the tag was made, push it")
+		logger.Println("and finish the release with -resume=push.")
+		return
+	}
+	logger.Printf("  Tag %s was pushed.\n", result.Tag)
+	if result.ReleaseURL == "" {
+		logger.Println("  No release was created.")
+	} else {
+		logger.Printf("  Release created: %s\n", result.ReleaseURL)
+		logger.Printf("  %d of %d assets uploaded.\n", len(result.Assets), platforms)
+	}
+	if result.BuildServerDeployed {
+		logger.Println("  Deploy to the build server was requested but not confirmed.")
+		logger.Println("\nTo finish, run again with -resume=buildserver.")
+		return
+	}
+	if result.ReleaseURL != "" {
+		logger.Println("\nTo finish, run again with -resume=upload.")
+		return
+	}
+	logger.Println("\nTo finish, run again with -resume=release.")
+}
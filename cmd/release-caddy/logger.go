@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/releaser/internal/releaser"
+)
+
+// logLevel is the severity of a log message.
+type logLevel int
+
+// Log levels, from least to most severe.
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+func (l logLevel) String() string {
+	switch l {
+	case levelDebug:
+		return "debug"
+	case levelInfo:
+		return "info"
+	case levelWarn:
+		return "warn"
+	case levelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// parseLogLevel returns the level named s.
+func parseLogLevel(s string) (logLevel, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return levelDebug, nil
+	case "info":
+		return levelInfo, nil
+	case "warn", "warning":
+		return levelWarn, nil
+	case "error":
+		return levelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (must be debug, info, warn, or error)", s)
+}
+
+// leveledLogger writes log messages at or above a minimum
+// level, either as plain text in the style of the standard
+// log package or as one JSON object per line.
+type leveledLogger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	print io.Writer // where Printf prints
+	level logLevel
+	json  bool
+	text  *log.Logger
+
+	// plainFatal makes Fatalf print just the message,
+	// without a timestamp, as is usual for a command
+	// run by a script; it has no effect on JSON output.
+	plainFatal bool
+
+	// status is a line kept below the log messages on a
+	// terminal, such as upload progress; see setStatus.
+	status string
+}
+
+// newLogger returns a logger that writes messages at or
+// above level to out, as JSON if asJSON is true.
+func newLogger(out io.Writer, level logLevel, asJSON bool) *leveledLogger {
+	return &leveledLogger{
+		out:   out,
+		print: os.Stdout,
+		level: level,
+		json:  asJSON,
+		text:  log.New(out, "", log.LstdFlags),
+	}
+}
+
+// logger is the logger used throughout the program. It
+// is replaced in main according to the logging flags.
+// Interactive prompts do not go through the logger.
+var logger = newLogger(os.Stderr, levelInfo, false)
+
+// logEntry is the form of a log message in JSON output.
+type logEntry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+}
+
+func (l *leveledLogger) logf(level logLevel, format string, args ...interface{}) {
+	if level < l.level {
+		return
+	}
+	msg := releaser.Redact(strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.json {
+		entry, err := json.Marshal(logEntry{
+			Time:    time.Now().Format(time.RFC3339),
+			Level:   level.String(),
+			Message: msg,
+		})
+		if err != nil {
+			fmt.Fprintf(l.out, "encoding log entry: %v: %s\n", err, msg)
+			return
+		}
+		l.out.Write(append(entry, '\n'))
+		return
+	}
+
+	switch level {
+	case levelDebug:
+		msg = "DEBUG: " + msg
+	case levelWarn:
+		msg = "WARNING: " + msg
+	case levelError:
+		msg = "ERROR: " + msg
+	}
+	if l.status != "" {
+		fmt.Fprint(l.out, clearLine)
+	}
+	l.text.Print(msg)
+	if l.status != "" {
+		fmt.Fprint(l.out, l.status)
+	}
+}
+
+// Printf prints text for the operator to read, such as a
+// notice before a question, to stdout, without a level or
+// timestamp, since it is not a log message. Like log
+// messages, it is redacted and kept above the status line.
+func (l *leveledLogger) Printf(format string, args ...interface{}) {
+	l.Write([]byte(fmt.Sprintf(format, args...)))
+}
+
+// Println is like Printf, but formats like fmt.Println.
+func (l *leveledLogger) Println(args ...interface{}) {
+	l.Write([]byte(fmt.Sprintln(args...)))
+}
+
+// Write prints p as Printf does, so that output written
+// through an io.Writer, such as a tabwriter, is too.
+func (l *leveledLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.status != "" {
+		fmt.Fprint(l.out, clearLine)
+	}
+	_, err := io.WriteString(l.print, releaser.Redact(string(p)))
+	if l.status != "" {
+		fmt.Fprint(l.out, l.status)
+	}
+	return len(p), err
+}
+
+// clearLine moves a terminal's cursor to the beginning
+// of the line and erases it.
+const clearLine = "\r\033[K"
+
+// setStatus shows line below the log messages, replacing
+// the previous status line; an empty line removes it. It
+// must only be used when the output is a terminal.
+func (l *leveledLogger) setStatus(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if line == l.status {
+		return
+	}
+	fmt.Fprint(l.out, clearLine+line)
+	l.status = line
+}
+
+// Debugf logs a message useful only when troubleshooting.
+func (l *leveledLogger) Debugf(format string, args ...interface{}) {
+	l.logf(levelDebug, format, args...)
+}
+
+// Infof logs a routine progress message.
+func (l *leveledLogger) Infof(format string, args ...interface{}) {
+	l.logf(levelInfo, format, args...)
+}
+
+// Warnf logs a problem that does not stop the deploy.
+func (l *leveledLogger) Warnf(format string, args ...interface{}) {
+	l.logf(levelWarn, format, args...)
+}
+
+// Errorf logs a problem that causes something to fail.
+func (l *leveledLogger) Errorf(format string, args ...interface{}) {
+	l.logf(levelError, format, args...)
+}
+
+// Fatalf logs an error, then exits the program
+// with status exitFailure.
+func (l *leveledLogger) Fatalf(format string, args ...interface{}) {
+	l.Exitf(exitFailure, format, args...)
+}
+
+// Exitf is like Fatalf, but exits with the given status.
+func (l *leveledLogger) Exitf(status int, format string, args ...interface{}) {
+	if l.plainFatal && !l.json {
+		l.mu.Lock()
+		fmt.Fprintf(l.out, "release-caddy: %s\n", releaser.Redact(strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")))
+		l.mu.Unlock()
+	} else {
+		l.logf(levelError, format, args...)
+	}
+	os.Exit(status)
+}
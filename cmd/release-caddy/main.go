@@ -1,403 +1,1013 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
-	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"sort"
+	"regexp"
 	"strconv"
 	"strings"
-	"sync"
+	"text/template"
 	"time"
 
-	"golang.org/x/oauth2"
-
 	"github.com/alecaivazis/survey"
 	"github.com/caddyserver/buildworker"
-	"github.com/google/go-github/github"
+	"github.com/caddyserver/releaser/internal/releaser"
 )
 
 var (
 	caddyRepo = filepath.Join(os.Getenv("GOPATH"), "src", buildworker.CaddyPackage)
 
-	githubAccessToken = os.Getenv("GITHUB_TOKEN")
-
-	devportalAccountID = os.Getenv("DEVPORTAL_ID")  // account ID at caddyserver.com
-	devportalAPIKey    = os.Getenv("DEVPORTAL_KEY") // associated API key
+	// cfg is the configuration for this deploy; see releaser.LoadConfig.
+	cfg releaser.Config
+
+	// configFile is the path to an optional JSON or TOML config file.
+	configFile string
+
+	// skipFlag is a comma-separated list of platforms to skip,
+	// which replaces the skip list in the configuration if set.
+	skipFlag string
+
+	// onlyPlatformsFlag is a comma-separated list of the only
+	// platforms to build, which replaces the allowlist in the
+	// configuration if set.
+	onlyPlatformsFlag string
+
+	// providerFlag is where to publish the release, which
+	// replaces the provider in the configuration if set.
+	providerFlag string
+
+	// webhookFlag is a URL to notify when the deploy finishes,
+	// which replaces the webhook URL in the configuration if set.
+	webhookFlag string
+
+	// stableTagFlag is the tag to move to each release that
+	// isn't a pre-release, which replaces stable_tag if set.
+	stableTagFlag string
+
+	// noBuildServer turns off the deploy to the build
+	// server, which no_build_server can also do.
+	noBuildServer bool
+
+	// deployTimeout is how long to wait for the build
+	// server to confirm that a deploy has gone live.
+	deployTimeout time.Duration
+
+	// platformFlag restricts the deploy to a single platform,
+	// in the form "os/arch" or "os/arch/arm"; useful for testing.
+	platformFlag string
+
+	// allowBranch permits releasing from a branch
+	// other than the release branch.
+	allowBranch bool
+
+	// assumeYes answers Yes to all yes/no questions, and
+	// tagFlag supplies the new tag, so that a deploy can
+	// run without any interaction (for example, in CI).
+	assumeYes bool
+	tagFlag   string
+
+	// bumpFlag chooses the new tag by incrementing the
+	// current one: "patch", "minor", or "major", or "auto"
+	// to go by the conventional commits since then.
+	bumpFlag string
+
+	// forcePrerelease and forceNoPrerelease override whether
+	// the release is a pre-release, which is otherwise decided
+	// by the channel or inferred from the tag.
+	forcePrerelease   bool
+	forceNoPrerelease bool
+
+	// fullTagSuggestions suggests new tags with all three
+	// version numbers, even if the patch number is 0.
+	fullTagSuggestions bool
+
+	// tagMessage is the annotation of the new tag; if empty,
+	// it is made from the tag and the changelog.
+	tagMessage string
+
+	// includePrereleases makes pre-release tags count as the
+	// current tag when suggesting the next one and making
+	// the changelog; see considerPrereleases.
+	includePrereleases optionalBool
+
+	// includeSource uploads an archive of the source with
+	// the binaries; by default, only for stable releases.
+	includeSource optionalBool
+
+	// tmpdirFlag is where build assets are staged, which
+	// replaces the temporary directory in the configuration
+	// if set.
+	tmpdirFlag string
+
+	// keepAssets is a directory in which to keep the assets
+	// and the checksums file once they are uploaded.
+	keepAssets string
+
+	// buildConcurrencyFlag and uploadConcurrencyFlag are the
+	// sizes of the pools of build and upload workers, which
+	// replace the ones in the configuration if not zero.
+	buildConcurrencyFlag  int
+	uploadConcurrencyFlag int
+
+	// goVersionFlag is the version of Go the release must
+	// be built with; it replaces go_version from the config.
+	goVersionFlag string
+
+	// gitRemoteFlag and gitSSHKeyFlag are the remote to push
+	// the tag to and the SSH key to push with; they replace
+	// git_remote and git_ssh_key from the config file.
+	gitRemoteFlag string
+	gitSSHKeyFlag string
+
+	// tagPrefixFlag begins the name of every release
+	// tag; it replaces tag_prefix from the config file.
+	tagPrefixFlag string
+
+	// pluginsFile is the path to a JSON or TOML file listing
+	// plugins to build into Caddy; see releaser.LoadPlugins.
+	pluginsFile string
+
+	// summaryFile is where to write a JSON summary of the release.
+	summaryFile string
+
+	// signAssets enables uploading a detached GPG
+	// signature for each asset and the checksums file.
+	signAssets bool
+
+	// rollbackTag is a tag whose release and tag
+	// should be deleted, instead of deploying.
+	rollbackTag string
+
+	// refreshChecksumsTag is a tag whose release should get
+	// a new checksums file computed from its assets, instead
+	// of deploying.
+	refreshChecksumsTag string
+
+	// buildOnly builds the assets into outDir, instead of
+	// deploying; nothing is tagged or published.
+	buildOnly bool
+	outDir    string
+
+	// skipChecks skips the tests and build checks
+	// on a new deploy.
+	skipChecks bool
+
+	// updateGopath updates the master GOPATH before
+	// the checks, the way the build server does.
+	updateGopath bool
+
+	// isolatedChecks runs the checks in a temporary
+	// GOPATH holding a shallow clone of the commit.
+	isolatedChecks bool
+
+	// verboseChecks streams the log of the checks as they run.
+	verboseChecks bool
+
+	// gcTemp removes the temporary folders left by earlier
+	// deploys, listing them, instead of deploying.
+	gcTemp bool
+
+	// staleTempAge is how long a temporary folder left by an
+	// earlier deploy must be unchanged before it is removed.
+	staleTempAge time.Duration
+
+	// confirmPlatformsFlag asks the operator to confirm the
+	// platforms to build, shown with how long they will take.
+	confirmPlatformsFlag bool
+
+	// cacheChecks skips the checks for a commit that has
+	// already passed them, unless forceChecks is set.
+	cacheChecks bool
+	forceChecks bool
+
+	// assetNameFlag is a template for the names of release
+	// assets, which replaces the configured template if set;
+	// assetNameTemplate is the parsed template, if any.
+	assetNameFlag     string
+	assetNameTemplate *template.Template
+
+	// releaseBodyFlag replaces the release notes with ones
+	// rendered from the release body template after uploading.
+	releaseBodyFlag bool
+
+	// updateHomebrew renders a Homebrew formula for the
+	// release, and pushes it to the tap if one is configured.
+	updateHomebrew bool
+
+	// pushDocker builds and pushes a Docker image
+	// of the release once it is published.
+	pushDocker bool
+
+	// mirrorS3 also uploads the assets to the configured
+	// S3 bucket, and skipRelease skips making a release
+	// on the provider, so they only go to S3.
+	mirrorS3    bool
+	skipRelease bool
+
+	// deleteUnverifiedTag deletes the new tag if it isn't
+	// signed by one of the allowed signing keys.
+	deleteUnverifiedTag bool
+
+	// replaceExisting replaces release assets that already
+	// exist, rather than skipping them.
+	replaceExisting bool
+
+	// verifyUploads downloads each uploaded asset to
+	// check that its SHA-256 matches the local file.
+	verifyUploads bool
+
+	// verifyDownloads checks that each asset can be
+	// downloaded once the release is published.
+	verifyDownloads bool
+
+	// perAssetChecksums uploads a .sha256 file next to
+	// each asset, as well as the combined checksums file.
+	perAssetChecksums bool
+
+	// commitFlag is the commit to release, if not HEAD;
+	// once checked, it is the commit's full SHA.
+	commitFlag string
+
+	// noPush stops a new deploy after tagging locally,
+	// so the tag can be reviewed before it's pushed.
+	noPush bool
+
+	// maxFailures is how many platforms may fail while the
+	// release is still published, and failFast stops the
+	// deploy as soon as more than that have failed.
+	maxFailures int
+
+	// maxBuildRetries and maxUploadRetries are how many
+	// times to try a failed build or upload again, and
+	// retryBackoff is how long to wait before the first
+	// retry, doubling with each retry after that.
+	maxBuildRetries  int
+	maxUploadRetries int
+	retryBackoff     time.Duration
+	failFast         bool
+
+	// tagWait is how long to wait for a pushed
+	// tag to become visible on GitHub.
+	tagWait time.Duration
+
+	// channelFlag is the name of the release channel to
+	// deploy to, and channel is its configuration.
+	channelFlag string
+	channel     releaser.ChannelConfig
+
+	// envFlag is the name of the devportal environment
+	// to deploy to, and environment is its configuration.
+	envFlag     string
+	environment releaser.EnvironmentConfig
+
+	// listPlatforms prints the platforms that would be built, then exits.
+	listPlatforms bool
+
+	// diffAssets compares the platforms that would be built
+	// with those of the previous release, then exits.
+	diffAssets bool
+
+	// listTags prints the tags of releases, sorted by
+	// version, instead of deploying.
+	listTags bool
+
+	// showChangelog prints the changes since the tag
+	// sinceTag (or the current tag), then exits.
+	showChangelog bool
+	sinceTag      string
+
+	// showCommits lists the commits since the previous
+	// release when confirming the commit to release.
+	showCommits bool
+
+	// logLevelFlag is the minimum level of log messages to show,
+	// and logJSON enables machine-readable log output.
+	logLevelFlag string
+	logJSON      bool
+
+	// noBell disables the terminal bell when a deploy fails.
+	noBell bool
+
+	// verbose logs every command that is run, such as git.
+	verbose bool
 
 	// resume allows us to skip some deploy steps using the most recent, existing tag.
 	// only use resume if a tag was pushed but a subsequent step failed.
-	resume string
-)
+	// resumeStage is the stage it names; see releaser.ParseStage.
+	resume      string
+	resumeStage releaser.Stage
 
-const (
-	githubOwner = "mholt"                   // the owner of the repository to publish to
-	githubRepo  = "caddy"                   // the owner's repository to publish to
-	websiteURL  = "https://caddyserver.com" // URL to the Caddy website
+	// releaseIDFlag is the ID of a release made elsewhere,
+	// such as by a CI workflow, to only build and upload to.
+	releaseIDFlag int64
 )
 
 func main() {
-	flag.StringVar(&resume, "resume", "", `may be "github" to skip all deploy steps and resume most recent deploy if failed`)
+	flag.StringVar(&resume, "resume", "", `resume the deploy of the most recent tag at a stage: "release" to create the release onward, "upload" to build and upload to the existing release onward, or "buildserver" to only deploy it to the build server`)
+	flag.Int64Var(&releaseIDFlag, "release-id", 0, "only build and upload the assets to the existing release with this ID, made elsewhere, for its tag (like -resume=upload)")
+	flag.StringVar(&configFile, "config", "", "path to a JSON or TOML config file (environment variables take precedence)")
+	flag.StringVar(&skipFlag, "skip", "", "comma-separated list of os/arch/arm platforms not to build (replaces configured list)")
+	flag.StringVar(&providerFlag, "provider", "", `where to publish the release: "github" or "gitlab" (replaces configured provider)`)
+	flag.StringVar(&webhookFlag, "webhook-url", "", "URL to POST a JSON notification to when the deploy succeeds or fails")
+	flag.StringVar(&stableTagFlag, "stable-tag", "", `tag to move to each release that isn't a pre-release and force-push, such as "stable" (replaces configured stable_tag)`)
+	flag.BoolVar(&noBuildServer, "no-build-server", false, "don't deploy to the Caddy build server, so only the tag and the release are made and no devportal credentials are needed")
+	flag.DurationVar(&deployTimeout, "deploy-timeout", 10*time.Minute, "how long to wait for the build server to confirm the deploy")
+	flag.StringVar(&onlyPlatformsFlag, "only-platforms", "", "comma-separated list of the only os/arch[/arm] platforms to build, ignoring the skip list")
+	flag.StringVar(&platformFlag, "platform", "", "build only this os/arch[/arm] platform, ignoring the skip list (for testing)")
+	flag.BoolVar(&allowBranch, "allow-branch", false, "allow releasing from a branch other than the release branch")
+	flag.BoolVar(&assumeYes, "yes", false, "answer Yes to all confirmations (requires -tag unless resuming)")
+	flag.StringVar(&tagFlag, "tag", "", "the tag for the new release, instead of asking for it")
+	flag.StringVar(&bumpFlag, "bump", "", `suggest the new tag by incrementing the current one: "patch", "minor", "major", or "auto" to choose by the conventional commits since it; with -yes, use it`)
+	flag.BoolVar(&forcePrerelease, "prerelease", false, "publish the release as a pre-release, whatever the tag or channel")
+	flag.BoolVar(&forceNoPrerelease, "no-prerelease", false, "publish the release as a full release, whatever the tag or channel")
+	flag.Var(&includePrereleases, "include-prereleases", "base the suggested tags and the changelog on the latest tag even if it is a pre-release (default true only for channels of pre-releases)")
+	flag.BoolVar(&fullTagSuggestions, "full-tag-suggestions", false, `suggest new tags like "v0.11.0" instead of "v0.11"`)
+	flag.StringVar(&summaryFile, "output", "", "file to write a JSON summary of the release to")
+	flag.BoolVar(&signAssets, "sign-assets", false, "upload a detached GPG signature (.asc) for each asset and the checksums file")
+	flag.BoolVar(&buildOnly, "build-only", false, "build the assets at the current commit into the -out directory, instead of deploying")
+	flag.StringVar(&outDir, "out", "", "the directory to put the assets in with -build-only")
+	flag.StringVar(&refreshChecksumsTag, "refresh-checksums", "", "recompute the checksums file of the release for this tag from its assets and replace it, instead of deploying")
+	flag.StringVar(&rollbackTag, "rollback", "", "delete the GitHub release and the git tag for this tag, instead of deploying")
+	flag.BoolVar(&skipChecks, "skip-checks", false, "DANGEROUS: release without running the tests and build checks")
+	flag.BoolVar(&isolatedChecks, "isolated-checks", false, "run the checks in a shallow clone of the commit in a temporary GOPATH, leaving yours untouched")
+	flag.BoolVar(&updateGopath, "update-gopath", false, "update the dependencies in GOPATH before the checks, like the build server does (overwrites them; cannot be undone)")
+	flag.BoolVar(&verboseChecks, "verbose-checks", false, "stream the output of the tests and build checks as they run")
+	flag.BoolVar(&gcTemp, "gc-temp", false, "list and remove the temporary folders left by earlier deploys that failed or were killed, instead of deploying")
+	flag.DurationVar(&staleTempAge, "stale-temp-age", 24*time.Hour, "how long a temporary folder left by an earlier deploy must be unchanged before it is removed at startup (0 to not remove any at startup)")
+	flag.BoolVar(&confirmPlatformsFlag, "confirm-platforms", false, "after choosing the tag, show the platforms to build and about how long it will take, and ask to go ahead")
+	flag.BoolVar(&cacheChecks, "cache-checks", false, "skip the checks if they already passed for the current commit, and record when they pass")
+	flag.BoolVar(&forceChecks, "force-checks", false, "with -cache-checks, run the checks even if they already passed for the current commit")
+	flag.StringVar(&assetNameFlag, "asset-name-template", "", "text/template for release asset names, e.g. {{.Repo}}_{{.Version}}_{{.OS}}_{{.Arch}}{{.Ext}}")
+	flag.BoolVar(&releaseBodyFlag, "release-body", false, "once the assets are uploaded, replace the release notes with ones rendered from release_body_template (by default, with a table of downloads)")
+	flag.BoolVar(&updateHomebrew, "update-homebrew", false, "after a release that isn't a pre-release, update the Homebrew formula (and push it to the configured tap)")
+	flag.BoolVar(&mirrorS3, "mirror-s3", false, "also upload the assets and checksums to the configured S3-compatible bucket")
+	flag.BoolVar(&skipRelease, "skip-release", false, "don't make a release on GitHub or GitLab; requires -mirror-s3")
+	flag.BoolVar(&pushDocker, "push-docker", false, "build a multi-platform Docker image of the release with docker buildx and push it to the configured registry")
+	flag.BoolVar(&deleteUnverifiedTag, "delete-unverified-tag", false, "delete the tag, before it is pushed, if it isn't signed by one of allowed_signing_keys, so it can be made again")
+	flag.BoolVar(&replaceExisting, "replace-existing", false, "replace assets already attached to the release instead of skipping them")
+	flag.StringVar(&tagMessage, "tag-message", "", `annotation of the new tag (default "Release <tag>" followed by the changelog since the previous tag)`)
+	flag.Var(&includeSource, "include-source", "upload a source archive made with git archive along with the binaries (default true for stable releases that aren't pre-releases)")
+	flag.StringVar(&goVersionFlag, "go-version", "", `version of Go the release must be built with, such as "1.10" or "1.10.3" (replaces configured go_version)`)
+	flag.StringVar(&tagPrefixFlag, "tag-prefix", "", `prefix of every release tag, such as "caddy/" for tags like caddy/v1.2.3 (replaces configured tag_prefix)`)
+	flag.StringVar(&gitRemoteFlag, "git-remote", "", `git remote to push the tag to (replaces configured git_remote; default "origin")`)
+	flag.StringVar(&gitSSHKeyFlag, "git-ssh-key", "", "path to the SSH private key to push the tag with (replaces configured git_ssh_key)")
+	flag.IntVar(&buildConcurrencyFlag, "build-concurrency", 0, "how many platforms to build at once (replaces configured build_concurrency)")
+	flag.IntVar(&uploadConcurrencyFlag, "upload-concurrency", 0, "how many built assets to upload at once (replaces configured upload_concurrency)")
+	flag.StringVar(&keepAssets, "keep-assets", "", "directory to move each asset (and its signature) into once it is uploaded, along with the checksums file, instead of deleting them")
+	flag.StringVar(&tmpdirFlag, "tmpdir", "", "directory in which to stage build assets (replaces configured temp_dir; default: the system's temporary directory)")
+	flag.StringVar(&pluginsFile, "plugins", "", "path to a JSON or TOML file listing plugins to build into Caddy")
+	flag.BoolVar(&verifyUploads, "verify-uploads", false, "download each uploaded asset to check its SHA-256 (sizes are always checked)")
+	flag.BoolVar(&verifyDownloads, "verify-downloads", false, "after publishing, check that each asset's download URL responds with its full size")
+	flag.BoolVar(&perAssetChecksums, "per-asset-checksums", false, "also upload a .sha256 file with the checksum of each asset, next to it")
+	flag.StringVar(&commitFlag, "commit", "", "release this commit of the current branch instead of HEAD, without checking it out")
+	flag.BoolVar(&noPush, "no-push", false, "stop after making the tag locally, without pushing it; resume with -resume=push")
+	flag.IntVar(&maxBuildRetries, "max-build-retries", 0, "how many times to try building a platform again after it fails")
+	flag.IntVar(&maxUploadRetries, "max-upload-retries", 4, "how many times to try uploading a file again after it fails")
+	flag.DurationVar(&retryBackoff, "retry-backoff", 2*time.Second, "how long to wait before retrying a build or upload; doubles with each retry")
+	flag.IntVar(&maxFailures, "max-failures", 0, "publish the release without the platforms that failed, if there are no more than this many")
+	flag.BoolVar(&failFast, "fail-fast", false, "stop building and uploading as soon as more than -max-failures platforms have failed")
+	flag.DurationVar(&tagWait, "tag-wait", time.Minute, "how long to wait for GitHub to see the pushed tag before creating the release")
+	flag.StringVar(&channelFlag, "channel", "stable", "the release channel to deploy to, as named in the configuration (e.g. stable or edge)")
+	flag.StringVar(&envFlag, "env", "production", "the devportal environment to deploy to, as named in the configuration (e.g. production or staging)")
+	flag.BoolVar(&listPlatforms, "list-platforms", false, "print the platforms that would be built and exit without deploying")
+	flag.BoolVar(&diffAssets, "diff-assets", false, "compare the platforms that would be built with the previous release's (or -since) and exit without deploying")
+	flag.BoolVar(&listTags, "list-tags", false, "print the tags of releases, newest first, marking pre-releases and the latest stable release, and exit without deploying")
+	flag.BoolVar(&showChangelog, "changelog", false, "print the commits since the last tag (or -since), grouped by type, and exit without deploying")
+	flag.BoolVar(&showCommits, "show-commits", false, "list every commit since the previous release when confirming the commit to release")
+	flag.StringVar(&sinceTag, "since", "", "with -changelog or -diff-assets, the tag to compare with (default: the current tag)")
+	flag.StringVar(&logLevelFlag, "log-level", "info", "minimum level of log messages to show: debug, info, warn, or error")
+	flag.BoolVar(&logJSON, "log-json", false, "write log messages as JSON, one object per line")
+	flag.BoolVar(&noBell, "no-bell", false, "don't ring the terminal bell when a deploy fails")
+	flag.BoolVar(&verbose, "verbose", false, "log every command run, such as git, gpg, and docker, with any secrets redacted")
 	flag.Parse()
 
-	fmt.Printf("Using Caddy source at: %s\n", caddyRepo)
+	level, err := parseLogLevel(logLevelFlag)
+	if err != nil {
+		logger.Exitf(exitPreflight, "%v", err)
+	}
+	logger = newLogger(os.Stderr, level, logJSON)
+	logger.plainFatal = !isInteractive()
 
-	// some initial checks before we begin
-	if err := envVariablesSet(); err != nil {
-		log.Fatalf("Aborting deployment: %v", err)
+	resumeStage, err = releaser.ParseStage(resume)
+	if err != nil {
+		logger.Exitf(exitPreflight, "%v", err)
 	}
-	if err := workingCopyClean(); err != nil {
-		log.Fatalf("Aborting deployment: %v", err)
+	if resume == "github" {
+		logger.Warnf(`-resume=github is deprecated; use -resume=release`)
 	}
-
-	var tag string
-	var prerelease bool
-	var err error
-
-	// see if we're resuming a deploy; only do this if a
-	// tag was pushed but some step after the push failed.
-	if resume != "" {
-		// resume a deploy
-
-		tag, err = getCurrentTag()
-		if err != nil {
-			log.Fatal(err)
+	if releaseIDFlag != 0 {
+		if resumeStage != releaser.StageNew {
+			logger.Exitf(exitPreflight, "-release-id cannot be used with -resume; it always starts at uploading")
 		}
-		prerelease = isPrerelease(tag)
-
-		if resume == "github" {
-			fmt.Printf("\nNOTE: The deploy for %s is being resumed.\n", tag)
-			fmt.Println("The process will pick up at publishing a release on GitHub.")
-		} else {
-			log.Fatal("Unknown resume state")
+		if tagFlag != "" || bumpFlag != "" {
+			logger.Exitf(exitPreflight, "-release-id cannot be used with -tag or -bump; the release's tag is deployed")
 		}
+		resumeStage = releaser.StageUpload
+	}
+	if noPush && resumeStage != releaser.StageNew {
+		logger.Exitf(exitPreflight, "-no-push can only be used with a new deploy")
+	}
+	if commitFlag != "" && resumeStage != releaser.StageNew {
+		logger.Exitf(exitPreflight, "-commit can only be used with a new deploy")
+	}
+	if isolatedChecks && updateGopath {
+		logger.Exitf(exitPreflight, "-isolated-checks and -update-gopath cannot both be given; isolated checks never use your GOPATH")
+	}
 
-		confirmed, err := askYesNo("Continue?")
-		if err != nil {
-			log.Fatal(err)
-		}
-		if !confirmed {
-			log.Fatal("Aborting resumed deployment")
-		}
-	} else {
-		// begin a new deploy
+	cfg, err = releaser.LoadConfig(configFile)
+	if err != nil {
+		logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+	}
+	if skipFlag != "" {
+		cfg.SkipPlatforms = strings.Split(skipFlag, ",")
+	}
+	if onlyPlatformsFlag != "" {
+		cfg.OnlyPlatforms = strings.Split(onlyPlatformsFlag, ",")
+	}
+	if providerFlag != "" {
+		cfg.Provider = providerFlag
+	}
+	if webhookFlag != "" {
+		cfg.WebhookURL = webhookFlag
+	}
+	if assetNameFlag != "" {
+		cfg.AssetNameTemplate = assetNameFlag
+	}
+	if tmpdirFlag != "" {
+		cfg.TempDir = tmpdirFlag
+	}
+	if stableTagFlag != "" {
+		cfg.StableTag = stableTagFlag
+	}
+	if noBuildServer {
+		cfg.NoBuildServer = true
+	}
+	if buildConcurrencyFlag != 0 {
+		cfg.BuildConcurrency = buildConcurrencyFlag
+	}
+	if uploadConcurrencyFlag != 0 {
+		cfg.UploadConcurrency = uploadConcurrencyFlag
+	}
+	if tagPrefixFlag != "" {
+		cfg.TagPrefix = tagPrefixFlag
+	}
+	if goVersionFlag != "" {
+		cfg.GoVersion = goVersionFlag
+	}
+	if gitRemoteFlag != "" {
+		cfg.GitRemote = gitRemoteFlag
+	}
+	if gitSSHKeyFlag != "" {
+		cfg.GitSSHKey = gitSSHKeyFlag
+	}
+	releaser.SetSecrets(cfg.Secrets()...)
+	if verbose {
+		releaser.LogCommands(logger)
+	}
 
-		if err := confirmRightCommit(); err != nil {
-			log.Fatalf("Aborting deployment: %v", err)
+	// failed deploys can leave their temporary folders behind
+	if gcTemp {
+		if err := removeStaleTempDirs(true); err != nil {
+			logger.Fatalf("Removing stale temporary folders: %v", err)
 		}
-		if err := confirmReadmeUpdated(); err != nil {
-			log.Fatalf("Aborting deployment: %v", err)
+		return
+	}
+	if staleTempAge > 0 {
+		if err := removeStaleTempDirs(false); err != nil {
+			logger.Warnf("Removing stale temporary folders: %v", err)
 		}
+	}
 
-		// get the tag for the new release
-		tag, prerelease, err = askNewTagVersion()
-		if err != nil {
-			log.Fatal(err)
-		}
+	// the channel decides whether pre-release tags count
+	// as the current tag, so the read-only commands need it
+	channel, err = cfg.Channel(channelFlag)
+	if err != nil {
+		logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+	}
+	if forcePrerelease && forceNoPrerelease {
+		logger.Exitf(exitPreflight, "Aborting deployment: -prerelease and -no-prerelease cannot both be given")
+	}
+	if forcePrerelease || forceNoPrerelease {
+		channel.Prerelease = &forcePrerelease
+	}
 
-		// one more check
-		fmt.Println("\nNOTICE: If you continue, your GOPATH will be updated")
-		fmt.Printf("by running `go get -u %s` \n", buildworker.CaddyPackage)
-		fmt.Println("before checks are performed. Tests will follow, and")
-		fmt.Println("the release will continue only if the tests pass.")
-		confirmed, err := askYesNo("I'm ready. Are you ready? There's no going back:")
-		if err != nil {
-			log.Fatal(err)
+	// previewing the changelog is read-only, and
+	// doesn't depend on the rest of the configuration
+	if listTags {
+		if err := printTags(); err != nil {
+			logger.Fatalf("Listing tags: %v", err)
 		}
-		if !confirmed {
-			log.Fatal("Aborting deployment: operator not ready 🙄")
+		return
+	}
+	if showChangelog {
+		if err := printChangelog(sinceTag); err != nil {
+			logger.Fatalf("Changelog: %v", err)
 		}
+		return
 	}
 
-	// here we goooo!
-	err = deploy(tag, prerelease, resume)
+	environment, err = cfg.Environment(envFlag)
 	if err != nil {
-		fmt.Print("\a") // terminal bell, since we might be minutes into a deploy
-		log.Fatal(err)
+		logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+	}
+	switch bumpFlag {
+	case "", "auto", "patch", "minor", "major":
+	default:
+		logger.Exitf(exitPreflight, "Aborting deployment: unknown -bump %q (must be auto, patch, minor, or major)", bumpFlag)
+	}
+	if bumpFlag != "" && tagFlag != "" {
+		logger.Exitf(exitPreflight, "Aborting deployment: -bump and -tag cannot both be given")
+	}
+	if maxFailures < 0 {
+		logger.Exitf(exitPreflight, "Aborting deployment: -max-failures cannot be negative")
+	}
+	if maxBuildRetries < 0 || maxUploadRetries < 0 {
+		logger.Exitf(exitPreflight, "Aborting deployment: -max-build-retries and -max-upload-retries cannot be negative")
+	}
+	if buildConcurrencyFlag < 0 || uploadConcurrencyFlag < 0 {
+		logger.Exitf(exitPreflight, "Aborting deployment: -build-concurrency and -upload-concurrency cannot be negative")
+	}
+	if retryBackoff < 0 {
+		logger.Exitf(exitPreflight, "Aborting deployment: -retry-backoff cannot be negative")
 	}
 
-	log.Println("Done.")
-	log.Printf("%s release successful.", tag)
-}
-
-// deploy runs checks on caddy, and if they succeed, tags
-// the current commit and releases Caddy. Pass in the name
-// of the tag, whether it is a pre-release, and where to
-// resume the deploy at, if at all (otherwise empty string).
-func deploy(tag string, prerelease bool, resume string) error {
-	if resume == "" {
-		log.Printf("Preparing to deploy new tag: %s", tag)
-
-		// run checks to make sure it, you know, works.
-		err := checkCaddy()
+	var platforms []buildworker.Platform
+	if len(cfg.OnlyPlatforms) > 0 {
+		if platformFlag != "" {
+			logger.Exitf(exitPreflight, "Resolving platforms: -platform cannot be used with an allowlist of platforms")
+		}
+		logger.Debugf("Building only the listed platforms; the skip list is ignored")
+		platforms, err = releaser.SelectPlatforms(cfg.OnlyPlatforms)
+	} else {
+		platforms, err = releaser.ResolvePlatforms(cfg.SkipPlatforms)
+	}
+	if err != nil {
+		logger.Exitf(exitPreflight, "Resolving platforms: %v", err)
+	}
+	if platformFlag != "" {
+		plat, err := releaser.SelectPlatform(platformFlag)
 		if err != nil {
-			return fmt.Errorf("checks: %v", err)
+			logger.Exitf(exitPreflight, "Resolving platforms: %v", err)
 		}
+		platforms = []buildworker.Platform{plat}
+	}
 
-		// git tag (signed)
-		log.Println("Tagging release")
-		err = run("git", "tag", "-s", tag, "-m", "")
+	assetNameTemplate, err = releaser.ParseAssetNameTemplate(cfg.AssetNameTemplate, cfg.GitHubRepo, platforms)
+	if err != nil {
+		logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+	}
+	ldflagsTemplate, err := releaser.ParseLDFlagsTemplate(cfg.LDFlags)
+	if err != nil {
+		logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+	}
+
+	var plugins []buildworker.CaddyPlugin
+	if pluginsFile != "" {
+		plugins, err = releaser.LoadPlugins(pluginsFile)
 		if err != nil {
-			return fmt.Errorf("creating signed tag: %v", err)
+			logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
 		}
+	}
 
-		// git push
-		log.Println("Pushing tag")
-		err = run("git", "push")
+	var releaseBody *template.Template
+	if releaseBodyFlag {
+		releaseBody, err = releaser.ParseReleaseBodyTemplate(cfg.ReleaseBodyTemplate)
 		if err != nil {
-			return fmt.Errorf("git push: %v", err)
+			logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
 		}
+	}
 
-		// git push tag
-		log.Println("Pushing any remaining commits")
-		err = run("git", "push", "--tags")
+	var homebrewFormula *template.Template
+	if updateHomebrew {
+		homebrewFormula, err = releaser.ParseHomebrewTemplate(cfg.HomebrewTemplate)
 		if err != nil {
-			return fmt.Errorf("pushing tag: %v", err)
+			logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
 		}
-
-		// Wait a moment before publishing the release; I've seen the API call
-		// to publish a release on GitHub fail with "Published releases must
-		// have a valid tag" even after pushing the tag. I suspect that their
-		// system must be only "eventually consistent" so perhaps by waiting a
-		// few seconds, we'll alleviate any sort of race condition they have.
-		log.Println("Waiting a few seconds before publishing release...")
-		time.Sleep(5 * time.Second)
 	}
 
-	// create release on GitHub
-	log.Println("Publishing release to GitHub")
-	ghClient, release, err := publishReleaseToGitHub(tag, prerelease)
-	if err != nil {
-		return fmt.Errorf("creating release: %v", err)
+	// listing platforms is read-only, so it needs
+	// neither credentials nor a clean working copy
+	if listPlatforms {
+		printPlatforms(platforms)
+		return
 	}
 
-	// set up environment in which to perform builds
-	log.Println("Preparing builds")
-	deployEnv, err := buildworker.Open(tag, nil)
-	if err != nil {
-		return fmt.Errorf("opening build environment: %v", err)
+	// comparing with the previous release is read-only
+	// and only involves the provider
+	if diffAssets {
+		if err := printAssetDiffSince(sinceTag, platforms); err != nil {
+			logger.Fatalf("Comparing assets: %v", err)
+		}
+		return
 	}
-	defer deployEnv.Close()
 
-	// the demand for Caddy on these platforms is very low
-	// and the demand on the CPU is very high
-	skip := append(buildworker.UnsupportedPlatforms, []buildworker.Platform{
-		{OS: "dragonfly"},
-		{OS: "solaris"},
-		{OS: "netbsd"},
-		{ARM: "5"},
-		{ARM: "6"},
-		{OS: "darwin", Arch: "386"},
-		{OS: "darwin", Arch: "arm64"},
-		{Arch: "mips64"},
-		{Arch: "mips64le"},
-		{Arch: "ppc64"},
-		{Arch: "ppc64le"},
-		{OS: "openbsd", Arch: "386"},
-		{OS: "openbsd", Arch: "arm"},
-		{OS: "freebsd", Arch: "386"},
-		{OS: "freebsd", Arch: "arm"},
-	}...)
+	if assumeYes && tagFlag == "" && bumpFlag == "" && resumeStage == releaser.StageNew {
+		logger.Exitf(exitPreflight, "Aborting deployment: -yes requires -tag or -bump to be set, so the new tag is known without asking")
+	}
 
-	platforms, err := buildworker.SupportedPlatforms(skip)
-	if err != nil {
-		return err
+	// without a terminal, questions would block a pipeline
+	// or fail cryptically, so fail clearly before starting
+	if !assumeYes && !buildOnly && refreshChecksumsTag == "" {
+		if err := requireTerminal(); err != nil {
+			logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+		}
 	}
 
-	// make a temporary folder where we will store build assets while
-	// they upload; the name of each asset will be unique by platform.
-	tmpdir, err := ioutil.TempDir("", "caddy_deployment_")
-	if err != nil {
-		return fmt.Errorf("making temporary directory: %v", err)
+	// rolling back only involves git and GitHub,
+	// so it doesn't need the rest of the configuration
+	if rollbackTag != "" {
+		logger.Printf("Using Caddy source at: %s\n", caddyRepo)
+		if cfg.Provider != "github" {
+			logger.Exitf(exitPreflight, "Aborting rollback: only releases on GitHub can be rolled back")
+		}
+		if cfg.GitHubToken == "" {
+			logger.Exitf(exitPreflight, "Aborting rollback: GitHub token is required (GITHUB_TOKEN or github_token)")
+		}
+		if err := rollback(rollbackTag); err != nil {
+			logger.Exitf(exitStatus(err), "Rollback: %v", err)
+		}
+		logger.Infof("Rolled back %s", rollbackTag)
+		return
 	}
-	defer os.RemoveAll(tmpdir)
 
-	// perform some number of builds concurrently; throttle uploads separately
-	var wg sync.WaitGroup
-	var buildThrottle, uploadThrottle = make(chan struct{}, 2), make(chan struct{}, 3)
+	// likewise, refreshing checksums only involves the
+	// provider (and gpg, if signing)
+	if refreshChecksumsTag != "" {
+		provider, err := cfg.NewProvider(logger)
+		if err != nil {
+			logger.Exitf(exitPreflight, "Refreshing checksums: %v", err)
+		}
+		deployer := &releaser.Deployer{
+			Config:          cfg,
+			Log:             logger,
+			Provider:        provider,
+			SignAssets:      signAssets,
+			NoSigningPrompt: !isTerminal(os.Stdin),
+			UploadRetries:   maxUploadRetries,
+			RetryBackoff:    retryBackoff,
+		}
+		if err := deployer.RefreshChecksums(cancelOnInterrupt(), refreshChecksumsTag); err != nil {
+			logger.Exitf(exitStatus(err), "Refreshing checksums: %v", err)
+		}
+		logger.Infof("Refreshed checksums of %s", refreshChecksumsTag)
+		return
+	}
 
-	// build and upload a static release for each platform we choose
-	for _, plat := range platforms {
-		wg.Add(1)
-		buildThrottle <- struct{}{}
+	// building only needs the build environment
+	if buildOnly {
+		if outDir == "" {
+			logger.Exitf(exitPreflight, "-build-only requires -out to be set")
+		}
+		if keepAssets != "" {
+			logger.Exitf(exitPreflight, "-keep-assets cannot be used with -build-only, which keeps the assets in -out")
+		}
+		logger.Printf("Using Caddy source at: %s\n", caddyRepo)
+		deployer := &releaser.Deployer{
+			Config:     cfg,
+			RepoDir:    caddyRepo,
+			OpenEnv:    releaser.OpenBuildworker,
+			Log:        logger,
+			Plugins:    plugins,
+			AssetNames: assetNameTemplate,
+			LDFlags:    ldflagsTemplate,
+
+			BuildRetries: maxBuildRetries,
+			RetryBackoff: retryBackoff,
+		}
+		result, err := deployer.BuildOnly(cancelOnInterrupt(), platforms, outDir)
+		if len(result.BuildDurations) > 0 {
+			printMetrics(result)
+			recordBuildTimes(result)
+		}
+		printOutcome("Built", result)
+		if errors.Is(err, releaser.ErrInterrupted) {
+			os.Exit(exitInterrupted)
+		}
+		if err != nil {
+			logger.Exitf(exitStatus(err), "Building: %v", err)
+		}
+		logger.Infof("Built %d assets of %s into %s", len(result.Assets), result.Tag, outDir)
+		return
+	}
+	if outDir != "" {
+		logger.Exitf(exitPreflight, "-out can only be used with -build-only")
+	}
 
-		go func(tag string, plat buildworker.Platform) {
-			defer wg.Done()
+	logger.Printf("Using Caddy source at: %s\n", caddyRepo)
 
-			// build
-			log.Printf("Building %s...", plat)
-			file, err := deployEnv.Build(plat, tmpdir)
-			<-buildThrottle
-			if err != nil {
-				log.Printf("building %s: %v\n", plat, err)
-				log.Printf(">>>>>>>>>>>>%s\n<<<<<<<<<<<<\n", deployEnv.Log.String())
-				return
-			}
-			defer func() {
-				file.Close()
-				os.Remove(file.Name())
-			}()
-
-			// TODO: upload a text file with the SHA-256 of all
-			// release assets uploaded to GitHub.
-
-			// upload
-			uploadThrottle <- struct{}{}
-			defer func() { <-uploadThrottle }()
-			maxAttempts := 5
-			for i := 0; i < maxAttempts; i++ {
-				log.Printf("Uploading %s... (attempt %d)", plat, i+1)
-				_, _, err = ghClient.Repositories.UploadReleaseAsset(context.Background(), githubOwner,
-					githubRepo, release.GetID(), &github.UploadOptions{Name: filepath.Base(file.Name())}, file)
-				if err != nil {
-					log.Printf("Error uploading %+v: %v", plat, err)
-					if i < maxAttempts-1 {
-						log.Printf("Trying again to upload %s", plat)
-						_, err = file.Seek(0, 0)
-						if err != nil {
-							log.Printf("!! ERROR: COULD NOT SEEK TO BEGINNING OF FILE FOR %+v: %v", plat, err)
-							return
-						}
-					} else {
-						log.Printf("!! ERROR: COULD NOT UPLOAD %+v: %v", plat, err)
-						return
-					}
-				} else {
-					log.Printf("Uploaded %s successfully", plat)
-					break
-				}
-			}
-		}(tag, plat)
+	// some initial checks before we begin
+	if err := releaser.ValidateConfig(cfg); err != nil {
+		logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+	}
+	if cfg.NoBuildServer {
+		if resumeStage == releaser.StageBuildServer {
+			logger.Exitf(exitPreflight, "Aborting deployment: -resume=buildserver cannot be used when the build server deploy is turned off")
+		}
+	} else if err := environment.CheckCredentials(); err != nil {
+		logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+	}
+	if resumeStage == releaser.StageNew || resumeStage == releaser.StagePush {
+		if err := releaser.CheckRemote(caddyRepo, cfg.GitRemote); err != nil {
+			logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+		}
+	}
+	if pushDocker && cfg.DockerImage == "" {
+		logger.Exitf(exitPreflight, "Aborting deployment: -push-docker requires docker_image to be configured")
+	}
+	if keepAssets != "" {
+		if resumeStage == releaser.StageBuildServer {
+			logger.Exitf(exitPreflight, "Aborting deployment: -keep-assets cannot be used with -resume=buildserver, which builds nothing")
+		}
+		if err := os.MkdirAll(keepAssets, 0755); err != nil {
+			logger.Exitf(exitPreflight, "Aborting deployment: making directory to keep assets in: %v", err)
+		}
+	}
+	if skipRelease && releaseIDFlag != 0 {
+		logger.Exitf(exitPreflight, "Aborting deployment: -skip-release cannot be used with -release-id")
+	}
+	if skipRelease && !mirrorS3 {
+		logger.Exitf(exitPreflight, "Aborting deployment: -skip-release requires -mirror-s3, or the assets would go nowhere")
+	}
+	var s3Mirror *releaser.S3Mirror
+	if mirrorS3 {
+		s3Mirror, err = cfg.NewS3Mirror()
+		if err != nil {
+			logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+		}
+	}
+	// new deploys always sign the tag
+	if err := checkTools(resumeStage == releaser.StageNew || signAssets, pushDocker && resumeStage != releaser.StageBuildServer); err != nil {
+		logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+	}
+	if err := workingCopyClean(); err != nil {
+		logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+	}
+	provider, err := cfg.NewProvider(logger)
+	if err != nil {
+		logger.Exitf(exitPreflight, "%v", err)
+	}
+	if resumeStage != releaser.StageBuildServer && !skipRelease {
+		// find out now, not after the tag is pushed
+		if err := provider.CheckAccess(context.Background()); err != nil {
+			logger.Exitf(exitPreflight, "Aborting deployment: %s credentials can't be used to publish releases: %v", provider.Name(), err)
+		}
+	}
+	if resumeStage != releaser.StageBuildServer {
+		if err := cfg.CheckStagingDir(); err != nil {
+			logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+		}
+		need := releaser.DiskSpaceNeeded(cfg, platforms, pushDocker)
+		if err := releaser.CheckDiskSpace(logger, cfg.StagingDir(), need); err != nil {
+			logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+		}
 	}
 
-	wg.Wait()
+	var tag string
+	var prerelease bool
+	var milestone *releaser.Milestone
 
-	// deploy to Caddy build server if not a pre-release
-	if !prerelease {
-		log.Println("Deploying to build server")
+	// see if we're resuming a deploy; only do this if a
+	// tag was pushed but some step after the push failed.
+	if resumeStage != releaser.StageNew {
+		// resume a deploy
 
-		// prepare request body
-		type DeployRequest struct {
-			CaddyVersion string `json:"caddy_version"`
+		// the tag being resumed may well be a pre-release
+		if releaseIDFlag != 0 {
+			tag, err = releaseTag(provider, releaseIDFlag)
+		} else {
+			tag, err = releaser.GetCurrentTag(caddyRepo, cfg.TagPrefix, true)
 		}
-		bodyInfo := DeployRequest{CaddyVersion: tag}
-		body, err := json.Marshal(bodyInfo)
 		if err != nil {
-			return fmt.Errorf("preparing request body: %v", err)
+			logger.Exitf(exitPreflight, "%v", err)
+		}
+		prerelease = channel.IsPrerelease(tag)
+		logPrerelease(tag, prerelease)
+
+		switch resumeStage {
+		case releaser.StagePush:
+			logger.Printf("\nNOTE: The deploy for %s is being resumed.\n", tag)
+			logger.Println("The process will pick up at pushing the tag that was")
+			logger.Println("made locally, then do everything else.")
+			printPlatforms(platforms)
+		case releaser.StageRelease:
+			logger.Printf("\nNOTE: The deploy for %s is being resumed.\n", tag)
+			logger.Println("The process will pick up at creating the release.")
+			printPlatforms(platforms)
+		case releaser.StageUpload:
+			if releaseIDFlag != 0 {
+				logger.Printf("\nNOTE: The assets for %s will be built and uploaded to\n", tag)
+				logger.Printf("release %d, which was made elsewhere; assets it already\n", releaseIDFlag)
+				logger.Println("has will be skipped. Nothing will be tagged or pushed.")
+				printPlatforms(platforms)
+				break
+			}
+			logger.Printf("\nNOTE: The deploy for %s is being resumed.\n", tag)
+			logger.Println("The process will pick up at building and uploading to the")
+			logger.Println("existing release; assets it already has will be skipped.")
+			printPlatforms(platforms)
+		case releaser.StageBuildServer:
+			if !channel.DeploysToBuildServer(prerelease) {
+				logger.Exitf(exitPreflight, "Aborting resumed deployment: %s is a pre-release, which is not deployed to the build server in the %s channel", tag, channelFlag)
+			}
+			logger.Printf("\nNOTE: The deploy for %s is being resumed.\n", tag)
+			logger.Println("Only the deploy to the Caddy build server will be done.")
+		default:
+			logger.Exitf(exitPreflight, "Unknown resume state")
 		}
 
-		// prepare request
-		req, err := http.NewRequest("POST", websiteURL+"/api/deploy-caddy", bytes.NewReader(body))
+		if err := confirmBuildServerURL(prerelease); err != nil {
+			logger.Exitf(exitPreflight, "Aborting resumed deployment: %v", err)
+		}
+		confirmed, err := askYesNo("Continue?")
 		if err != nil {
-			return fmt.Errorf("preparing request: %v", err)
+			logger.Exitf(exitPreflight, "%v", err)
+		}
+		if !confirmed {
+			logger.Exitf(exitPreflight, "Aborting resumed deployment")
 		}
-		req.Header.Set("Content-Type", "application/json")
-		req.SetBasicAuth(devportalAccountID, devportalAPIKey)
+	} else {
+		// begin a new deploy
 
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return fmt.Errorf("network error deploying to website: %v", err)
+		if err := checkReleaseBranch(allowBranch); err != nil {
+			logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+		}
+		if commitFlag != "" {
+			commitFlag, err = checkReleaseCommit(commitFlag)
+			if err != nil {
+				logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+			}
+		}
+		if err := confirmRightCommit(showCommits); err != nil {
+			logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode >= 400 {
-			respBody, err := ioutil.ReadAll(resp.Body)
+		// get the tag for the new release
+		var milestones []milestoneTag
+		if cfg.MilestoneTags {
+			milestones, err = versionMilestones(provider)
 			if err != nil {
-				return fmt.Errorf("reading response body: %v", err)
+				logger.Warnf("Could not suggest tags from milestones: %v", err)
+			}
+		}
+		tag, prerelease, err = askNewTagVersion(milestones)
+		if err != nil {
+			logger.Exitf(exitPreflight, "%v", err)
+		}
+		if cfg.CloseMilestone {
+			milestone = milestoneFor(milestones, tag)
+			if milestone != nil {
+				logger.Printf("Milestone %q will be closed once %s is released\n", milestone.Title, tag)
 			}
-			return fmt.Errorf("deploy to build server failed, HTTP %d: %s", resp.StatusCode, respBody)
 		}
+		if !strings.HasPrefix(tag, cfg.TagPrefix) {
+			logger.Exitf(exitPreflight, "Aborting deployment: tag %s does not begin with the tag prefix %q", tag, cfg.TagPrefix)
+		}
+		logPrerelease(tag, prerelease)
 
-		log.Printf("Deploy request successfully sent to Caddy build server")
-	}
+		if err := confirmReadmeUpdated(tag); err != nil {
+			logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+		}
+		if err := confirmBuildServerURL(prerelease); err != nil {
+			logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+		}
 
-	return nil
-}
+		if confirmPlatformsFlag {
+			if err := confirmPlatforms(platforms); err != nil {
+				logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+			}
+		} else {
+			printPlatforms(platforms)
+		}
 
-func checkCaddy() error {
-	// get current commit
-	cmd := exec.Command("git", "rev-parse", "HEAD")
-	cmd.Dir = caddyRepo
-	out, err := cmd.Output()
-	if err != nil {
-		return err
-	}
-	currentCommit := strings.TrimSpace(string(out))
-	log.Printf("Caddy is currently at commit: %s", currentCommit)
+		if skipChecks {
+			if err := confirmSkipChecks(); err != nil {
+				logger.Exitf(exitPreflight, "Aborting deployment: %v", err)
+			}
+		}
 
-	// create build environment, with no plugins
-	log.Println("Opening build environment")
-	be, err := buildworker.Open(currentCommit, nil)
-	if err != nil {
-		return fmt.Errorf("opening build environment: %v", err)
+		// one more check
+		if skipChecks {
+			logger.Println("\nNOTICE: Checks will be skipped; the release will be")
+			logger.Println("tagged and built as soon as you continue.")
+		} else if isolatedChecks {
+			logger.Println("\nNOTICE: If you continue, tests will be run on a fresh")
+			logger.Println("clone of the commit in a temporary GOPATH, which is")
+			logger.Println("removed afterwards; your GOPATH will not be used.")
+			logger.Println("The release will continue only if the tests pass.")
+		} else if updateGopath {
+			logger.Println("\nNOTICE: If you continue, your GOPATH will be updated")
+			logger.Printf("by running `go get -u %s` \n", buildworker.CaddyPackage)
+			logger.Println("before checks are performed. Tests will follow, and")
+			logger.Println("the release will continue only if the tests pass.")
+		} else {
+			logger.Println("\nNOTICE: If you continue, tests will be run on your")
+			logger.Println("current GOPATH, which will not be updated, so results")
+			logger.Println("may differ from the build server's (see -update-gopath).")
+			logger.Println("The release will continue only if the tests pass.")
+		}
+		confirmed, err := askYesNo("I'm ready. Are you ready? There's no going back:")
+		if err != nil {
+			logger.Exitf(exitPreflight, "%v", err)
+		}
+		if !confirmed {
+			logger.Exitf(exitPreflight, "Aborting deployment: operator not ready 🙄")
+		}
 	}
-	defer be.Close()
 
-	// update master GOPATH to help ensure the tests
-	// here will get the same results as the build
-	// server which also updates its GOPATH each time
-	// a deploy is made; it's not bulletproof but it's
-	// good enough. if this update introduces some
-	// breaking change, the tests we're about to run
-	// will catch that -- however, we don't revert
-	// the update, as that would involve a massive
-	// overwrite of the whole GOPATH on some developer's
-	// machine, which makes me uncomfortable.
-	log.Println("Updating master GOPATH")
-	err = be.UpdateMasterGopath()
-	if err != nil {
-		return fmt.Errorf("updating master GOPATH: %v", err)
+	// here we goooo!
+	deployer := &releaser.Deployer{
+		Config:              cfg,
+		Channel:             channel,
+		Environment:         environment,
+		RepoDir:             caddyRepo,
+		OpenEnv:             releaser.OpenBuildworker,
+		Log:                 logger,
+		Provider:            provider,
+		Milestone:           milestone,
+		TagWait:             tagWait,
+		DeployTimeout:       deployTimeout,
+		SignAssets:          signAssets,
+		NoSigningPrompt:     !isTerminal(os.Stdin),
+		ReplaceExisting:     replaceExisting,
+		DeleteUnverifiedTag: deleteUnverifiedTag,
+		VerifyUploads:       verifyUploads,
+		VerifyDownloads:     verifyDownloads,
+		ReportProgress:      newProgressReporter(),
+		Commit:              commitFlag,
+		NoPush:              noPush,
+		PerAssetChecksums:   perAssetChecksums,
+		MaxFailures:         maxFailures,
+		BuildRetries:        maxBuildRetries,
+		UploadRetries:       maxUploadRetries,
+		RetryBackoff:        retryBackoff,
+		FailFast:            failFast,
+		Plugins:             plugins,
+		S3:                  s3Mirror,
+		SkipRelease:         skipRelease,
+		TagMessage:          tagMessage,
+		IncludeSource:       includeSource.or(channel.Name == "stable" && !prerelease),
+		IncludePrereleases:  considerPrereleases(),
+		UpdateGopath:        updateGopath,
+		IsolatedChecks:      isolatedChecks,
+		SkipChecks:          skipChecks,
+		VerboseChecks:       verboseChecks,
+		ChecksCache:         checksCachePath(),
+		StateFile:           stateFilePath(),
+		ReleaseID:           releaseIDFlag,
+		KeepAssets:          keepAssets,
+		ForceChecks:         forceChecks,
+		AssetNames:          assetNameTemplate,
+		LDFlags:             ldflagsTemplate,
+		HomebrewFormula:     homebrewFormula,
+		ReleaseBody:         releaseBody,
+		PushDocker:          pushDocker,
 	}
-
-	// run checks and report results
-	log.Println("Running tests and cross-platform build checks on Caddy (this may take a while)")
-	err = be.RunCaddyChecks()
-	if err != nil {
-		log.Printf("error; here's the log:\n>>>>>>>>>>>>%s\n<<<<<<<<<<<<\n", be.Log.String())
+	result, err := deployer.Deploy(cancelOnInterrupt(), tag, prerelease, platforms, resumeStage)
+	if len(result.BuildDurations) > 0 {
+		printMetrics(result)
+		recordBuildTimes(result)
 	}
-	return err
-}
-
-// publishReleaseToGitHub makes a new release on GitHub
-// and returns the client, the release, and an error if any.
-func publishReleaseToGitHub(tag string, prerelease bool) (*github.Client, *github.RepositoryRelease, error) {
-	tc := oauth2.NewClient(oauth2.NoContext, oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: githubAccessToken},
-	))
-	client := github.NewClient(tc)
-	release, _, err := client.Repositories.CreateRelease(context.Background(), githubOwner, githubRepo,
-		&github.RepositoryRelease{
-			TagName:    github.String(tag),
-			Name:       github.String(strings.TrimPrefix(tag, "v")),
-			Prerelease: github.Bool(prerelease),
-		})
-	return client, release, err
-}
-
-// envVariablesSet asserts that required environment variables
-// are set. Returns an error if a value is missing.
-func envVariablesSet() error {
-	if githubAccessToken == "" {
-		return fmt.Errorf("environment variable GITHUB_TOKEN cannot be empty")
+	if err == nil {
+		printOutcome("Released", result)
+	} else {
+		printOutcome("Uploaded", result)
 	}
-	if devportalAccountID == "" {
-		return fmt.Errorf("environment variable DEVPORTAL_ID cannot be empty")
+	printUploadSize(result)
+	if summaryFile != "" {
+		if err := writeSummary(summaryFile, result, err); err != nil {
+			logger.Warnf("Writing summary: %v", err)
+		} else {
+			logger.Infof("Wrote release summary to %s", summaryFile)
+		}
 	}
-	if devportalAPIKey == "" {
-		return fmt.Errorf("environment variable DEVPORTAL_KEY cannot be empty")
+	if cfg.WebhookURL != "" {
+		notifyWebhook(cfg.WebhookURL, result, err)
 	}
-	if os.Getenv("GOPATH") == "" {
-		return fmt.Errorf("environment variable GOPATH cannot be empty")
+	if errors.Is(err, releaser.ErrInterrupted) {
+		printInterrupted(result, len(platforms))
+		os.Exit(exitInterrupted)
 	}
-	return nil
+	if err != nil {
+		ringBell()
+		logger.Exitf(exitStatus(err), "%v", err)
+	}
+
+	if noPush {
+		printNoPush(tag)
+		return
+	}
+
+	logger.Infof("Done.")
+	if len(result.FailedPlatforms) > 0 {
+		logger.Warnf("%s was released without the platforms that failed", tag)
+	}
+	logger.Infof("%s release successful.", tag)
+	printDownloads(result)
 }
 
 // workingCopyClean asserts that the caddy repository has
@@ -408,7 +1018,7 @@ func envVariablesSet() error {
 // "unclean" version information; deploys should be done
 // exactly on tags and without modifications.
 func workingCopyClean() error {
-	cmd := exec.Command("git", "status", "--untracked-files=no", "--porcelain")
+	cmd := releaser.Command("git", "status", "--untracked-files=no", "--porcelain")
 	cmd.Dir = caddyRepo
 	out, err := cmd.Output()
 	if err != nil {
@@ -420,18 +1030,104 @@ func workingCopyClean() error {
 	return nil
 }
 
+// checkReleaseBranch asserts that the caddy repository is
+// checked out on the release branch, unless allowOtherBranch
+// is true, in which case only a warning is shown. It also
+// warns if the branch is behind its remote tracking branch.
+func checkReleaseBranch(allowOtherBranch bool) error {
+	cmd := releaser.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
+	cmd.Dir = caddyRepo
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("getting current branch: %w", err)
+	}
+	branch := strings.TrimSpace(string(out))
+
+	allowed := []string{"master", "main"}
+	if cfg.ReleaseBranch != "" {
+		allowed = []string{cfg.ReleaseBranch}
+	}
+	var onReleaseBranch bool
+	for _, b := range allowed {
+		if branch == b {
+			onReleaseBranch = true
+			break
+		}
+	}
+	if !onReleaseBranch {
+		if !allowOtherBranch {
+			return fmt.Errorf("HEAD is on %s, not the release branch (%s); use -allow-branch to release anyway",
+				branch, strings.Join(allowed, " or "))
+		}
+		logger.Warnf("Releasing from %s, which is not the release branch (%s)",
+			branch, strings.Join(allowed, " or "))
+	}
+
+	// releasing stale code is an easy mistake to make
+	err = run("git", "fetch", "--quiet")
+	if err != nil {
+		logger.Warnf("Could not fetch from remote; unable to tell if %s is up to date: %v", branch, err)
+		return nil
+	}
+	cmd = releaser.Command("git", "rev-list", "--count", "HEAD..@{upstream}")
+	cmd.Dir = caddyRepo
+	out, err = cmd.Output()
+	if err != nil {
+		logger.Warnf("Could not compare %s to its remote tracking branch: %v", branch, err)
+		return nil
+	}
+	if behind := strings.TrimSpace(string(out)); behind != "0" {
+		logger.Warnf("%s is %s commit(s) behind its remote tracking branch; you may be releasing stale code", branch, behind)
+	}
+
+	return nil
+}
+
+// confirmSkipChecks warns the operator that the checks
+// will be skipped, and asks them to confirm that that's
+// what they want. Returns an error if it isn't.
+func confirmSkipChecks() error {
+	logger.Printf("\n!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n")
+	logger.Printf("!! WARNING: -skip-checks was given, so the tests and build\n")
+	logger.Printf("!! checks will NOT be run. If this commit is broken, it will\n")
+	logger.Printf("!! be tagged and released to everyone anyway. Only do this if\n")
+	logger.Printf("!! you have verified this exact commit some other way.\n")
+	logger.Printf("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n\n")
+
+	confirmed, err := askYesNo("Release without running any checks?")
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return fmt.Errorf("deploy cancelled by user")
+	}
+	return nil
+}
+
 // confirmRightCommit asks the operator to confirm that the
 // current commit is the right one at which to tag and deploy.
-// Returns an error if it isn't.
-func confirmRightCommit() error {
-	fmt.Printf("Caddy will be deployed at the current commit:\n\n")
+// If showCommits is true, every commit since the previous
+// release is listed first, so the operator can see all that
+// will ship. Returns an error if it isn't the right commit.
+func confirmRightCommit(showCommits bool) error {
+	if showCommits {
+		if err := pageCommitsSincePreviousTag(); err != nil {
+			return fmt.Errorf("listing commits since previous release: %w", err)
+		}
+	}
 
-	cmd := exec.Command("git", "show", "--summary")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	args := []string{"show", "--summary"}
+	if commitFlag != "" {
+		logger.Printf("Caddy will be deployed at commit %s, not the current commit:\n\n", commitFlag)
+		args = append(args, commitFlag)
+	} else {
+		logger.Printf("Caddy will be deployed at the current commit:\n\n")
+	}
+
+	cmd := releaser.Command("git", args...)
 	cmd.Dir = caddyRepo
-	cmd.Run()
-	fmt.Printf("\n")
+	releaser.RunRedacted(cmd)
+	logger.Printf("\n")
 
 	confirmed, err := askYesNo("Is this the right commit to release?")
 	if err != nil {
@@ -444,10 +1140,76 @@ func confirmRightCommit() error {
 	return nil
 }
 
-// confirmReadmeUpdated asks if the readme has been updated.
-// Returns an error if it hasn't.
-func confirmReadmeUpdated() error {
-	confirmed, err := askYesNo("Have README.txt and CHANGES.txt been updated for the new version?")
+// confirmReadmeUpdated checks that README.txt and CHANGES.txt
+// mention the version being released. If either doesn't, the
+// operator must explicitly choose to release anyway, which
+// -yes does not do for them. Returns an error if the files
+// could not be checked or the operator declines.
+func confirmReadmeUpdated(tag string) error {
+	version := releaser.TagVersion(tag, cfg.TagPrefix)
+	versionRegexp, err := regexp.Compile(`(^|[^0-9A-Za-z.])v?` + regexp.QuoteMeta(version) + `($|[^0-9A-Za-z.]|\.($|[^0-9]))`)
+	if err != nil {
+		return err
+	}
+
+	var outdated []string
+	for _, name := range []string{"README.txt", "CHANGES.txt"} {
+		contents, err := readReleaseFile(name)
+		if err != nil {
+			return fmt.Errorf("checking %s for new version: %w", name, err)
+		}
+		if !versionRegexp.Match(contents) {
+			outdated = append(outdated, name)
+		}
+	}
+	if len(outdated) == 0 {
+		logger.Printf("README.txt and CHANGES.txt both mention %s\n", version)
+		return nil
+	}
+
+	logger.Printf("\n!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n")
+	logger.Printf("!! WARNING: %s does not mention version %s\n", strings.Join(outdated, " and "), version)
+	logger.Printf("!! These files should be updated before releasing.\n")
+	logger.Printf("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n\n")
+
+	if assumeYes {
+		return fmt.Errorf("%s not updated for %s (not overridden by -yes)", strings.Join(outdated, " and "), version)
+	}
+	confirmed, err := askYesNo("Release anyway, without the new version in " + strings.Join(outdated, " and ") + "?")
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return fmt.Errorf("deploy cancelled by user")
+	}
+	return nil
+}
+
+// confirmBuildServerURL warns if a release, which is not a
+// pre-release, would be deployed to a build server on this
+// machine: the deploy would seem to succeed while the real
+// build server never hears of it. The operator must confirm
+// that this is intended; -yes does not confirm it.
+func confirmBuildServerURL(prerelease bool) error {
+	if prerelease || cfg.NoBuildServer {
+		return nil
+	}
+	deployURL, err := environment.DeployURL(channel)
+	if err != nil || !releaser.IsLoopbackURL(deployURL) {
+		return nil
+	}
+
+	logger.Printf("\n!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n")
+	logger.Printf("!! WARNING: the build server deploy will be sent to\n")
+	logger.Printf("!! %s, which is this machine.\n", deployURL)
+	logger.Printf("!! The real build server will not hear about the release.\n")
+	logger.Printf("!! Check website_url in the %s channel and environment.\n", channel.Name)
+	logger.Printf("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n\n")
+
+	if assumeYes {
+		return fmt.Errorf("build server URL %s is on this machine (not overridden by -yes)", deployURL)
+	}
+	confirmed, err := askYesNo("Deploy to the build server on this machine anyway?")
 	if err != nil {
 		return err
 	}
@@ -457,139 +1219,350 @@ func confirmReadmeUpdated() error {
 	return nil
 }
 
-// getCurrentTag returns the current tag of the Caddy repo.
-// If there is no current tag, a "dummy" tag of "v0.0.0" will
-// be returned for consistency with semantic versioning.
-func getCurrentTag() (string, error) {
-	cmd := exec.Command("git", "tag")
+// pageCommitsSincePreviousTag shows the one-line summary of
+// every commit in the caddy repo since the previous release,
+// through a pager if stdout is a terminal.
+func pageCommitsSincePreviousTag() error {
+	since, err := releaser.PreviousTag(caddyRepo, cfg.TagPrefix, considerPrereleases())
+	if err != nil {
+		return err
+	}
+	args := []string{"log", "--oneline", "--no-decorate"}
+	if since != "" {
+		args = append(args, since+".."+releaseRev())
+	} else {
+		args = append(args, releaseRev())
+	}
+	cmd := releaser.Command("git", args...)
 	cmd.Dir = caddyRepo
 	out, err := cmd.Output()
 	if err != nil {
-		return "", err
+		return err
+	}
+	count := strings.Count(string(out), "\n")
+	if since == "" {
+		return page(fmt.Sprintf("There are no tags yet; all %d commits will be in the initial release:\n\n%s", count, out))
 	}
+	return page(fmt.Sprintf("%d commits since %s will be released:\n\n%s", count, since, out))
+}
 
-	allTags := strings.Split(strings.TrimSpace(string(out)), "\n")
-	if len(allTags) == 0 || (len(allTags) == 1 && allTags[0] == "") {
-		allTags = []string{"v0.0.0"} // alright--starting from nothing, are we?
+// page shows text through $PAGER (default less), so long
+// output can be read before answering a question. If stdout
+// is not a terminal, or the pager can't be run, the text
+// is just printed.
+func page(text string) error {
+	if !isTerminal(os.Stdout) {
+		logger.Println(text)
+		return nil
+	}
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		pager = []string{"less"}
 	}
+	cmd := releaser.Command(pager[0], pager[1:]...)
+	cmd.Stdin = strings.NewReader(releaser.Redact(text))
+	cmd.Stdout = os.Stdout // the pager needs the terminal; its input is redacted
+	if os.Getenv("LESS") == "" {
+		// quit if it fits on one screen, and leave
+		// the text on the screen after quitting
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+	if err := releaser.RunRedacted(cmd); err != nil {
+		logger.Debugf("Running pager %s: %v", pager[0], err)
+		logger.Println(text)
+	}
+	return nil
+}
+
+// considerPrereleases returns true if pre-release tags count
+// when finding the current tag: if -include-prereleases says
+// so, or else if the channel marks every release as a
+// pre-release. Stable releases are based on stable releases.
+func considerPrereleases() bool {
+	return includePrereleases.or(channel.Prerelease != nil && *channel.Prerelease)
+}
 
-	// sort by comparing each version label successively; string
-	// sort won't do the trick because 10 < 9 sorting by strings.
-	sort.Slice(allTags, func(i int, j int) bool {
-		tagI := strings.TrimLeft("v", allTags[i])
-		tagJ := strings.TrimLeft("v", allTags[j])
-		partsI := strings.Split(tagI, ".")
-		partsJ := strings.Split(tagJ, ".")
-		for len(partsI) < 3 {
-			partsI = append(partsI, "0")
+// printChangelog prints the changes in the caddy repo since
+// the tag since, or since the current tag if since is empty.
+// If there is no current tag, there is nothing to compare
+// with, so it only says the next release is the first one.
+func printChangelog(since string) error {
+	if since == "" {
+		var err error
+		since, err = releaser.PreviousTag(caddyRepo, cfg.TagPrefix, considerPrereleases())
+		if err != nil {
+			return err
 		}
-		for len(partsJ) < 3 {
-			partsJ = append(partsJ, "0")
+		if since == "" {
+			logger.Println("There are no tags yet, so the next release is the initial release; it has no changelog.")
+			return nil
 		}
-		for k := 0; k < 3; k++ {
-			if partsI[k] == partsJ[k] {
-				continue
-			}
-			numI, err := strconv.Atoi(partsI[k])
-			if err != nil {
-				return false
-			}
-			numJ, err := strconv.Atoi(partsI[j])
-			if err != nil {
-				return false
-			}
-			return numI < numJ
-		}
-		return false
-	})
+	}
 
-	// return the first tag, which is the "highest" (most recent) version
-	return allTags[0], nil
+	changelog, err := releaser.Changelog(caddyRepo, since, commitFlag)
+	if err != nil {
+		return err
+	}
+	if len(changelog) == 0 {
+		logger.Printf("No changes since %s\n", since)
+		return nil
+	}
+	logger.Printf("Changes since %s:\n\n%s", since, releaser.FormatChangelog(changelog))
+	return nil
 }
 
-// isPrerelease returns true if tag looks like a pre-release version.
-func isPrerelease(tag string) bool {
-	return strings.Contains(tag, "-alpha") ||
-		strings.Contains(tag, "-beta") ||
-		strings.Contains(tag, "-pre") ||
-		strings.Contains(tag, "-rc")
+// printTags prints the tags of the releases of Caddy,
+// from the highest version to the lowest, as sorted to
+// find the current tag, marking which are pre-releases
+// and which is the latest stable release.
+func printTags() error {
+	tags, err := releaser.ListTags(caddyRepo, cfg.TagPrefix)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		logger.Println("There are no tags yet.")
+		return nil
+	}
+	width := 0
+	for _, tag := range tags {
+		if len(tag.Name) > width {
+			width = len(tag.Name)
+		}
+	}
+	latestStable := true
+	for i := len(tags) - 1; i >= 0; i-- {
+		note := ""
+		if tags[i].Prerelease {
+			note = "pre-release"
+		} else if latestStable {
+			note = "latest stable"
+			latestStable = false
+		}
+		logger.Println(strings.TrimRight(fmt.Sprintf("%-*s  %s", width, tags[i].Name, note), " "))
+	}
+	return nil
 }
 
-// nextTagSuggestions returns a list of suggested tags based on the
-// most recent tag, which must be passed in as currentTagRaw.
-func nextTagSuggestions(currentTagRaw string) ([]string, error) {
-	currentTag := strings.TrimLeft(currentTagRaw, "v")
-	tagParts := strings.Split(currentTag, ".")
-	for len(tagParts) < 3 {
-		tagParts = append(tagParts, "0")
+// askNewTagVersion asks for the name of the tag for
+// this release, suggesting the tags of milestones. It
+// returns the tag name, whether this is a pre-release
+// tag, and/or an error. If the tag was given with -tag,
+// or with -bump and -yes, it is not asked for; otherwise,
+// without a terminal, it returns errNotInteractive.
+func askNewTagVersion(milestones []milestoneTag) (string, bool, error) {
+	if tagFlag != "" {
+		logger.Printf("New tag will be %s (from -tag)\n", tagFlag)
+		return tagFlag, channel.IsPrerelease(tagFlag), nil
 	}
-
-	// viable tags come from incrementing each part
-	// of the semantic version number, and setting
-	// subsequent parts to 0.
-	var nextVers []string
-	for i := len(tagParts) - 1; i >= 0; i-- {
-		num, err := strconv.Atoi(tagParts[i])
+	var bumped string
+	if bumpFlag != "" {
+		var err error
+		bumped, err = bumpedTag()
 		if err != nil {
-			continue
-		}
-		nextVer := make([]string, len(tagParts))
-		copy(nextVer, tagParts)
-		nextVer[i] = strconv.Itoa(num + 1)
-		for j := i + 1; j < len(nextVer); j++ {
-			nextVer[j] = "0"
-		}
-		if len(nextVer) == 3 && nextVer[2] == "0" {
-			nextVer = nextVer[:2] // drop trailing ".0" in third part ("v0.10" instead of "v0.10.0")
+			return "", false, err
 		}
-		next := strings.Join(nextVer, ".")
-		if strings.HasPrefix(currentTagRaw, "v") {
-			next = "v" + next
+		if assumeYes {
+			logger.Printf("New tag will be %s (from -bump=%s)\n", bumped, bumpFlag)
+			return bumped, channel.IsPrerelease(bumped), nil
 		}
-		nextVers = append(nextVers, next)
+	}
+	if err := requireTerminal(); err != nil {
+		return "", false, err
 	}
 
-	return nextVers, nil
-}
-
-// askNewTagVersion asks for the name of the tag for
-// this release. It returns the tag name, whether
-// this is a pre-release tag, and/or an error.
-func askNewTagVersion() (string, bool, error) {
-	currentTagRaw, err := getCurrentTag()
+	currentTagRaw, err := releaser.GetCurrentTag(caddyRepo, cfg.TagPrefix, considerPrereleases())
 	if err != nil {
 		return "", false, err
 	}
-
-	nextVers, err := nextTagSuggestions(currentTagRaw)
+	previous, err := releaser.PreviousTag(caddyRepo, cfg.TagPrefix, considerPrereleases())
 	if err != nil {
 		return "", false, err
 	}
 
+	// with no tags, there is nothing to increment;
+	// currentTagRaw is only a placeholder
+	var nextVers []string
+	message := "Current tag is " + currentTagRaw + ". What should the new tag be?"
+	if previous == "" {
+		nextVers = releaser.FirstTagSuggestions(cfg.TagPrefix, !fullTagSuggestions)
+		message = "There are no tags yet, so this is the initial release. What should its tag be?"
+	} else {
+		nextVers, err = releaser.NextTagSuggestions(currentTagRaw, cfg.TagPrefix, !fullTagSuggestions)
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	// the version at the top of CHANGES.txt is likely the one
+	// being released, so suggest it first, labeled as such
+	choices := nextVers
+	fromChanges := ""
+	changesTag, err := releaser.ChangesTag(caddyRepo, commitFlag, currentTagRaw, cfg.TagPrefix)
+	if err != nil {
+		logger.Warnf("Could not read version from CHANGES.txt: %v", err)
+	} else if changesTag != "" {
+		exists, err := releaser.TagExists(caddyRepo, changesTag)
+		if err != nil {
+			return "", false, err
+		}
+		if exists {
+			logger.Warnf("The top version in CHANGES.txt, %s, is already tagged; has CHANGES.txt been updated?", changesTag)
+		} else {
+			fromChanges = changesTag + " (from CHANGES.txt)"
+			choices = append([]string{fromChanges}, removeString(nextVers, changesTag)...)
+		}
+	}
+
+	// the open milestones are what was planned, so they
+	// go right below the one from CHANGES.txt
+	fromMilestones := make(map[string]string)
+	var milestoneChoices []string
+	for _, m := range milestones {
+		if fromChanges != "" && m.tag == changesTag {
+			continue
+		}
+		choice := fmt.Sprintf("%s (milestone %q)", m.tag, m.milestone.Title)
+		fromMilestones[choice] = m.tag
+		milestoneChoices = append(milestoneChoices, choice)
+		choices = removeString(choices, m.tag)
+	}
+	if fromChanges != "" {
+		choices = append(append([]string{fromChanges}, milestoneChoices...), choices[1:]...)
+	} else {
+		choices = append(milestoneChoices, choices...)
+	}
+
+	// the bumped tag is what was asked for, so it goes
+	// above even the one from CHANGES.txt
+	fromBump := ""
+	if bumped != "" {
+		fromBump = bumped + " (from -bump=" + bumpFlag + ")"
+		choices = append([]string{fromBump}, removeString(choices, bumped)...)
+	}
+
 	const other = "Other..."
 	tag, err := survey.AskOneValidate(&survey.Choice{
-		Message: "Current tag is " + currentTagRaw + ". What should the new tag be?",
-		Choices: append(nextVers, other),
+		Message: message,
+		Choices: append(choices, other),
 	}, survey.Required)
 	if err != nil {
 		return "", false, err
 	}
 
-	if tag == other {
+	if tag == fromBump {
+		tag = bumped
+	} else if tag == fromChanges {
+		tag = changesTag
+	} else if fromMilestone, ok := fromMilestones[tag]; ok {
+		tag = fromMilestone
+	} else if tag == other {
 		tag, err = survey.AskOneValidate(&survey.Input{
 			Message: "Type a name for the new tag:",
-		}, survey.Required)
+		}, func(input string) error {
+			_, err := releaser.NormalizeTag(input, currentTagRaw, cfg.TagPrefix, !fullTagSuggestions)
+			return err
+		})
+		if err != nil {
+			return "", false, err
+		}
+		normalized, err := releaser.NormalizeTag(tag, currentTagRaw, cfg.TagPrefix, !fullTagSuggestions)
 		if err != nil {
 			return "", false, err
 		}
+		if normalized != tag {
+			logger.Printf("New tag will be %s\n", normalized)
+		}
+		tag = normalized
 	}
 
-	return tag, isPrerelease(tag), nil
+	return tag, channel.IsPrerelease(tag), nil
+}
+
+// bumpedTag returns the tag after the previous release's with
+// the part of its version given by -bump incremented; with
+// -bump=auto, the part is chosen by the conventional commits
+// since the previous release, as parsed for the changelog.
+func bumpedTag() (string, error) {
+	previous, err := releaser.PreviousTag(caddyRepo, cfg.TagPrefix, considerPrereleases())
+	if err != nil {
+		return "", err
+	}
+	if previous == "" {
+		return "", fmt.Errorf("there are no tags yet, so there is no version for -bump to increment; pass -tag")
+	}
+
+	var bump releaser.Bump
+	switch bumpFlag {
+	case "patch":
+		bump = releaser.BumpPatch
+	case "minor":
+		bump = releaser.BumpMinor
+	case "major":
+		bump = releaser.BumpMajor
+	case "auto":
+		changelog, err := releaser.Changelog(caddyRepo, previous, commitFlag)
+		if err != nil {
+			return "", err
+		}
+		bump = releaser.ConventionalBump(changelog)
+		logger.Printf("The commits since %s call for a %s release\n", previous, bump)
+	}
+	return releaser.BumpTag(previous, cfg.TagPrefix, bump, !fullTagSuggestions)
+}
+
+// removeString returns list without any elements equal to s.
+func removeString(list []string, s string) []string {
+	var kept []string
+	for _, item := range list {
+		if item != s {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// logPrerelease logs whether the release of tag is a
+// pre-release, and what decided it, so it's on record.
+func logPrerelease(tag string, prerelease bool) {
+	kind := "a full release"
+	if prerelease {
+		kind = "a pre-release"
+	}
+	why := "inferred from the tag"
+	if forcePrerelease || forceNoPrerelease {
+		why = "forced by flag"
+	} else if channel.Prerelease != nil {
+		why = "set by the " + channel.Name + " channel"
+	}
+	logger.Infof("%s will be published as %s (%s)", tag, kind, why)
+}
+
+// errNotInteractive is returned instead of asking a
+// question when there is no terminal to answer it.
+var errNotInteractive = errors.New("interactive input required, but stdin is not a terminal; pass -yes and -tag or -bump")
+
+// requireTerminal returns errNotInteractive if stdin is
+// not a terminal, so questions can't be answered.
+func requireTerminal() error {
+	if !isTerminal(os.Stdin) {
+		return errNotInteractive
+	}
+	return nil
 }
 
 // askYesNo asks a No/Yes question and returns true
-// if Yes, false if No.
+// if Yes, false if No. If -yes was given, the question
+// is answered Yes without asking. Without a terminal,
+// it returns errNotInteractive rather than asking.
 func askYesNo(question string) (bool, error) {
+	if assumeYes {
+		logger.Printf("%s Yes (-yes)\n", question)
+		return true, nil
+	}
+	if err := requireTerminal(); err != nil {
+		return false, err
+	}
 	yn, err := survey.AskOneValidate(&survey.Choice{
 		Message: question,
 		Choices: []string{"No", "Yes"},
@@ -601,12 +1574,153 @@ func askYesNo(question string) (bool, error) {
 }
 
 // run runs command with the given args in the caddy repo.
-// It directs stdout and stderr through to the user.
-// It does not capture the output.
+// It directs stdout and stderr through to the user, with
+// secrets redacted. It does not capture the output.
 func run(command string, args ...string) error {
-	cmd := exec.Command(command, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd := releaser.Command(command, args...)
+	cmd.Dir = caddyRepo
+	return releaser.RunRedacted(cmd)
+}
+
+// optionalBool is a boolean flag whose default
+// depends on other settings.
+type optionalBool struct {
+	set, value bool
+}
+
+func (b *optionalBool) String() string {
+	if b == nil || !b.set {
+		return ""
+	}
+	return strconv.FormatBool(b.value)
+}
+
+func (b *optionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	b.set, b.value = true, v
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (b *optionalBool) IsBoolFlag() bool { return true }
+
+// or returns the value of the flag if it was
+// set, otherwise def.
+func (b optionalBool) or(def bool) bool {
+	if b.set {
+		return b.value
+	}
+	return def
+}
+
+// printNoPush prints how to push tag, which a deploy
+// with -no-push made locally, and finish the release.
+func printNoPush(tag string) {
+	logger.Printf("\nTag %s was made locally, but not pushed.\n", tag)
+	logger.Println("Once it has been reviewed, finish the release with:")
+	logger.Println("\n    release-caddy -resume=push")
+	logger.Println("\nwhich runs these commands in the Caddy repo, then carries on:")
+	logger.Printf("\n    git -C %s push\n", caddyRepo)
+	logger.Printf("    git -C %s push --tags\n", caddyRepo)
+	logger.Println("\nIf you push them yourself instead, finish with -resume=release.")
+	logger.Printf("To abandon the release, delete the tag: git -C %s tag -d %s\n", caddyRepo, tag)
+}
+
+// checksCachePath returns the path of the file that records
+// the last commit whose checks passed, or "" if -cache-checks
+// is not set or there is nowhere to put it.
+func checksCachePath() string {
+	if !cacheChecks {
+		return ""
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		logger.Warnf("Not caching checks: %v", err)
+		return ""
+	}
+	return filepath.Join(dir, "release-caddy", "checks.json")
+}
+
+// stateFilePath returns the path of the file that records
+// the release made by the last deploy, or "" if there is
+// nowhere to put it.
+func stateFilePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		logger.Warnf("Not recording the release for resuming: %v", err)
+		return ""
+	}
+	return filepath.Join(dir, "release-caddy", "state.json")
+}
+
+// releaseRev returns the revision being released:
+// the commit given with -commit, or HEAD.
+func releaseRev() string {
+	if commitFlag != "" {
+		return commitFlag
+	}
+	return "HEAD"
+}
+
+// checkReleaseCommit returns the full SHA of commit, which
+// must be on the current branch (that is, HEAD or one of its
+// ancestors), so that an old commit is released only from the
+// branch it was reviewed on.
+func checkReleaseCommit(commit string) (string, error) {
+	cmd := releaser.Command("git", "rev-parse", "--verify", "--quiet", commit+"^{commit}")
+	cmd.Dir = caddyRepo
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s is not a commit in the Caddy repo", commit)
+	}
+	sha := strings.TrimSpace(string(out))
+
+	cmd = releaser.Command("git", "merge-base", "--is-ancestor", sha, "HEAD")
+	cmd.Dir = caddyRepo
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("commit %s is not on the current branch", commit)
+	}
+	return sha, nil
+}
+
+// releaseTag returns the tag of the release with the given
+// ID, made elsewhere, which must also be in the Caddy repo,
+// since the assets are built from it.
+func releaseTag(provider releaser.Provider, id int64) (string, error) {
+	release, err := provider.GetRelease(context.Background(), id)
+	if errors.Is(err, releaser.ErrNotSupported) {
+		return "", fmt.Errorf("%s releases have no IDs; use -resume=upload to upload to the release for the latest tag", provider.Name())
+	}
+	if err != nil {
+		return "", fmt.Errorf("getting release %d: %v", id, err)
+	}
+	if release == nil {
+		return "", fmt.Errorf("release %d does not exist on %s", id, provider.Name())
+	}
+	if !strings.HasPrefix(release.Tag, cfg.TagPrefix) {
+		return "", fmt.Errorf("release %d is for %s, which does not begin with the tag prefix %q", id, release.Tag, cfg.TagPrefix)
+	}
+	exists, err := releaser.TagExists(caddyRepo, release.Tag)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("release %d is for %s, which is not in the Caddy repo; fetch the tags first", id, release.Tag)
+	}
+	return release.Tag, nil
+}
+
+// readReleaseFile returns the contents of the file with
+// the given name in the Caddy repo, as of the commit
+// being released.
+func readReleaseFile(name string) ([]byte, error) {
+	if commitFlag == "" {
+		return ioutil.ReadFile(filepath.Join(caddyRepo, name))
+	}
+	cmd := releaser.Command("git", "show", commitFlag+":"+name)
 	cmd.Dir = caddyRepo
-	return cmd.Run()
+	return cmd.Output()
 }
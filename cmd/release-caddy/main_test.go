@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// runMainEnv is set in the environment of a test binary
+// that should run main instead of the tests.
+const runMainEnv = "RELEASE_CADDY_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runReleaseCaddy runs release-caddy with args, with
+// gopath as its GOPATH, and returns its output.
+func runReleaseCaddy(t *testing.T, gopath string, args ...string) string {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1", "GOPATH="+gopath, "TMPDIR="+t.TempDir())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("release-caddy %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// newTestGopath returns a GOPATH whose Caddy repo has a
+// stable release, then a pre-release, then a commit that
+// isn't released yet.
+func newTestGopath(t *testing.T) string {
+	gopath := t.TempDir()
+	repoDir := filepath.Join(gopath, "src", buildworker.CaddyPackage)
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoDir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "feat: first release")
+	git("tag", "v1.1.0")
+	git("commit", "-q", "--allow-empty", "-m", "feat: in the release candidate")
+	git("tag", "v1.2.0-rc.1")
+	git("commit", "-q", "--allow-empty", "-m", "fix: after the release candidate")
+	return gopath
+}
+
+func TestChangelogFollowsChannel(t *testing.T) {
+	gopath := newTestGopath(t)
+
+	// the stable channel is based on the last stable release
+	out := runReleaseCaddy(t, gopath, "-changelog")
+	if !strings.Contains(out, "Changes since v1.1.0") {
+		t.Errorf("stable changelog isn't since v1.1.0:\n%s", out)
+	}
+	if !strings.Contains(out, "in the release candidate") {
+		t.Errorf("stable changelog is missing the release candidate's change:\n%s", out)
+	}
+
+	// the edge channel releases pre-releases, so it is
+	// based on the release candidate
+	out = runReleaseCaddy(t, gopath, "-changelog", "-channel=edge")
+	if !strings.Contains(out, "Changes since v1.2.0-rc.1") {
+		t.Errorf("edge changelog isn't since v1.2.0-rc.1:\n%s", out)
+	}
+	if strings.Contains(out, "in the release candidate") {
+		t.Errorf("edge changelog has the release candidate's change:\n%s", out)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/caddyserver/releaser/internal/releaser"
+)
+
+// milestoneTag is an open milestone titled with a
+// version, and the tag for that version.
+type milestoneTag struct {
+	tag       string
+	milestone releaser.Milestone
+}
+
+// versionMilestones returns the open milestones on provider
+// whose titles are versions, with their tags as NormalizeTag
+// makes them, in the order the provider lists them. Those
+// whose tags already exist are left out with a warning.
+func versionMilestones(provider releaser.Provider) ([]milestoneTag, error) {
+	currentTagRaw, err := releaser.GetCurrentTag(caddyRepo, cfg.TagPrefix, considerPrereleases())
+	if err != nil {
+		return nil, err
+	}
+	milestones, err := provider.OpenMilestones(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("listing open milestones on %s: %w", provider.Name(), err)
+	}
+	var found []milestoneTag
+	for _, m := range milestones {
+		tag, err := releaser.NormalizeTag(m.Title, currentTagRaw, cfg.TagPrefix, !fullTagSuggestions)
+		if err != nil {
+			continue // not a version
+		}
+		exists, err := releaser.TagExists(caddyRepo, tag)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			logger.Warnf("Milestone %q is still open, but %s is already tagged", m.Title, tag)
+			continue
+		}
+		found = append(found, milestoneTag{tag: tag, milestone: m})
+	}
+	return found, nil
+}
+
+// milestoneFor returns the milestone among milestones
+// for tag, or nil if there is none.
+func milestoneFor(milestones []milestoneTag, tag string) *releaser.Milestone {
+	for _, m := range milestones {
+		if m.tag == tag {
+			return &m.milestone
+		}
+	}
+	return nil
+}
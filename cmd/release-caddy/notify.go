@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/releaser/internal/releaser"
+)
+
+// webhookPayload is the body POSTed to the webhook URL
+// when a deploy finishes. The Text field makes it usable
+// directly with Slack's incoming webhooks.
+type webhookPayload struct {
+	Text           string `json:"text"`
+	Tag            string `json:"tag"`
+	Prerelease     bool   `json:"prerelease"`
+	Success        bool   `json:"success"`
+	AssetsUploaded int    `json:"assets_uploaded"`
+	ReleaseURL     string `json:"release_url,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// notifyWebhook POSTs the outcome of a deploy to url. The
+// deploy failed if deployErr is not nil. Notifications are
+// best-effort: failures are logged but otherwise ignored,
+// so they never change the outcome of the deploy.
+func notifyWebhook(url string, result *releaser.Result, deployErr error) {
+	payload := webhookPayload{
+		Tag:            result.Tag,
+		Prerelease:     result.Prerelease,
+		Success:        deployErr == nil,
+		AssetsUploaded: len(result.Assets),
+		ReleaseURL:     result.ReleaseURL,
+	}
+	if deployErr != nil {
+		payload.Error = releaser.Redact(deployErr.Error())
+		payload.Text = fmt.Sprintf("Caddy %s release failed: %v", result.Tag, deployErr)
+	} else {
+		payload.Text = fmt.Sprintf("Caddy %s released with %d assets: %s",
+			result.Tag, len(result.Assets), result.ReleaseURL)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logger.Warnf("preparing webhook notification: %v", err)
+		return
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logger.Warnf("sending webhook notification: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		logger.Warnf("webhook notification failed, HTTP %d: %s", resp.StatusCode, respBody)
+		return
+	}
+
+	logger.Infof("Sent webhook notification")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/caddyserver/buildworker"
+	"github.com/caddyserver/releaser/internal/releaser"
+)
+
+// printPlatforms shows the operator which platforms will be built.
+func printPlatforms(platforms []buildworker.Platform) {
+	logger.Printf("\nThe following %d platforms will be built:\n", len(platforms))
+	for _, plat := range platforms {
+		logger.Printf("  %s\n", plat)
+	}
+	logger.Println()
+}
+
+// printAssetDiff shows how the platforms planned for the
+// release differ from those of the previous release.
+func printAssetDiff(diff *releaser.AssetDiff) {
+	logger.Printf("\nPlatforms compared with %s:\n", diff.Previous)
+	printPlatformList("Added", diff.Added)
+	printPlatformList("Removed", diff.Removed)
+	printPlatformList("Unchanged", diff.Unchanged)
+	if len(diff.Unrecognized) > 0 {
+		logger.Printf("\nThe platform of these assets of %s could not be told:\n", diff.Previous)
+		for _, name := range diff.Unrecognized {
+			logger.Printf("  %s\n", name)
+		}
+	}
+	logger.Println()
+}
+
+// printPlatformList prints the heading and count of
+// a list of platforms, followed by the platforms.
+func printPlatformList(heading string, platforms []string) {
+	logger.Printf("\n%s (%d):\n", heading, len(platforms))
+	for _, plat := range platforms {
+		logger.Printf("  %s\n", plat)
+	}
+}
+
+// printAssetDiffSince compares platforms with the platforms
+// of the release with the tag since, or of the previous
+// release if since is empty, and prints the differences.
+func printAssetDiffSince(since string, platforms []buildworker.Platform) error {
+	if since == "" {
+		var err error
+		since, err = releaser.PreviousTag(caddyRepo, cfg.TagPrefix, considerPrereleases())
+		if err != nil {
+			return err
+		}
+		if since == "" {
+			return fmt.Errorf("there are no tags yet, so there is no previous release to compare with")
+		}
+	}
+	provider, err := cfg.NewProvider(logger)
+	if err != nil {
+		return err
+	}
+	deployer := &releaser.Deployer{
+		Config:   cfg,
+		Log:      logger,
+		Provider: provider,
+	}
+	diff, err := deployer.DiffAssets(context.Background(), since, platforms)
+	if err != nil {
+		return err
+	}
+	printAssetDiff(diff)
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/releaser/internal/releaser"
+)
+
+// requiredTool is a program that must be installed
+// in the PATH for a deploy to succeed.
+type requiredTool struct {
+	name       string
+	args       []string       // arguments that make the program print its version
+	versionRe  *regexp.Regexp // extracts the version number from the output
+	minVersion string
+	purpose    string
+}
+
+var (
+	gitTool = requiredTool{
+		name:       "git",
+		args:       []string{"--version"},
+		versionRe:  regexp.MustCompile(`git version (\d+(?:\.\d+)*)`),
+		minVersion: "2.0",
+		purpose:    "tagging and pushing the release",
+	}
+	goTool = requiredTool{
+		name:       "go",
+		args:       []string{"version"},
+		versionRe:  regexp.MustCompile(`go version go(\d+(?:\.\d+)*)`),
+		minVersion: "1.10",
+		purpose:    "running checks and building Caddy",
+	}
+	gpgTool = requiredTool{
+		name:       "gpg",
+		args:       []string{"--version"},
+		versionRe:  regexp.MustCompile(`gpg \(GnuPG\) (\d+(?:\.\d+)*)`),
+		minVersion: "1.4",
+		purpose:    "signing the tag and release assets",
+	}
+	dockerTool = requiredTool{
+		name:       "docker",
+		args:       []string{"buildx", "version"},
+		versionRe:  regexp.MustCompile(`buildx v?(\d+(?:\.\d+)*)`),
+		minVersion: "0.5",
+		purpose:    "building and pushing the Docker image",
+	}
+)
+
+// checkTools asserts that git and go, gpg if needGPG is
+// true, and docker with buildx if needDocker is true, are
+// installed and recent enough. Rather than stopping at the
+// first problem, it reports all of them.
+func checkTools(needGPG, needDocker bool) error {
+	tools := []requiredTool{gitTool, goTool}
+	if needGPG {
+		tools = append(tools, gpgTool)
+	}
+	if needDocker {
+		tools = append(tools, dockerTool)
+	}
+
+	var problems []string
+	for _, tool := range tools {
+		if err := tool.check(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("missing required tools:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// check runs the tool to get its version, and returns
+// an error if it couldn't be run or is too old.
+func (t requiredTool) check() error {
+	if _, err := exec.LookPath(t.name); err != nil {
+		return fmt.Errorf("%s is required for %s, but was not found in PATH", t.name, t.purpose)
+	}
+	out, err := releaser.Command(t.name, t.args...).Output()
+	if err != nil {
+		return fmt.Errorf("running %s %s: %w", t.name, strings.Join(t.args, " "), err)
+	}
+	match := t.versionRe.FindSubmatch(out)
+	if match == nil {
+		return fmt.Errorf("could not determine version of %s from: %s", t.name, strings.TrimSpace(string(out)))
+	}
+	version := string(match[1])
+	if compareVersions(version, t.minVersion) < 0 {
+		return fmt.Errorf("%s %s is installed, but at least %s is required", t.name, version, t.minVersion)
+	}
+	return nil
+}
+
+// compareVersions compares two dotted version numbers such
+// as "1.10.3", returning -1, 0, or 1 if a is less than, equal
+// to, or greater than b. Missing parts count as 0.
+func compareVersions(a, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for len(partsA) < len(partsB) {
+		partsA = append(partsA, "0")
+	}
+	for len(partsB) < len(partsA) {
+		partsB = append(partsB, "0")
+	}
+	for i := range partsA {
+		numA, _ := strconv.Atoi(partsA[i])
+		numB, _ := strconv.Atoi(partsB[i])
+		if numA < numB {
+			return -1
+		}
+		if numA > numB {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/releaser/internal/releaser"
+)
+
+// progressLogInterval is how often upload progress is
+// logged when it can't be shown as a status line.
+const progressLogInterval = 15 * time.Second
+
+// progressBarWidth is the number of characters in
+// the bar of the upload status line.
+const progressBarWidth = 20
+
+// newProgressReporter returns a function that shows the
+// progress of uploads. At a terminal (with text logs), all
+// the uploads are summed up in one status line below the
+// log; otherwise, the progress of each is logged now and
+// then.
+func newProgressReporter() func([]releaser.UploadProgress) {
+	if isTerminal(os.Stderr) && !logger.json {
+		return func(uploads []releaser.UploadProgress) {
+			logger.setStatus(progressStatus(uploads))
+		}
+	}
+
+	var mu sync.Mutex
+	var lastLogged time.Time
+	return func(uploads []releaser.UploadProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(uploads) == 0 || time.Since(lastLogged) < progressLogInterval {
+			return
+		}
+		lastLogged = time.Now()
+		var each []string
+		for _, u := range uploads {
+			each = append(each, fmt.Sprintf("%s %d%%", u.Name, percent(u.Sent, u.Size)))
+		}
+		logger.Infof("Upload progress: %s", strings.Join(each, ", "))
+	}
+}
+
+// progressStatus returns a status line summing up uploads,
+// or "" if there are none.
+func progressStatus(uploads []releaser.UploadProgress) string {
+	if len(uploads) == 0 {
+		return ""
+	}
+	var sent, size int64
+	for _, u := range uploads {
+		sent += u.Sent
+		size += u.Size
+	}
+	pct := percent(sent, size)
+	filled := pct * progressBarWidth / 100
+	noun := "files"
+	if len(uploads) == 1 {
+		noun = "file"
+	}
+	return fmt.Sprintf("Uploading %d %s [%s%s] %3d%% (%.1f of %.1f MiB)",
+		len(uploads), noun,
+		strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled),
+		pct, float64(sent)/(1<<20), float64(size)/(1<<20))
+}
+
+// percent returns n as a percentage of total,
+// or 0 if total is 0.
+func percent(n, total int64) int {
+	if total <= 0 {
+		return 0
+	}
+	return int(n * 100 / total)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/alecaivazis/survey"
+	"github.com/caddyserver/releaser/internal/releaser"
+)
+
+// rollback undoes a botched release by deleting the GitHub
+// release for tag (along with its assets), the tag on the
+// remote, and the local tag. It shows exactly what will be
+// removed and requires the operator to type the tag to
+// confirm, unless -yes was given. The build server is not
+// touched.
+func rollback(tag string) error {
+	ctx := context.Background()
+	client := releaser.NewGitHubClient(cfg.GitHubToken)
+
+	release, resp, err := client.Repositories.GetReleaseByTag(ctx, cfg.GitHubOwner, cfg.GitHubRepo, tag)
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return fmt.Errorf("getting release for %s: %w", tag, err)
+	}
+	if err != nil {
+		release = nil // no release was made for this tag
+	}
+
+	hasLocalTag, err := releaser.TagExists(caddyRepo, tag)
+	if err != nil {
+		return fmt.Errorf("listing local tags: %w", err)
+	}
+
+	logger.Printf("\nThe rollback of %s will remove:\n\n", tag)
+	if release != nil {
+		logger.Printf("  - GitHub release %q (%s)\n", release.GetName(), release.GetHTMLURL())
+		for _, asset := range release.Assets {
+			logger.Printf("      - asset %s\n", asset.GetName())
+		}
+	} else {
+		logger.Printf("  (no GitHub release exists for %s)\n", tag)
+	}
+	logger.Printf("  - tag %s on remote %s, if it exists\n", tag, cfg.GitRemote)
+	if hasLocalTag {
+		logger.Printf("  - local tag %s\n", tag)
+	} else {
+		logger.Printf("  (no local tag %s exists)\n", tag)
+	}
+	logger.Printf("\nThe Caddy build server will NOT be changed.\n\n")
+
+	if !assumeYes {
+		if err := requireTerminal(); err != nil {
+			return err
+		}
+		typed, err := survey.AskOneValidate(&survey.Input{
+			Message: "This cannot be undone. Type the tag (" + tag + ") to confirm:",
+		}, survey.Required)
+		if err != nil {
+			return err
+		}
+		if typed != tag {
+			return fmt.Errorf("rollback cancelled by user")
+		}
+	}
+
+	if release != nil {
+		logger.Infof("Deleting GitHub release %s", release.GetName())
+		_, err = client.Repositories.DeleteRelease(ctx, cfg.GitHubOwner, cfg.GitHubRepo, release.GetID())
+		if err != nil {
+			return fmt.Errorf("deleting release: %w", err)
+		}
+	}
+
+	logger.Infof("Deleting remote tag %s", tag)
+	err = releaser.RunRedacted(cfg.PushCommand(caddyRepo, "--delete", cfg.GitRemote, tag))
+	if err != nil {
+		logger.Warnf("Deleting remote tag (it may not have been pushed): %v", err)
+	}
+
+	if hasLocalTag {
+		logger.Infof("Deleting local tag %s", tag)
+		err = run("git", "tag", "--delete", tag)
+		if err != nil {
+			return fmt.Errorf("deleting local tag: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/caddyserver/releaser/internal/releaser"
+)
+
+// writeSummary writes result to the file at path as JSON.
+// If deployErr is not nil, it is recorded in the summary.
+func writeSummary(path string, result *releaser.Result, deployErr error) error {
+	if deployErr != nil {
+		result.Error = releaser.Redact(deployErr.Error())
+	}
+	data, err := json.MarshalIndent(result, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// printMetrics prints a table of how long each platform
+// took to build and upload, and the size of its asset,
+// sorted by platform. It must not be called while builds
+// or uploads are still running.
+func printMetrics(result *releaser.Result) {
+	sizes := make(map[string]int64)
+	for _, asset := range result.Assets {
+		sizes[asset.Platform] = asset.Size
+	}
+
+	var platforms []string
+	for plat := range result.BuildDurations {
+		platforms = append(platforms, plat)
+	}
+	sort.Strings(platforms)
+
+	w := tabwriter.NewWriter(logger, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "PLATFORM\tBUILD\tUPLOAD\tSIZE\t")
+	for _, plat := range platforms {
+		upload, size := "-", "-"
+		if secs, ok := result.UploadDurations[plat]; ok {
+			upload = formatSeconds(secs)
+			size = formatSize(sizes[plat])
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", plat, formatSeconds(result.BuildDurations[plat]), upload, size)
+	}
+	w.Flush()
+	warnLargeAssets(result)
+}
+
+// largeAssetFactor is how many times larger than the median
+// an asset must be for warnLargeAssets to point it out.
+const largeAssetFactor = 1.5
+
+// warnLargeAssets warns about each platform whose asset is
+// much larger than those of the others, which is often a
+// sign that it was built with debugging information.
+func warnLargeAssets(result *releaser.Result) {
+	var sizes []int64
+	for _, asset := range result.Assets {
+		if asset.Platform != "source" {
+			sizes = append(sizes, asset.Size)
+		}
+	}
+	if len(sizes) < 3 {
+		return // too few to tell what's usual
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	median := sizes[len(sizes)/2]
+	for _, asset := range result.Assets {
+		if asset.Platform != "source" && float64(asset.Size) > largeAssetFactor*float64(median) {
+			logger.Warnf("The asset for %s is %s, much larger than the usual %s; is it a debug build?",
+				asset.Platform, formatSize(asset.Size), formatSize(median))
+		}
+	}
+}
+
+// printUploadSize prints how many assets were uploaded
+// and their total size.
+func printUploadSize(result *releaser.Result) {
+	if len(result.Assets) == 0 {
+		return
+	}
+	logger.Printf("Uploaded %d assets totaling %s\n", len(result.Assets), formatSize(result.UploadedBytes))
+}
+
+// formatSize formats a number of bytes as MB.
+func formatSize(n int64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
+
+// printOutcome prints how many of the platforms attempted
+// succeeded, as "<verb> N/M platforms", and which failed.
+func printOutcome(verb string, result *releaser.Result) {
+	total := len(result.Platforms) + len(result.FailedPlatforms)
+	if total == 0 {
+		return
+	}
+	logger.Printf("%s %d/%d platforms\n", verb, len(result.Platforms), total)
+	if len(result.FailedPlatforms) > 0 {
+		logger.Printf("Failed: %s\n", strings.Join(result.FailedPlatforms, ", "))
+	}
+}
+
+// printDownloads prints the URL of the release and the
+// download URL of each of its assets, sorted by name, for
+// pasting into announcements. Mirrored assets are listed
+// with their mirror URLs too.
+func printDownloads(result *releaser.Result) {
+	if result.ReleaseURL != "" {
+		logger.Printf("\nRelease: %s\n", result.ReleaseURL)
+	}
+	if result.Commit != "" {
+		logger.Printf("Commit:  %s\n", result.Commit)
+	}
+	if len(result.Assets) == 0 {
+		return
+	}
+	assets := make([]releaser.AssetInfo, len(result.Assets))
+	copy(assets, result.Assets)
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Name < assets[j].Name })
+
+	logger.Println("\nDownloads:")
+	w := tabwriter.NewWriter(logger, 0, 0, 2, ' ', 0)
+	for _, asset := range assets {
+		fmt.Fprintf(w, "  %s\t%s\n", asset.Name, asset.URL)
+		if asset.MirrorURL != "" && asset.MirrorURL != asset.URL {
+			fmt.Fprintf(w, "  \t%s\n", asset.MirrorURL)
+		}
+	}
+	w.Flush()
+}
+
+// formatSeconds formats secs as a rounded duration.
+func formatSeconds(secs float64) string {
+	return time.Duration(secs * float64(time.Second)).Round(100 * time.Millisecond).String()
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+)
+
+// removeStaleTempDirs removes the temporary folders left
+// behind by earlier deploys that failed or were killed,
+// which would otherwise fill the disk of a machine that
+// makes releases for a long time. If report is set, each
+// is listed as it is removed, along with the total freed.
+func removeStaleTempDirs(report bool) error {
+	stale, err := cfg.StaleTempDirs(staleTempAge)
+	if err != nil {
+		return err
+	}
+	var freed int64
+	for _, dir := range stale {
+		if report {
+			logger.Printf("%s  %.1f MiB, last changed %s\n", dir.Path, float64(dir.Size)/(1<<20), dir.ModTime.Format("2006-01-02 15:04"))
+		}
+		if err := os.RemoveAll(dir.Path); err != nil {
+			logger.Warnf("Removing stale temporary folder: %v", err)
+			continue
+		}
+		logger.Debugf("Removed stale temporary folder %s", dir.Path)
+		freed += dir.Size
+	}
+	if report {
+		logger.Printf("Removed %d stale temporary folders, freeing %.1f MiB\n", len(stale), float64(freed)/(1<<20))
+	} else if len(stale) > 0 {
+		logger.Infof("Removed %d temporary folders left by earlier deploys (%.1f MiB)", len(stale), float64(freed)/(1<<20))
+	}
+	return nil
+}
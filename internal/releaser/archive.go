@@ -0,0 +1,109 @@
+package releaser
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// archiveFormat returns the extension of the archive that
+// the release asset for plat should be, and the name of the
+// binary inside it: Windows assets are .zip files containing
+// caddy.exe, and all others are .tar.gz files containing caddy.
+func archiveFormat(plat buildworker.Platform) (ext, binaryName string) {
+	if plat.OS == "windows" {
+		return ".zip", "caddy.exe"
+	}
+	return ".tar.gz", "caddy"
+}
+
+// ensureArchived returns file as a release asset for plat.
+// If file is already an archive, it is returned as-is.
+// Otherwise it is taken to be a bare binary, which is put
+// into an archive of the right format for plat, in dir;
+// file is then closed and removed, and the archive is
+// returned, opened for reading.
+func ensureArchived(file *os.File, plat buildworker.Platform, dir string) (*os.File, error) {
+	if ext := assetExt(file.Name()); ext == ".zip" || ext == ".tar.gz" {
+		return file, nil
+	}
+
+	ext, binaryName := archiveFormat(plat)
+	base := strings.TrimSuffix(filepath.Base(file.Name()), filepath.Ext(file.Name()))
+	archive, err := os.Create(filepath.Join(dir, base+ext))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err == nil {
+		if ext == ".zip" {
+			err = writeZip(archive, file, binaryName, info)
+		} else {
+			err = writeTarGz(archive, file, binaryName, info)
+		}
+	}
+	if err == nil {
+		_, err = archive.Seek(0, 0)
+	}
+	if err != nil {
+		archive.Close()
+		os.Remove(archive.Name())
+		return nil, fmt.Errorf("archiving %s: %w", filepath.Base(file.Name()), err)
+	}
+
+	file.Close()
+	os.Remove(file.Name())
+	return archive, nil
+}
+
+// writeZip writes a zip archive to w containing the contents
+// of binary, with the given name and file info.
+func writeZip(w io.Writer, binary io.Reader, name string, info os.FileInfo) error {
+	zw := zip.NewWriter(w)
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	hdr.Method = zip.Deflate
+	hdr.SetMode(0755)
+	fw, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fw, binary); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeTarGz writes a gzipped tarball to w containing the
+// contents of binary, with the given name and file info.
+func writeTarGz(w io.Writer, binary io.Reader, name string, info os.FileInfo) error {
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	hdr.Mode = 0755
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, binary); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gzw.Close()
+}
@@ -0,0 +1,124 @@
+package releaser
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/buildworker"
+)
+
+func TestEnsureArchived(t *testing.T) {
+	const contents = "not really a binary"
+	for _, tc := range []struct {
+		plat       buildworker.Platform
+		wantExt    string
+		wantBinary string
+	}{
+		{buildworker.Platform{OS: "windows", Arch: "amd64"}, ".zip", "caddy.exe"},
+		{buildworker.Platform{OS: "linux", Arch: "amd64"}, ".tar.gz", "caddy"},
+		{buildworker.Platform{OS: "darwin", Arch: "arm64"}, ".tar.gz", "caddy"},
+	} {
+		t.Run(tc.plat.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			binaryPath := filepath.Join(dir, "caddy_"+tc.plat.OS+"_"+tc.plat.Arch)
+			if err := ioutil.WriteFile(binaryPath, []byte(contents), 0755); err != nil {
+				t.Fatal(err)
+			}
+			binary, err := os.Open(binaryPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			archive, err := ensureArchived(binary, tc.plat, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer archive.Close()
+
+			if want := binaryPath + tc.wantExt; archive.Name() != want {
+				t.Errorf("archive is %s, want %s", archive.Name(), want)
+			}
+			if _, err := os.Stat(binaryPath); !os.IsNotExist(err) {
+				t.Errorf("the bare binary was not removed: %v", err)
+			}
+
+			files := readArchive(t, archive, tc.wantExt)
+			if len(files) != 1 || files[tc.wantBinary] != contents {
+				t.Errorf("archive contains %q, want only %s", files, tc.wantBinary)
+			}
+		})
+	}
+}
+
+func TestEnsureArchivedAlreadyArchived(t *testing.T) {
+	dir := t.TempDir()
+	file, err := os.Create(filepath.Join(dir, "caddy_linux_amd64.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	got, err := ensureArchived(file, buildworker.Platform{OS: "linux", Arch: "amd64"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != file {
+		t.Errorf("ensureArchived returned %s, want the archive as-is", got.Name())
+	}
+}
+
+// readArchive returns the contents of each file in the
+// archive, keyed by name; ext is the archive's format.
+func readArchive(t *testing.T, archive *os.File, ext string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	if ext == ".zip" {
+		info, err := archive.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zip.NewReader(archive, info.Size())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[f.Name] = string(data)
+		}
+		return files
+	}
+
+	gzr, err := gzip.NewReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(data)
+	}
+}
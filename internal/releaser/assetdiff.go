@@ -0,0 +1,173 @@
+package releaser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// AssetDiff compares the platforms that a release is planned
+// to have assets for with those of a previous release.
+type AssetDiff struct {
+	Previous  string   // the tag of the previous release
+	Added     []string // planned, but not in the previous release
+	Removed   []string // in the previous release, but not planned
+	Unchanged []string // in both
+
+	// Unrecognized are the names of assets of the previous
+	// release whose platform could not be told.
+	Unrecognized []string
+}
+
+// DiffAssets compares platforms, the platforms planned for
+// the next release, with the platforms of the assets of the
+// release with the tag previous. The previous release's
+// manifest says which platform each asset is for; releases
+// without one have the platforms read from the asset names.
+// The source archive and the checksum, signature, and
+// manifest files are not platforms, so they are left out.
+func (d *Deployer) DiffAssets(ctx context.Context, previous string, platforms []buildworker.Platform) (*AssetDiff, error) {
+	release, err := d.Provider.GetReleaseByTag(ctx, previous)
+	if err != nil {
+		return nil, fmt.Errorf("getting release: %w", err)
+	}
+	if release == nil {
+		return nil, fmt.Errorf("no release for %s on %s", previous, d.Provider.Name())
+	}
+	assets, err := d.Provider.ListAssets(ctx, release)
+	if err != nil {
+		return nil, fmt.Errorf("listing release assets: %w", err)
+	}
+
+	diff := &AssetDiff{Previous: previous}
+	had := make(map[string]bool)
+	for _, asset := range assets {
+		if asset.Name != manifestFilename {
+			continue
+		}
+		manifest, err := d.downloadManifest(ctx, release, asset)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range manifest.Assets {
+			if a.OS != "" {
+				had[buildworker.Platform{OS: a.OS, Arch: a.Arch, ARM: a.ARM}.String()] = true
+			}
+		}
+		assets = nil // the manifest says it all
+	}
+
+	// without a manifest, match the names against
+	// every platform that could have been built
+	candidates, err := buildworker.SupportedPlatforms(nil)
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, platforms...)
+	for _, asset := range assets {
+		if !isPlatformAsset(asset.Name) {
+			continue
+		}
+		plat, ok := assetPlatform(asset.Name, candidates)
+		if !ok {
+			diff.Unrecognized = append(diff.Unrecognized, asset.Name)
+			continue
+		}
+		had[plat.String()] = true
+	}
+
+	planned := make(map[string]bool)
+	for _, plat := range platforms {
+		name := plat.String()
+		planned[name] = true
+		if had[name] {
+			diff.Unchanged = append(diff.Unchanged, name)
+		} else {
+			diff.Added = append(diff.Added, name)
+		}
+	}
+	for name := range had {
+		if !planned[name] {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Unchanged)
+	sort.Strings(diff.Unrecognized)
+	return diff, nil
+}
+
+// downloadManifest downloads and decodes asset,
+// the manifest of release.
+func (d *Deployer) downloadManifest(ctx context.Context, release *Release, asset Asset) (Manifest, error) {
+	var manifest Manifest
+	rc, err := d.Provider.DownloadAsset(ctx, release, asset)
+	if err != nil {
+		return manifest, fmt.Errorf("downloading %s: %w", manifestFilename, err)
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("decoding %s: %w", manifestFilename, err)
+	}
+	return manifest, nil
+}
+
+// isPlatformAsset returns true if the asset with the given
+// name could be a build for a platform, rather than one of
+// the files that accompany the builds.
+func isPlatformAsset(name string) bool {
+	switch {
+	case name == checksumsFilename, name == manifestFilename,
+		strings.HasSuffix(name, ".asc"),
+		strings.HasSuffix(name, assetChecksumExt),
+		strings.Contains(name, sourcePlatform):
+		return false
+	}
+	return true
+}
+
+// assetPlatform returns the platform among candidates that
+// the asset with the given name is for, such as linux/arm7
+// for "caddy_v0.10.12_linux_arm7.tar.gz", and false if its
+// name doesn't match exactly one platform. The OS and
+// architecture must appear in the name in that order, each
+// on its own, and so must the ARM version, if any.
+func assetPlatform(name string, candidates []buildworker.Platform) (buildworker.Platform, bool) {
+	base := strings.ToLower(strings.TrimSuffix(name, assetExt(name)))
+	words := strings.FieldsFunc(base, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+	joined := " " + strings.Join(words, " ") + " "
+
+	var match buildworker.Platform
+	var matches int
+	seen := make(map[buildworker.Platform]bool)
+	for _, plat := range candidates {
+		if seen[plat] {
+			continue
+		}
+		seen[plat] = true
+		spellings := []string{plat.OS + " " + plat.Arch}
+		if plat.ARM != "" {
+			spellings = []string{
+				plat.OS + " " + plat.Arch + plat.ARM,
+				plat.OS + " " + plat.Arch + "v" + plat.ARM,
+				plat.OS + " " + plat.Arch + " " + plat.ARM,
+				plat.OS + " " + plat.Arch + " v" + plat.ARM,
+			}
+		}
+		for _, s := range spellings {
+			if strings.Contains(joined, " "+s+" ") {
+				match = plat
+				matches++
+				break
+			}
+		}
+	}
+	return match, matches == 1
+}
@@ -0,0 +1,85 @@
+package releaser
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// AssetNameData is the data given to the asset name
+// template to produce the name of each release asset.
+type AssetNameData struct {
+	Repo    string // the GitHub repository, e.g. "caddy"
+	Version string // the release tag, e.g. "v0.10.12"
+	OS      string
+	Arch    string
+	ARM     string // empty unless Arch is "arm"
+	Ext     string // the file extension, e.g. ".tar.gz"
+}
+
+// ParseAssetNameTemplate parses text as an asset name
+// template and makes sure it gives a distinct name for
+// each of platforms when releasing from the GitHub
+// repository named repo. An empty text returns a nil
+// template, meaning the names chosen by buildworker
+// are used.
+func ParseAssetNameTemplate(text, repo string, platforms []buildworker.Platform) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("asset name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing asset name template: %w", err)
+	}
+
+	// the extension isn't known until the asset is built,
+	// so leave it out; names must be distinct without it
+	seen := make(map[string]buildworker.Platform)
+	for _, plat := range platforms {
+		name, err := executeAssetNameTemplate(tmpl, repo, "v0.0.0", plat, "")
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("asset name template gives the same name (%q) for %s and %s", name, other, plat)
+		}
+		seen[name] = plat
+	}
+
+	return tmpl, nil
+}
+
+// executeAssetNameTemplate returns the name of the asset
+// for plat in the release of repo with the given tag,
+// as given by tmpl.
+func executeAssetNameTemplate(tmpl *template.Template, repo, tag string, plat buildworker.Platform, ext string) (string, error) {
+	var sb strings.Builder
+	err := tmpl.Execute(&sb, AssetNameData{
+		Repo:    repo,
+		Version: tag,
+		OS:      plat.OS,
+		Arch:    plat.Arch,
+		ARM:     plat.ARM,
+		Ext:     ext,
+	})
+	if err != nil {
+		return "", fmt.Errorf("executing asset name template: %w", err)
+	}
+	name := sb.String()
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("asset name template gives invalid name %q for %s", name, plat)
+	}
+	return name, nil
+}
+
+// assetExt returns the extension of the file named name,
+// treating ".tar.gz" as one extension.
+func assetExt(name string) string {
+	if strings.HasSuffix(name, ".tar.gz") {
+		return ".tar.gz"
+	}
+	return filepath.Ext(name)
+}
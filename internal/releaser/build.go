@@ -0,0 +1,235 @@
+package releaser
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// BuildOnly builds Caddy at the current commit of the repo
+// for each of platforms, packaged as release assets would
+// be, into outDir, along with a checksums file. Nothing is
+// tagged, published, or deployed. If some platforms fail to
+// build, the others are still kept, and an error lists the
+// ones that failed; the build log of each is left in outDir.
+func (d *Deployer) BuildOnly(ctx context.Context, platforms []buildworker.Platform, outDir string) (*Result, error) {
+	result := &Result{
+		BuildDurations:  make(map[string]float64),
+		UploadDurations: make(map[string]float64),
+		Plugins:         pluginList(d.Plugins),
+	}
+
+	// the config isn't validated before a build-only run,
+	// and no builds could ever start without a slot
+	if d.Config.BuildConcurrency < 1 {
+		return result, &DeployError{Kind: ErrPreflight, Msg: "build_concurrency must be at least 1"}
+	}
+
+	commit, short, err := TagCommit(d.RepoDir, "HEAD")
+	if err != nil {
+		return result, fmt.Errorf("getting current commit: %w", err)
+	}
+	result.Commit, result.ShortCommit = commit, short
+
+	// asset names need a version, but the commit
+	// isn't tagged; describe it relative to a tag
+	cmd := Command("git", "describe", "--tags", "--always")
+	cmd.Dir = d.RepoDir
+	out, err := cmd.Output()
+	if err != nil {
+		return result, fmt.Errorf("describing current commit: %w", err)
+	}
+	result.Tag = strings.TrimSpace(string(out))
+
+	result.GoVersion, err = d.checkGoVersion()
+	if err != nil {
+		return result, err
+	}
+
+	err = os.MkdirAll(outDir, 0755)
+	if err != nil {
+		return result, err
+	}
+
+	d.Log.Infof("Preparing builds of %s", result.Tag)
+	env, err := d.OpenEnv(commit, d.Plugins)
+	if err != nil {
+		return result, d.envOpenError("build environment", err)
+	}
+	defer env.Close()
+
+	restoreGoflags, err := d.useBuildFlags(strings.TrimPrefix(result.Tag, d.Config.TagPrefix), commit, time.Now())
+	if err != nil {
+		return result, err
+	}
+	defer restoreGoflags()
+
+	var wg sync.WaitGroup
+	var resultMu sync.Mutex
+	buildThrottle := make(chan struct{}, d.Config.BuildConcurrency)
+
+	for _, plat := range platforms {
+		select {
+		case buildThrottle <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break // don't start any more builds
+		}
+		wg.Add(1)
+
+		go func(plat buildworker.Platform) {
+			defer wg.Done()
+
+			var built bool
+			defer func() {
+				if !built {
+					resultMu.Lock()
+					result.FailedPlatforms = append(result.FailedPlatforms, plat.String())
+					resultMu.Unlock()
+				}
+			}()
+
+			d.Log.Infof("Building %s...", plat)
+			start := time.Now()
+			file, err := d.build(ctx, env, plat, outDir)
+			<-buildThrottle
+			resultMu.Lock()
+			result.BuildDurations[plat.String()] = time.Since(start).Seconds()
+			resultMu.Unlock()
+			if err != nil {
+				logPath := BuildLogPath(outDir, plat)
+				if logErr := ioutil.WriteFile(logPath, []byte(env.Output()), 0644); logErr != nil {
+					d.Log.Warnf("writing build log for %s: %v", plat, logErr)
+				}
+				d.Log.Errorf("building %s: %v (build log: %s)", plat, err, logPath)
+				return
+			}
+
+			file, err = ensureArchived(file, plat, outDir)
+			if err != nil {
+				d.Log.Errorf("!! COULD NOT PACKAGE %+v: %v", plat, err)
+				return
+			}
+			defer file.Close()
+
+			asset, err := describeAsset(file, plat.String())
+			if err != nil {
+				d.Log.Errorf("!! COULD NOT READ BUILT FILE FOR %+v: %v", plat, err)
+				return
+			}
+			if d.AssetNames != nil {
+				asset.Name, err = executeAssetNameTemplate(d.AssetNames, d.Config.GitHubRepo, result.Tag, plat, assetExt(asset.Name))
+				if err != nil {
+					d.Log.Errorf("!! COULD NOT NAME ASSET FOR %+v: %v", plat, err)
+					return
+				}
+				err = os.Rename(file.Name(), filepath.Join(outDir, asset.Name))
+				if err != nil {
+					d.Log.Errorf("!! COULD NOT RENAME ASSET FOR %+v: %v", plat, err)
+					return
+				}
+			}
+
+			d.Log.Infof("Built %s", plat)
+			built = true
+			resultMu.Lock()
+			result.Assets = append(result.Assets, asset)
+			result.Platforms = append(result.Platforms, plat.String())
+			resultMu.Unlock()
+		}(plat)
+	}
+
+	// builds can't be cancelled, so even if
+	// interrupted, wait for those in progress
+	wg.Wait()
+	if err := interrupted(ctx); err != nil {
+		return result, err
+	}
+
+	sort.Strings(result.Platforms)
+	if len(result.Assets) > 0 {
+		err = ioutil.WriteFile(filepath.Join(outDir, checksumsFilename), checksumsFile(result.Assets), 0644)
+		if err != nil {
+			return result, fmt.Errorf("writing checksums: %w", err)
+		}
+	}
+
+	if len(result.FailedPlatforms) > 0 {
+		sort.Strings(result.FailedPlatforms)
+		return result, &DeployError{
+			Kind: ErrUploadPartial,
+			Msg: fmt.Sprintf("%d of %d platforms failed to build: %s",
+				len(result.FailedPlatforms), len(platforms), strings.Join(result.FailedPlatforms, ", ")),
+		}
+	}
+	return result, nil
+}
+
+// build builds Caddy for plat in env, with the asset put
+// in dir, trying up to d.BuildRetries more times if the
+// build fails, since builds that fetch plugins sometimes
+// fail because of the network.
+func (d *Deployer) build(ctx context.Context, env BuildEnv, plat buildworker.Platform, dir string) (*os.File, error) {
+	file, err := env.Build(plat, dir)
+	for i := 1; err != nil && i <= d.BuildRetries; i++ {
+		d.Log.Warnf("Building %s failed: %v; trying again (retry %d of %d)", plat, err, i, d.BuildRetries)
+		if err := waitToRetry(ctx, d.RetryBackoff, i); err != nil {
+			return nil, err
+		}
+		file, err = env.Build(plat, dir)
+	}
+	return file, err
+}
+
+// builtAsset is the asset of a platform that was built and
+// is ready to upload, as handed from the build workers of a
+// deploy to its upload workers.
+type builtAsset struct {
+	plat    buildworker.Platform
+	file    *os.File
+	sigFile *os.File // nil if assets aren't signed
+	asset   AssetInfo
+
+	// keptPath is where the asset the release already had
+	// was downloaded to, if it was kept instead of this one.
+	keptPath string
+}
+
+// keep moves b's asset and signature into d.KeepAssets,
+// if that is set, once they have been uploaded. If the
+// release already had the asset, that one is kept instead,
+// without the signature, which is of the one just built.
+func (d *Deployer) keep(b *builtAsset) {
+	if b.keptPath != "" {
+		d.keepFile(b.keptPath, b.asset.Name)
+		return
+	}
+	d.keepFile(b.file.Name(), b.asset.Name)
+	if b.sigFile != nil {
+		d.keepFile(b.sigFile.Name(), b.asset.Name+".asc")
+	}
+}
+
+// remove closes and deletes the asset's files, once it
+// has been uploaded or can't be; those that were kept
+// are already gone.
+func (b *builtAsset) remove() {
+	b.file.Close()
+	os.Remove(b.file.Name())
+	if b.sigFile != nil {
+		b.sigFile.Close()
+		os.Remove(b.sigFile.Name())
+	}
+	if b.keptPath != "" {
+		os.Remove(b.keptPath)
+	}
+}
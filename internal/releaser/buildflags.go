@@ -0,0 +1,108 @@
+package releaser
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// LDFlagsData is the data given to the ldflags template
+// to produce the linker flags of a build.
+type LDFlagsData struct {
+	Version string // the tag being built without its prefix, e.g. "v0.10.12"
+	Commit  string // the full hash of the commit being built
+	Date    string // when the builds started, in RFC 3339 and UTC
+}
+
+// ParseLDFlagsTemplate parses text as an ldflags template,
+// such as "-X main.version={{.Version}}", and makes sure it
+// can be executed. An empty text returns a nil template,
+// meaning no linker flags are added.
+func ParseLDFlagsTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("ldflags").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing ldflags template: %w", err)
+	}
+	_, err = executeLDFlagsTemplate(tmpl, LDFlagsData{
+		Version: "v0.0.0",
+		Commit:  strings.Repeat("0", 40),
+		Date:    time.Time{}.Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// executeLDFlagsTemplate returns the linker flags given by
+// tmpl for data, as they are to be put in GOFLAGS.
+func executeLDFlagsTemplate(tmpl *template.Template, data LDFlagsData) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("executing ldflags template: %w", err)
+	}
+	return goflag("-ldflags=" + strings.TrimSpace(sb.String()))
+}
+
+// goflag returns flag as an entry of GOFLAGS, which is split
+// on spaces unless the whole entry is quoted. There is no
+// escaping inside the quotes, so flag can't have both kinds.
+func goflag(flag string) (string, error) {
+	if !strings.ContainsAny(flag, " \t\n\r") {
+		return flag, nil
+	}
+	for _, q := range []string{"'", `"`} {
+		if !strings.Contains(flag, q) {
+			return q + flag + q, nil
+		}
+	}
+	return "", fmt.Errorf("%s has spaces and both kinds of quote, so it can't be put in GOFLAGS", flag)
+}
+
+// useBuildFlags adds the configured build tags and the linker
+// flags from d.LDFlags, for the given version and commit, to
+// GOFLAGS, which the go commands run by buildworker inherit.
+// buildworker takes no build flags of its own, so this is how
+// they get to its builds. Call restore once the builds are
+// done. Flags that the build passes on the command line take
+// precedence over GOFLAGS.
+func (d *Deployer) useBuildFlags(version, commit string, date time.Time) (restore func(), err error) {
+	var flags []string
+	if len(d.Config.BuildTags) > 0 {
+		flags = append(flags, "-tags="+strings.Join(d.Config.BuildTags, ","))
+	}
+	if d.LDFlags != nil {
+		ldflags, err := executeLDFlagsTemplate(d.LDFlags, LDFlagsData{
+			Version: version,
+			Commit:  commit,
+			Date:    date.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return nil, err
+		}
+		flags = append(flags, ldflags)
+	}
+	if len(flags) == 0 {
+		return func() {}, nil
+	}
+
+	oldGoflags, hadGoflags := os.LookupEnv("GOFLAGS")
+	if hadGoflags && strings.TrimSpace(oldGoflags) != "" {
+		flags = append([]string{oldGoflags}, flags...)
+	}
+	goflags := strings.Join(flags, " ")
+	d.Log.Infof("Building with GOFLAGS=%s", goflags)
+	os.Setenv("GOFLAGS", goflags)
+	return func() {
+		if hadGoflags {
+			os.Setenv("GOFLAGS", oldGoflags)
+		} else {
+			os.Unsetenv("GOFLAGS")
+		}
+	}, nil
+}
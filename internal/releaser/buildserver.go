@@ -0,0 +1,258 @@
+package releaser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// deploysToBuildServer returns true if the release, which
+// is a pre-release if prerelease is true, should be deployed
+// to the build server: the channel deploys such releases,
+// and the build server deploy isn't turned off.
+func (d *Deployer) deploysToBuildServer(prerelease bool) bool {
+	return !d.Config.NoBuildServer && d.Channel.DeploysToBuildServer(prerelease)
+}
+
+// ReleaseToBuildServer deploys the release with the given
+// tag to the Caddy build server and waits for it to go live,
+// recording in result that the deploy was triggered. The
+// assets in result, if any, are listed in the request so the
+// build server can link to them directly. Errors
+// are of kind ErrBuildServerDeploy, or ErrInterrupted if ctx
+// is cancelled.
+func (d *Deployer) ReleaseToBuildServer(ctx context.Context, tag string, result *Result) error {
+	d.Log.Infof("Deploying to build server (%s environment)", d.Environment.Name)
+
+	err := d.deployToBuildServer(ctx, tag, result.Assets)
+	if err := interrupted(ctx); err != nil {
+		return err
+	}
+	if err != nil {
+		return &DeployError{
+			Kind: ErrBuildServerDeploy,
+			Msg:  "deploying to build server (the release is published; run again with -resume=buildserver to retry)",
+			Err:  err,
+		}
+	}
+	d.Log.Infof("Deploy request successfully sent to Caddy build server")
+	result.BuildServerDeployed = true
+
+	// the request was only acknowledged; make sure
+	// the build server actually puts the release live
+	err = d.waitForBuildServer(ctx, tag, d.DeployTimeout)
+	if err := interrupted(ctx); err != nil {
+		return err
+	}
+	if err != nil {
+		return &DeployError{Kind: ErrBuildServerDeploy, Msg: "confirming deploy to build server", Err: err}
+	}
+	d.Log.Infof("Caddy build server reports %s is live", tag)
+
+	return nil
+}
+
+// buildServerClient makes requests to the build server;
+// unlike http.DefaultClient, it doesn't wait forever.
+var buildServerClient = &http.Client{Timeout: 30 * time.Second}
+
+// Retrying deploy requests to the build server: how many
+// times to try, and how long to wait after the first try,
+// which doubles after each one after that.
+const (
+	buildServerDeployAttempts = 5
+	buildServerDeployBackoff  = 2 * time.Second
+)
+
+// buildServerError is an error response from the build server.
+type buildServerError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *buildServerError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// retryable returns true if the request might succeed if
+// tried again: server errors and rate limiting, but not
+// other client errors.
+func (e *buildServerError) retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// deployRequest is the body of a deploy request to the
+// build server. Assets were added later, so they are
+// optional.
+type deployRequest struct {
+	CaddyVersion string        `json:"caddy_version"`
+	Assets       []deployAsset `json:"assets,omitempty"`
+}
+
+// deployAsset is a release asset in a deploy request.
+type deployAsset struct {
+	Name        string `json:"name"`
+	DownloadURL string `json:"browser_download_url"`
+	SHA256      string `json:"sha256"`
+}
+
+// deployToBuildServer asks the Caddy build server to deploy
+// the release with the given tag and assets, retrying with
+// backoff after network errors and retryable error responses.
+func (d *Deployer) deployToBuildServer(ctx context.Context, tag string, assets []AssetInfo) error {
+	bodyInfo := deployRequest{CaddyVersion: strings.TrimPrefix(tag, d.Config.TagPrefix)}
+	for _, asset := range assets {
+		bodyInfo.Assets = append(bodyInfo.Assets, deployAsset{
+			Name:        asset.Name,
+			DownloadURL: asset.URL,
+			SHA256:      asset.SHA256,
+		})
+	}
+	body, err := json.Marshal(bodyInfo)
+	if err != nil {
+		return fmt.Errorf("preparing request body: %w", err)
+	}
+
+	backoff := buildServerDeployBackoff
+	for i := 0; i < buildServerDeployAttempts; i++ {
+		if i > 0 {
+			d.Log.Warnf("Deploy request to build server failed: %v; trying again in %s", err, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+		err = d.requestBuildServerDeploy(ctx, body)
+		if bsErr, ok := err.(*buildServerError); err == nil || ok && !bsErr.retryable() {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("deploy to build server failed: %w", err)
+	}
+	return nil
+}
+
+// requestBuildServerDeploy sends one deploy request
+// with the given body to the build server.
+func (d *Deployer) requestBuildServerDeploy(ctx context.Context, body []byte) error {
+	// prepare request
+	deployURL, err := d.Environment.DeployURL(d.Channel)
+	if err != nil {
+		return fmt.Errorf("build server URL: %w", err)
+	}
+	req, err := http.NewRequest("POST", deployURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("preparing request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	d.Environment.authorize(req)
+
+	resp, err := buildServerClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("network error deploying to website: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("reading response body: %w", err)
+		}
+		return &buildServerError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+
+	return nil
+}
+
+// buildServerStatus is the response from the
+// build server's deploy status endpoint.
+type buildServerStatus struct {
+	Status  string `json:"status"` // "pending", "live", or "failed"
+	Message string `json:"message"`
+}
+
+// buildServerPollInterval is how often to ask the
+// build server whether a deploy has gone live.
+const buildServerPollInterval = 10 * time.Second
+
+// waitForBuildServer polls the build server until it reports
+// that the release with the given tag is live. It returns an
+// error if the build server reports that the deploy failed,
+// or if it is not live before timeout elapses. It stops
+// early if ctx is cancelled.
+func (d *Deployer) waitForBuildServer(ctx context.Context, tag string, timeout time.Duration) error {
+	start := time.Now()
+	for {
+		status, err := d.getBuildServerStatus(ctx, tag)
+		if err != nil {
+			// might be a transient error; keep trying until timeout
+			d.Log.Warnf("Checking build server deploy status: %v", err)
+		} else {
+			switch status.Status {
+			case "live":
+				return nil
+			case "failed":
+				return fmt.Errorf("build server reports deploy failed: %s", status.Message)
+			}
+			d.Log.Infof("Build server deploy status: %s (%s elapsed)",
+				status.Status, time.Since(start).Round(time.Second))
+		}
+
+		if time.Since(start)+buildServerPollInterval > timeout {
+			return fmt.Errorf("build server did not confirm deploy within %s", timeout)
+		}
+		select {
+		case <-time.After(buildServerPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// getBuildServerStatus gets the status of the deploy of tag
+// from the build server.
+func (d *Deployer) getBuildServerStatus(ctx context.Context, tag string) (buildServerStatus, error) {
+	var status buildServerStatus
+
+	deployURL, err := d.Environment.DeployURL(d.Channel)
+	if err != nil {
+		return status, fmt.Errorf("build server URL: %w", err)
+	}
+	statusURL, err := joinURL(deployURL, "status")
+	if err != nil {
+		return status, err
+	}
+	req, err := http.NewRequest("GET", statusURL+"?version="+url.QueryEscape(tag), nil)
+	if err != nil {
+		return status, fmt.Errorf("preparing request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	d.Environment.authorize(req)
+
+	resp, err := buildServerClient.Do(req)
+	if err != nil {
+		return status, fmt.Errorf("network error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return status, fmt.Errorf("HTTP %d: %s", resp.StatusCode, respBody)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		return status, fmt.Errorf("decoding response: %w", err)
+	}
+	return status, nil
+}
@@ -0,0 +1,242 @@
+package releaser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Change is a commit in a changelog.
+type Change struct {
+	Hash     string
+	Type     string // the conventional-commit type, e.g. "fix"; empty if none
+	Scope    string // e.g. "proxy" in "fix(proxy): ..."
+	Breaking bool   // marked with "!", e.g. "feat!: ..."
+	Summary  string // the subject, without the type and scope
+}
+
+// ChangeGroup is a category of changes in a changelog.
+type ChangeGroup struct {
+	Title   string
+	Changes []Change
+}
+
+// changeGroups maps conventional-commit types to the titles
+// of their groups, in the order the groups are shown. Types
+// not listed here are grouped under "Other".
+var changeGroups = []struct {
+	types []string
+	title string
+}{
+	{[]string{"feat"}, "Features"},
+	{[]string{"fix"}, "Bug Fixes"},
+	{[]string{"perf"}, "Performance"},
+	{[]string{"docs"}, "Documentation"},
+	{[]string{"refactor", "style", "test", "build", "ci", "chore"}, "Maintenance"},
+}
+
+// conventionalCommitRe matches a subject like "fix(scope)!: summary".
+var conventionalCommitRe = regexp.MustCompile(`^([a-zA-Z]+)(?:\(([^)]*)\))?(!)?:\s*(.+)$`)
+
+// breakingFooterRe matches the footer of a commit message
+// that marks a breaking change, such as "BREAKING CHANGE: ...".
+var breakingFooterRe = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE:`)
+
+// parseChange parses the subject and body of the commit with
+// the given hash. A BREAKING CHANGE footer in the body marks
+// a breaking change, as does a "!" after the type.
+func parseChange(hash, subject, body string) Change {
+	breaking := breakingFooterRe.MatchString(body)
+	match := conventionalCommitRe.FindStringSubmatch(subject)
+	if match == nil {
+		return Change{Hash: hash, Breaking: breaking, Summary: subject}
+	}
+	return Change{
+		Hash:     hash,
+		Type:     strings.ToLower(match[1]),
+		Scope:    match[2],
+		Breaking: breaking || match[3] == "!",
+		Summary:  match[4],
+	}
+}
+
+// Changelog returns the commits in the Caddy repo at repoDir
+// from the tag since (exclusive) to the commit until, or HEAD
+// if until is empty, grouped by their conventional-commit
+// type. Breaking changes, marked with "!" or a BREAKING CHANGE
+// footer, are grouped first, whatever their type. Merge
+// commits are left out. If since is empty, all
+// commits up to until are included.
+func Changelog(repoDir, since, until string) ([]ChangeGroup, error) {
+	if until == "" {
+		until = "HEAD"
+	}
+	revs := until
+	if since != "" {
+		revs = since + ".." + until
+	}
+	// each commit is its hash and subject, then its body
+	// after a unit separator, ending in a record separator
+	cmd := Command("git", "log", "--no-merges", "--format=%h %s%x1f%b%x1e", revs)
+	cmd.Dir = repoDir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log %s: %w", revs, err)
+	}
+
+	breaking := ChangeGroup{Title: "Breaking Changes"}
+	other := ChangeGroup{Title: "Other"}
+	groups := make([]ChangeGroup, len(changeGroups))
+	for i, g := range changeGroups {
+		groups[i].Title = g.title
+	}
+
+	for _, record := range strings.Split(string(out), "\x1e") {
+		record = strings.TrimSpace(record)
+		if record == "" {
+			continue
+		}
+		var body string
+		if i := strings.IndexByte(record, '\x1f'); i >= 0 {
+			record, body = record[:i], record[i+1:]
+		}
+		parts := strings.SplitN(record, " ", 2)
+		if len(parts) < 2 {
+			parts = append(parts, "")
+		}
+		change := parseChange(parts[0], parts[1], body)
+		if change.Breaking {
+			breaking.Changes = append(breaking.Changes, change)
+			continue
+		}
+		grouped := false
+		for i, g := range changeGroups {
+			for _, t := range g.types {
+				if change.Type == t {
+					groups[i].Changes = append(groups[i].Changes, change)
+					grouped = true
+				}
+			}
+		}
+		if !grouped {
+			other.Changes = append(other.Changes, change)
+		}
+	}
+
+	var changelog []ChangeGroup
+	for _, g := range append(append([]ChangeGroup{breaking}, groups...), other) {
+		if len(g.Changes) > 0 {
+			changelog = append(changelog, g)
+		}
+	}
+	return changelog, nil
+}
+
+// Bump is the part of the version number that
+// a release increments.
+type Bump int
+
+// The bumps, in the order NextTagSuggestions suggests them.
+const (
+	BumpPatch Bump = iota
+	BumpMinor
+	BumpMajor
+)
+
+func (b Bump) String() string {
+	switch b {
+	case BumpMinor:
+		return "minor"
+	case BumpMajor:
+		return "major"
+	}
+	return "patch"
+}
+
+// ConventionalBump returns the bump that changelog calls for
+// by the conventional-commit rules: major if any change is
+// breaking, otherwise minor if any is a feature, otherwise
+// patch.
+func ConventionalBump(changelog []ChangeGroup) Bump {
+	bump := BumpPatch
+	for _, g := range changelog {
+		for _, c := range g.Changes {
+			if c.Breaking {
+				return BumpMajor
+			}
+			if c.Type == "feat" {
+				bump = BumpMinor
+			}
+		}
+	}
+	return bump
+}
+
+// FormatChangelog renders changelog as plain text, with
+// a heading for each group and one line per change.
+func FormatChangelog(changelog []ChangeGroup) string {
+	var sb strings.Builder
+	for i, g := range changelog {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "%s:\n", g.Title)
+		for _, c := range g.Changes {
+			summary := c.Summary
+			if c.Scope != "" {
+				summary = c.Scope + ": " + summary
+			}
+			fmt.Fprintf(&sb, "  - %s (%s)\n", summary, c.Hash)
+		}
+	}
+	return sb.String()
+}
+
+// defaultTagMessage returns the annotation for a new tag
+// when none is given: "Release <tag>", followed by the
+// changelog since the current tag, if it can be made. The
+// first release has no changelog, only a note saying so.
+func (d *Deployer) defaultTagMessage(tag string) string {
+	message := "Release " + tag
+	since, err := PreviousTag(d.RepoDir, d.Config.TagPrefix, d.IncludePrereleases)
+	if err != nil {
+		d.Log.Warnf("Could not make changelog for tag message: %v", err)
+		return message
+	}
+	if since == "" {
+		return message + "\n\n" + initialReleaseNote
+	}
+	changelog, err := Changelog(d.RepoDir, since, d.Commit)
+	if err != nil {
+		d.Log.Warnf("Could not make changelog for tag message: %v", err)
+		return message
+	}
+	if len(changelog) > 0 {
+		message += "\n\n" + FormatChangelog(changelog)
+	}
+	return message
+}
+
+// initialReleaseNote is put in the tag message and release
+// notes of the first release, which has no changelog.
+const initialReleaseNote = "This is the initial release."
+
+// releaseNotes returns the notes for the release described
+// by result: a note if it is the first release, the commit
+// it was made from, and the plugins built into it, if any.
+func (d *Deployer) releaseNotes(result *Result) string {
+	var paragraphs []string
+	first, err := IsFirstRelease(d.RepoDir, d.Config.TagPrefix, result.Tag)
+	if err != nil {
+		d.Log.Warnf("Could not tell if %s is the first release: %v", result.Tag, err)
+	} else if first {
+		paragraphs = append(paragraphs, initialReleaseNote+"\n")
+	}
+	if result.Commit != "" {
+		paragraphs = append(paragraphs, fmt.Sprintf("Commit: %s (`%s`)\n", result.Commit, result.ShortCommit))
+	}
+	if plugins := pluginNotes(d.Plugins); plugins != "" {
+		paragraphs = append(paragraphs, plugins)
+	}
+	return strings.Join(paragraphs, "\n")
+}
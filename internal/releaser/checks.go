@@ -0,0 +1,224 @@
+package releaser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// checksHeartbeatInterval is how often to report that
+// the checks are still running.
+const checksHeartbeatInterval = 30 * time.Second
+
+// watchChecks reports on the progress of checks that are
+// running until done is closed, so the terminal doesn't
+// look frozen. Every so often, it logs how long the checks
+// have been running. If d.VerboseChecks is set, it also
+// prints new output from the checks' log as it appears;
+// getLog must return the whole log so far.
+func (d *Deployer) watchChecks(getLog func() string, done <-chan struct{}) {
+	start := time.Now()
+	heartbeat := time.NewTicker(checksHeartbeatInterval)
+	defer heartbeat.Stop()
+	stream := time.NewTicker(time.Second)
+	defer stream.Stop()
+
+	var printed int
+	printNewOutput := func() {
+		if !d.VerboseChecks {
+			return
+		}
+		log := getLog()
+		if len(log) > printed {
+			fmt.Print(log[printed:])
+			printed = len(log)
+		}
+	}
+
+	for {
+		select {
+		case <-done:
+			printNewOutput()
+			return
+		case <-heartbeat.C:
+			d.Log.Infof("Checks still running, %s elapsed...", time.Since(start).Round(time.Second))
+		case <-stream.C:
+			printNewOutput()
+		}
+	}
+}
+
+// runCheckCommand runs command, one of the configured extra
+// checks, with the system shell in the Caddy repo at dir. Its
+// output is watched and reported like that of the built-in
+// checks.
+func (d *Deployer) runCheckCommand(dir, command string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = Command("cmd", "/C", command)
+	} else {
+		cmd = Command("sh", "-c", command)
+	}
+	cmd.Dir = dir
+	var output checkOutput
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	d.Log.Infof("Running check: %s", command)
+	done, watched := make(chan struct{}), make(chan struct{})
+	go func() {
+		d.watchChecks(output.String, done)
+		close(watched)
+	}()
+	err := cmd.Run()
+	close(done)
+	<-watched
+	if err != nil {
+		if !d.VerboseChecks {
+			d.Log.Errorf("check %q failed; here's the log:\n>>>>>>>>>>>>%s\n<<<<<<<<<<<<", command, output.String())
+		}
+		return fmt.Errorf("check %q: %w", command, err)
+	}
+	return nil
+}
+
+// checkOutput collects the output of a check command,
+// which may be read while the command is writing it.
+type checkOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *checkOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *checkOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// checksRecord is what the checks cache file holds: the
+// last commit whose checks passed, and what they covered.
+type checksRecord struct {
+	Commit        string   `json:"commit"`
+	Plugins       []string `json:"plugins"`
+	CheckCommands []string `json:"check_commands"`
+}
+
+// newChecksRecord returns the record of the checks
+// passing for commit with the current configuration.
+func (d *Deployer) newChecksRecord(commit string) checksRecord {
+	return checksRecord{
+		Commit:        commit,
+		Plugins:       pluginList(d.Plugins),
+		CheckCommands: d.Config.CheckCommands,
+	}
+}
+
+// checksPassed returns true if d.ChecksCache records that
+// the checks already passed for commit, with the same
+// plugins and check commands.
+func (d *Deployer) checksPassed(commit string) bool {
+	data, err := ioutil.ReadFile(d.ChecksCache)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			d.Log.Warnf("Reading checks cache: %v", err)
+		}
+		return false
+	}
+	var cached checksRecord
+	if err := json.Unmarshal(data, &cached); err != nil {
+		d.Log.Warnf("Reading checks cache %s: %v", d.ChecksCache, err)
+		return false
+	}
+	return reflect.DeepEqual(cached, d.newChecksRecord(commit))
+}
+
+// recordChecksPassed records in d.ChecksCache that the
+// checks passed for commit, replacing any earlier record.
+// Failing to do so only means they run again next time.
+func (d *Deployer) recordChecksPassed(commit string) {
+	data, err := json.Marshal(d.newChecksRecord(commit))
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(d.ChecksCache), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(d.ChecksCache, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		d.Log.Warnf("Writing checks cache: %v", err)
+	}
+}
+
+// openIsolatedEnv opens a build environment for commit whose
+// master GOPATH is a new temporary one, holding nothing but
+// a shallow clone of the Caddy repo at commit, so the checks
+// neither depend on nor change the operator's GOPATH. It
+// returns the environment, the path of the clone, and a
+// function that closes the environment and removes the
+// temporary GOPATH.
+func (d *Deployer) openIsolatedEnv(commit string) (BuildEnv, string, func(), error) {
+	gopath, err := ioutil.TempDir(d.Config.StagingDir(), "caddy_checks_")
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("making temporary GOPATH: %w", err)
+	}
+	repoDir := filepath.Join(gopath, "src", filepath.FromSlash(buildworker.CaddyPackage))
+	source, err := filepath.Abs(d.RepoDir)
+	if err == nil {
+		err = os.MkdirAll(repoDir, 0755)
+	}
+	if err != nil {
+		os.RemoveAll(gopath)
+		return nil, "", nil, err
+	}
+
+	// fetching a single commit, rather than cloning a
+	// branch, works whether or not the commit is tagged
+	// or at the tip of its branch
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"fetch", "--quiet", "--depth=1", source, commit},
+		{"checkout", "--quiet", "FETCH_HEAD"},
+	} {
+		cmd := Command("git", args...)
+		cmd.Dir = repoDir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			os.RemoveAll(gopath)
+			return nil, "", nil, fmt.Errorf("git %s: %v: %s", args[0], err, bytes.TrimSpace(out))
+		}
+	}
+
+	// buildworker copies its environment from the master
+	// GOPATH, which it finds in the environment variable,
+	// so point it at the clone until the checks are done
+	oldGopath := os.Getenv("GOPATH")
+	os.Setenv("GOPATH", gopath)
+	restore := func() {
+		os.Setenv("GOPATH", oldGopath)
+		os.RemoveAll(gopath)
+	}
+	be, err := d.OpenEnv(commit, d.Plugins)
+	if err != nil {
+		restore()
+		return nil, "", nil, err
+	}
+	return be, repoDir, func() {
+		be.Close()
+		restore()
+	}, nil
+}
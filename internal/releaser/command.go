@@ -0,0 +1,72 @@
+package releaser
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// commandLog, if not nil, is told of each command
+// before it is run; see LogCommands.
+var commandLog Logger
+
+// LogCommands makes Command log every command it makes to
+// log, such as git, gpg, and docker, with secrets redacted
+// from the arguments as Redact does.
+func LogCommands(log Logger) {
+	commandLog = log
+}
+
+// Command is like exec.Command, but logs the command if
+// LogCommands was called. Commands are made just before
+// they are run, so they are logged in the order they run.
+func Command(name string, args ...string) *exec.Cmd {
+	if commandLog != nil {
+		commandLog.Infof("$ %s", redactCommand(name, args))
+	}
+	return exec.Command(name, args...)
+}
+
+// RunRedacted runs cmd with its output going to os.Stdout and
+// os.Stderr, with any secrets in it redacted as Redact does, so
+// that a command given a credential, such as git push with a
+// credential helper or docker login, can't print it. Stdout or
+// Stderr already set, such as to a terminal that a pager needs,
+// are left as they are.
+func RunRedacted(cmd *exec.Cmd) error {
+	var writers []*redactWriter
+	if cmd.Stdout == nil {
+		rw := &redactWriter{w: os.Stdout}
+		cmd.Stdout = rw
+		writers = append(writers, rw)
+	}
+	if cmd.Stderr == nil {
+		rw := &redactWriter{w: os.Stderr}
+		cmd.Stderr = rw
+		writers = append(writers, rw)
+	}
+	err := cmd.Run()
+	for _, rw := range writers {
+		rw.Flush()
+	}
+	return err
+}
+
+// redactCommand returns the command line of name with args,
+// quoted for sh, with any secrets in it redacted. Credential
+// helpers given as shell snippets, which may hold tokens,
+// are redacted as a whole.
+func redactCommand(name string, args []string) string {
+	words := []string{name}
+	for _, arg := range args {
+		arg = Redact(arg)
+		if strings.HasPrefix(arg, "credential.helper=!") {
+			arg = "credential.helper=REDACTED"
+		}
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`!*?&;|<>(){}[]~#") {
+			arg = shellQuote(arg)
+		}
+		words = append(words, arg)
+	}
+	return strings.Join(words, " ")
+}
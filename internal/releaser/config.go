@@ -0,0 +1,802 @@
+package releaser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config holds the settings for a deploy. Values may be
+// loaded from a JSON or TOML file with LoadConfig;
+// credentials set in the environment take precedence
+// over anything in the file.
+type Config struct {
+	GitHubToken  string `json:"github_token" toml:"github_token"`
+	DevportalID  string `json:"devportal_id" toml:"devportal_id"`   // account ID at caddyserver.com
+	DevportalKey string `json:"devportal_key" toml:"devportal_key"` // associated API key
+
+	// DevportalToken is the bearer token for environments
+	// that use bearer auth and don't have their own.
+	DevportalToken string `json:"devportal_token" toml:"devportal_token"`
+
+	// Provider is where releases are published: "github"
+	// (the default) or "gitlab".
+	Provider string `json:"provider" toml:"provider"`
+
+	GitHubOwner string `json:"github_owner" toml:"github_owner"` // the owner of the repository to publish to
+	GitHubRepo  string `json:"github_repo" toml:"github_repo"`   // the owner's repository to publish to
+	WebsiteURL  string `json:"website_url" toml:"website_url"`   // URL to the Caddy website
+
+	// NoBuildServer turns off the deploy to the Caddy build
+	// server, so only the tag and the release are made, and
+	// the devportal credentials and website_url are not needed.
+	NoBuildServer bool `json:"no_build_server" toml:"no_build_server"`
+
+	GitLabToken   string `json:"gitlab_token" toml:"gitlab_token"`
+	GitLabURL     string `json:"gitlab_url" toml:"gitlab_url"`         // URL of the GitLab instance
+	GitLabProject string `json:"gitlab_project" toml:"gitlab_project"` // path of the project to publish to, e.g. "mholt/caddy"
+
+	// TagPrefix begins the name of every release tag, such
+	// as "caddy/" for tags like "caddy/v1.2.3" in a monorepo.
+	// Only tags with the prefix are considered releases.
+	TagPrefix string `json:"tag_prefix" toml:"tag_prefix"`
+
+	// GoVersion is the version of Go that releases must be
+	// built with, such as "1.10" (any 1.10.x) or "1.10.3";
+	// if empty, any version will do.
+	GoVersion string `json:"go_version" toml:"go_version"`
+
+	// SkipPlatforms lists platforms not to build, each in
+	// the form "os/arch/arm"; any part may be left empty
+	// to match all values of that part. Platforms that
+	// buildworker does not support are always skipped.
+	SkipPlatforms []string `json:"skip_platforms" toml:"skip_platforms"`
+
+	// OnlyPlatforms, if not empty, lists the only platforms
+	// to build, each in the form "os/arch" or "os/arch/arm";
+	// SkipPlatforms is then ignored.
+	OnlyPlatforms []string `json:"only_platforms" toml:"only_platforms"`
+
+	// BuildTags are the build tags to build Caddy with.
+	BuildTags []string `json:"build_tags" toml:"build_tags"`
+
+	// LDFlags is a text/template that gives the linker flags
+	// to build Caddy with, such as "-X main.version={{.Version}}";
+	// see LDFlagsData for the fields available.
+	LDFlags string `json:"ldflags" toml:"ldflags"`
+
+	BuildConcurrency  int `json:"build_concurrency" toml:"build_concurrency"`
+	UploadConcurrency int `json:"upload_concurrency" toml:"upload_concurrency"`
+
+	// AverageBuildSeconds is how long a platform is expected
+	// to take to build, for estimating how long a release
+	// will take, if it hasn't been built on this machine yet.
+	AverageBuildSeconds float64 `json:"average_build_seconds" toml:"average_build_seconds"`
+
+	// TempDir is where build assets are staged while they
+	// upload; if empty, the system's temporary directory
+	// is used. See Config.StagingDir.
+	TempDir string `json:"temp_dir" toml:"temp_dir"`
+
+	// CheckCommands are extra shell commands to run in the
+	// Caddy repo after the built-in checks; each must exit
+	// successfully for the deploy to go ahead.
+	CheckCommands []string `json:"check_commands" toml:"check_commands"`
+
+	// Channels are the release channels that can be chosen
+	// for a deploy, keyed by name.
+	Channels map[string]ChannelConfig `json:"channels" toml:"channels"`
+
+	// Environments are the devportals that releases can be
+	// deployed to, such as production and staging, keyed
+	// by name.
+	Environments map[string]EnvironmentConfig `json:"environments" toml:"environments"`
+
+	// ReleaseBranch is the branch releases must be made
+	// from; if empty, either "master" or "main" is allowed.
+	ReleaseBranch string `json:"release_branch" toml:"release_branch"`
+
+	// SigningKey is the GPG key to sign the tag and, when
+	// signing is enabled, release assets with; if empty,
+	// git's and gpg's default keys are used.
+	SigningKey string `json:"signing_key" toml:"signing_key"`
+
+	// AllowedSigningKeys are the fingerprints of the GPG keys
+	// that may sign the tag; if any are set, a tag signed by
+	// any other key is not pushed. The fingerprint of either
+	// the signing subkey or its primary key will do.
+	AllowedSigningKeys []string `json:"allowed_signing_keys" toml:"allowed_signing_keys"`
+
+	// StableTag, if set, is the name of a signed tag that is
+	// moved to each release that isn't a pre-release, and
+	// force-pushed, so it always points at the latest one.
+	StableTag string `json:"stable_tag" toml:"stable_tag"`
+
+	// GPGPassphraseFile is the path to a file holding the
+	// passphrase (or PIN) of the signing key, which is given
+	// to gpg with loopback pinentry so that nobody needs to
+	// type it; if empty, gpg-agent must have it or ask for it.
+	GPGPassphraseFile string `json:"gpg_passphrase_file" toml:"gpg_passphrase_file"`
+
+	// GitRemote is the git remote that the tag is pushed
+	// to, "origin" by default.
+	GitRemote string `json:"git_remote" toml:"git_remote"`
+
+	// GitSSHKey is the path to an SSH private key to push
+	// with; if empty, ssh's usual keys are used.
+	GitSSHKey string `json:"git_ssh_key" toml:"git_ssh_key"`
+
+	// GitCredentialHelper is the git credential helper to
+	// push over HTTPS with, instead of any configured in git.
+	GitCredentialHelper string `json:"git_credential_helper" toml:"git_credential_helper"`
+
+	// AssetNameTemplate is a text/template that gives the
+	// name of each release asset; see AssetNameData for the
+	// fields available. If empty, buildworker's names are used.
+	AssetNameTemplate string `json:"asset_name_template" toml:"asset_name_template"`
+
+	// HomebrewTap is the git URL of the Homebrew tap to
+	// push the formula to after a release; if empty, the
+	// formula is only written to HomebrewFormulaPath in
+	// the current directory.
+	HomebrewTap string `json:"homebrew_tap" toml:"homebrew_tap"`
+
+	// HomebrewFormulaPath is the path of the formula file
+	// in the tap.
+	HomebrewFormulaPath string `json:"homebrew_formula_path" toml:"homebrew_formula_path"`
+
+	// HomebrewTemplate is the path to a text/template file
+	// for the formula; see HomebrewData for the fields
+	// available. If empty, a built-in template is used.
+	HomebrewTemplate string `json:"homebrew_template" toml:"homebrew_template"`
+
+	// MilestoneTags suggests the titles of open milestones
+	// that are versions, such as "v1.2.0", as the tag of a
+	// new release, and CloseMilestone closes the milestone
+	// of the tag chosen once it has been released.
+	MilestoneTags  bool `json:"milestone_tags" toml:"milestone_tags"`
+	CloseMilestone bool `json:"close_milestone" toml:"close_milestone"`
+
+	// ReleaseBodyTemplate is the path to a text/template file
+	// for the release notes rendered once the assets are
+	// uploaded; see ReleaseBodyData for the fields available.
+	// If empty, a built-in template is used.
+	ReleaseBodyTemplate string `json:"release_body_template" toml:"release_body_template"`
+
+	// DockerImage is the name of the Docker image to push,
+	// such as "caddy/caddy", in DockerRegistry (Docker Hub
+	// if empty). DockerUsername and DockerPassword, if set,
+	// are used to log in to the registry first.
+	DockerImage    string `json:"docker_image" toml:"docker_image"`
+	DockerRegistry string `json:"docker_registry" toml:"docker_registry"`
+	DockerUsername string `json:"docker_username" toml:"docker_username"`
+	DockerPassword string `json:"docker_password" toml:"docker_password"`
+
+	// DockerPlatforms are the platforms to build the Docker
+	// image for, in Docker's form, e.g. "linux/arm/v7". Each
+	// must be one of the platforms being released.
+	DockerPlatforms []string `json:"docker_platforms" toml:"docker_platforms"`
+
+	// The S3-compatible bucket to mirror release assets to,
+	// if enabled. Each release's assets are put under
+	// S3Prefix followed by the tag and a slash.
+	S3Endpoint  string `json:"s3_endpoint" toml:"s3_endpoint"`
+	S3Region    string `json:"s3_region" toml:"s3_region"`
+	S3Bucket    string `json:"s3_bucket" toml:"s3_bucket"`
+	S3Prefix    string `json:"s3_prefix" toml:"s3_prefix"`
+	S3AccessKey string `json:"s3_access_key" toml:"s3_access_key"`
+	S3SecretKey string `json:"s3_secret_key" toml:"s3_secret_key"`
+
+	// WebhookURL, if set, is sent a JSON notification
+	// when the deploy succeeds or fails.
+	WebhookURL string `json:"webhook_url" toml:"webhook_url"`
+}
+
+// ChannelConfig describes a release channel, such as
+// stable or edge, which determines where and how a
+// release is deployed.
+type ChannelConfig struct {
+	// Name is the name of the channel in the configuration;
+	// it is set by Config.Channel.
+	Name string `json:"-" toml:"-"`
+
+	// WebsiteURL is the URL of the build server for this
+	// channel; if empty, the top-level website_url is used
+	// (filled in by Config.Channel).
+	WebsiteURL string `json:"website_url" toml:"website_url"`
+
+	// DeployPath is the path on the build server to which
+	// deploy requests for this channel are sent.
+	DeployPath string `json:"deploy_path" toml:"deploy_path"`
+
+	// Prerelease, if set, overrides whether releases in this
+	// channel are marked as pre-releases on GitHub; otherwise
+	// it is inferred from the tag.
+	Prerelease *bool `json:"prerelease" toml:"prerelease"`
+
+	// DeployPrereleases deploys pre-releases to the build
+	// server, which is normally only done for releases.
+	DeployPrereleases bool `json:"deploy_prereleases" toml:"deploy_prereleases"`
+}
+
+// Channel returns the configuration of the release
+// channel with the given name, with its name and
+// website URL filled in.
+func (cfg Config) Channel(name string) (ChannelConfig, error) {
+	ch, ok := cfg.Channels[name]
+	if !ok {
+		return ch, fmt.Errorf("unknown release channel %q", name)
+	}
+	ch.Name = name
+	if ch.WebsiteURL == "" {
+		ch.WebsiteURL = cfg.WebsiteURL
+	}
+	return ch, nil
+}
+
+// DeployURL returns the URL to which build server
+// deploy requests for the channel are sent: the deploy
+// path joined to the path of the website URL, if any.
+func (ch ChannelConfig) DeployURL() (string, error) {
+	return joinURL(ch.WebsiteURL, ch.DeployPath)
+}
+
+// joinURL returns the http or https URL base with each of
+// elem joined to its path, so that there is exactly one
+// slash between them, whatever slashes each has.
+func joinURL(base string, elem ...string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("URL %q must begin with http:// or https://", base)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("URL %q has no host", base)
+	}
+	u.Path = path.Join(append([]string{"/", u.Path}, elem...)...)
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// IsLoopbackURL returns true if the host of rawurl is
+// localhost or a loopback address, which a real build
+// server never is.
+func IsLoopbackURL(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+// EnvironmentConfig describes a devportal that the build
+// server deploy can be sent to, and how to authenticate
+// with it.
+type EnvironmentConfig struct {
+	// Name is the name of the environment in the
+	// configuration; it is set by Config.Environment.
+	Name string `json:"-" toml:"-"`
+
+	// WebsiteURL, if set, is used instead of the channel's
+	// website URL.
+	WebsiteURL string `json:"website_url" toml:"website_url"`
+
+	// DeployPath, if set, is used instead of the channel's
+	// deploy path.
+	DeployPath string `json:"deploy_path" toml:"deploy_path"`
+
+	// Auth is how requests are authenticated: "basic" (the
+	// default), with the account ID and API key, or "bearer",
+	// with the token.
+	Auth string `json:"auth" toml:"auth"`
+
+	// Credentials for the environment; any that are empty
+	// are filled in from the top-level ones by
+	// Config.Environment.
+	DevportalID    string `json:"devportal_id" toml:"devportal_id"`
+	DevportalKey   string `json:"devportal_key" toml:"devportal_key"`
+	DevportalToken string `json:"devportal_token" toml:"devportal_token"`
+}
+
+// Secrets returns the credentials in cfg, including those
+// of every environment, the git credential helper (which
+// may embed a token), and the GPG passphrase, which must
+// never be logged. Some may be empty.
+func (cfg Config) Secrets() []string {
+	secrets := []string{
+		cfg.GitHubToken,
+		cfg.DevportalKey,
+		cfg.DevportalToken,
+		cfg.GitLabToken,
+		cfg.DockerPassword,
+		cfg.S3SecretKey,
+		cfg.GitCredentialHelper,
+	}
+	for _, env := range cfg.Environments {
+		secrets = append(secrets, env.DevportalKey, env.DevportalToken)
+	}
+	if cfg.GPGPassphraseFile != "" {
+		// gpg reads only the first line of the file; a
+		// missing file is reported by ValidateConfig
+		if data, err := ioutil.ReadFile(cfg.GPGPassphraseFile); err == nil {
+			line := strings.SplitN(string(data), "\n", 2)[0]
+			secrets = append(secrets, strings.TrimRight(line, "\r"))
+		}
+	}
+	return secrets
+}
+
+// Environment returns the configuration of the environment
+// with the given name, with its name, auth method, and
+// missing credentials filled in.
+func (cfg Config) Environment(name string) (EnvironmentConfig, error) {
+	env, ok := cfg.Environments[name]
+	if !ok {
+		return env, fmt.Errorf("unknown environment %q", name)
+	}
+	env.Name = name
+	if env.Auth == "" {
+		env.Auth = "basic"
+	}
+	if env.DevportalID == "" {
+		env.DevportalID = cfg.DevportalID
+	}
+	if env.DevportalKey == "" {
+		env.DevportalKey = cfg.DevportalKey
+	}
+	if env.DevportalToken == "" {
+		env.DevportalToken = cfg.DevportalToken
+	}
+	return env, nil
+}
+
+// DeployURL returns the URL to which build server deploy
+// requests for channel ch are sent in the environment.
+func (env EnvironmentConfig) DeployURL(ch ChannelConfig) (string, error) {
+	if env.WebsiteURL != "" {
+		ch.WebsiteURL = env.WebsiteURL
+	}
+	if env.DeployPath != "" {
+		ch.DeployPath = env.DeployPath
+	}
+	return ch.DeployURL()
+}
+
+// CheckCredentials asserts that the credentials needed
+// by the environment's auth method are set.
+func (env EnvironmentConfig) CheckCredentials() error {
+	var problems []string
+	switch env.Auth {
+	case "basic":
+		if env.DevportalID == "" {
+			problems = append(problems, fmt.Sprintf("devportal account ID is required (%s or devportal_id)", env.credentialVar("ID")))
+		}
+		if env.DevportalKey == "" {
+			problems = append(problems, fmt.Sprintf("devportal API key is required (%s or devportal_key)", env.credentialVar("KEY")))
+		}
+	case "bearer":
+		if env.DevportalToken == "" {
+			problems = append(problems, fmt.Sprintf("devportal token is required (%s or devportal_token)", env.credentialVar("TOKEN")))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown auth method %q (must be basic or bearer)", env.Auth))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid credentials for the %s environment:\n  - %s", env.Name, strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// credentialVar returns the name of the environment
+// variable holding the given credential for env, such
+// as DEVPORTAL_STAGING_TOKEN.
+func (env EnvironmentConfig) credentialVar(credential string) string {
+	return environmentVar(env.Name, credential)
+}
+
+// environmentVar returns the name of the environment
+// variable holding the given credential for the
+// environment with the given name.
+func environmentVar(name, credential string) string {
+	name = strings.ToUpper(strings.Replace(name, "-", "_", -1))
+	return "DEVPORTAL_" + name + "_" + credential
+}
+
+// authorize adds the environment's credentials to req.
+func (env EnvironmentConfig) authorize(req *http.Request) {
+	if env.Auth == "bearer" {
+		req.Header.Set("Authorization", "Bearer "+env.DevportalToken)
+		return
+	}
+	req.SetBasicAuth(env.DevportalID, env.DevportalKey)
+}
+
+// DeploysToBuildServer returns true if a release in this
+// channel should be deployed to the build server.
+func (ch ChannelConfig) DeploysToBuildServer(prerelease bool) bool {
+	return !prerelease || ch.DeployPrereleases
+}
+
+// IsPrerelease returns true if the release for tag should
+// be a pre-release in this channel: the channel decides if
+// it is configured to, otherwise the tag does.
+func (ch ChannelConfig) IsPrerelease(tag string) bool {
+	if ch.Prerelease != nil {
+		return *ch.Prerelease
+	}
+	return IsPrerelease(tag)
+}
+
+// DefaultConfig returns the configuration used when
+// no config file overrides it.
+func DefaultConfig() Config {
+	return Config{
+		Provider:          "github",
+		GitHubOwner:       "mholt",
+		GitHubRepo:        "caddy",
+		WebsiteURL:        "https://caddyserver.com",
+		GitLabURL:         "https://gitlab.com",
+		S3Endpoint:        "https://s3.amazonaws.com",
+		S3Region:          "us-east-1",
+		BuildConcurrency:  2,
+		UploadConcurrency: 3,
+
+		GitRemote: "origin",
+
+		HomebrewFormulaPath: "Formula/caddy.rb",
+
+		DockerPlatforms: []string{"linux/amd64", "linux/arm64", "linux/arm/v7"},
+
+		Environments: map[string]EnvironmentConfig{
+			"production": {Auth: "basic"},
+		},
+
+		Channels: map[string]ChannelConfig{
+			"stable": {
+				DeployPath: "/api/deploy-caddy",
+			},
+			"edge": {
+				DeployPath:        "/api/deploy-caddy-edge",
+				Prerelease:        boolPtr(true),
+				DeployPrereleases: true,
+			},
+		},
+
+		// the demand for Caddy on these platforms is very low
+		// and the demand on the CPU is very high
+		SkipPlatforms: []string{
+			"dragonfly",
+			"solaris",
+			"netbsd",
+			"//5",
+			"//6",
+			"darwin/386",
+			"darwin/arm64",
+			"/mips64",
+			"/mips64le",
+			"/ppc64",
+			"/ppc64le",
+			"openbsd/386",
+			"openbsd/arm",
+			"freebsd/386",
+			"freebsd/arm",
+		},
+	}
+}
+
+// decodeConfig decodes data, the contents of the config file
+// at path, over cfg. Each channel in the file is overlaid on
+// the channel of the same name in cfg, if any, field by field
+// rather than replacing it, so that a default channel can be
+// changed by giving only the fields that differ.
+func decodeConfig(path string, data []byte, cfg *Config) error {
+	channels := make(map[string]ChannelConfig, len(cfg.Channels))
+	for name, ch := range cfg.Channels {
+		channels[name] = ch
+	}
+
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		if _, err := toml.Decode(string(data), cfg); err != nil {
+			return err
+		}
+		var file struct {
+			Channels map[string]toml.Primitive `toml:"channels"`
+		}
+		md, err := toml.Decode(string(data), &file)
+		if err != nil {
+			return err
+		}
+		for name, prim := range file.Channels {
+			ch := channels[name]
+			if err := md.PrimitiveDecode(prim, &ch); err != nil {
+				return err
+			}
+			channels[name] = ch
+		}
+	} else {
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return err
+		}
+		var file struct {
+			Channels map[string]json.RawMessage `json:"channels"`
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return err
+		}
+		for name, raw := range file.Channels {
+			ch := channels[name]
+			if err := json.Unmarshal(raw, &ch); err != nil {
+				return err
+			}
+			channels[name] = ch
+		}
+	}
+
+	cfg.Channels = channels
+	return nil
+}
+
+// LoadConfig returns the default configuration, overlaid
+// with the contents of the file at path (if path is not
+// empty), overlaid with any credentials in the environment.
+// Files ending in .toml are decoded as TOML; all others
+// are decoded as JSON.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("opening config file: %w", err)
+		}
+		if err := decodeConfig(path, data, &cfg); err != nil {
+			return cfg, fmt.Errorf("decoding config file %s: %w", path, err)
+		}
+	}
+
+	if v := os.Getenv("GITHUB_TOKEN"); v != "" {
+		cfg.GitHubToken = v
+	}
+	if v := os.Getenv("GITLAB_TOKEN"); v != "" {
+		cfg.GitLabToken = v
+	}
+	if v := os.Getenv("DOCKER_PASSWORD"); v != "" {
+		cfg.DockerPassword = v
+	}
+	if v := os.Getenv("AWS_ACCESS_KEY_ID"); v != "" {
+		cfg.S3AccessKey = v
+	}
+	if v := os.Getenv("AWS_SECRET_ACCESS_KEY"); v != "" {
+		cfg.S3SecretKey = v
+	}
+	if v := os.Getenv("DEVPORTAL_ID"); v != "" {
+		cfg.DevportalID = v
+	}
+	if v := os.Getenv("DEVPORTAL_KEY"); v != "" {
+		cfg.DevportalKey = v
+	}
+	if v := os.Getenv("DEVPORTAL_TOKEN"); v != "" {
+		cfg.DevportalToken = v
+	}
+	for name, env := range cfg.Environments {
+		if v := os.Getenv(environmentVar(name, "ID")); v != "" {
+			env.DevportalID = v
+		}
+		if v := os.Getenv(environmentVar(name, "KEY")); v != "" {
+			env.DevportalKey = v
+		}
+		if v := os.Getenv(environmentVar(name, "TOKEN")); v != "" {
+			env.DevportalToken = v
+		}
+		cfg.Environments[name] = env
+	}
+
+	return cfg, nil
+}
+
+// ValidateConfig asserts that all required values are set
+// and that the rest are sane. Rather than stopping at the
+// first problem, it reports everything that is wrong.
+func ValidateConfig(cfg Config) error {
+	var problems []string
+	switch cfg.Provider {
+	case "github":
+		if cfg.GitHubToken == "" {
+			problems = append(problems, "GitHub token is required (GITHUB_TOKEN or github_token)")
+		}
+		if cfg.GitHubOwner == "" {
+			problems = append(problems, "github_owner cannot be empty")
+		}
+		if cfg.GitHubRepo == "" {
+			problems = append(problems, "github_repo cannot be empty")
+		}
+	case "gitlab":
+		if cfg.GitLabToken == "" {
+			problems = append(problems, "GitLab token is required (GITLAB_TOKEN or gitlab_token)")
+		}
+		if cfg.GitLabURL == "" {
+			problems = append(problems, "gitlab_url cannot be empty")
+		}
+		if cfg.GitLabProject == "" {
+			problems = append(problems, "gitlab_project cannot be empty")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown provider %q (must be github or gitlab)", cfg.Provider))
+	}
+	if cfg.NoBuildServer {
+		// the build server is the only thing website_url is for
+	} else if cfg.WebsiteURL == "" {
+		problems = append(problems, "website_url cannot be empty")
+	} else if _, err := joinURL(cfg.WebsiteURL); err != nil {
+		problems = append(problems, fmt.Sprintf("website_url: %v", err))
+	}
+	for _, s := range cfg.SkipPlatforms {
+		if _, err := ParsePlatform(s); err != nil {
+			problems = append(problems, fmt.Sprintf("skip_platforms: %v", err))
+		}
+	}
+	for _, tag := range cfg.BuildTags {
+		if tag == "" || strings.ContainsAny(tag, ", \t") {
+			problems = append(problems, fmt.Sprintf("build_tags: invalid build tag %q", tag))
+		}
+	}
+	for name, ch := range cfg.Channels {
+		if ch.DeployPath == "" {
+			problems = append(problems, fmt.Sprintf("channels.%s.deploy_path cannot be empty", name))
+		}
+		if ch.WebsiteURL != "" {
+			if _, err := joinURL(ch.WebsiteURL); err != nil {
+				problems = append(problems, fmt.Sprintf("channels.%s.website_url: %v", name, err))
+			}
+		}
+	}
+	for name, env := range cfg.Environments {
+		if env.Auth != "" && env.Auth != "basic" && env.Auth != "bearer" {
+			problems = append(problems, fmt.Sprintf("environments.%s.auth: unknown auth method %q (must be basic or bearer)", name, env.Auth))
+		}
+		if env.WebsiteURL != "" {
+			if _, err := joinURL(env.WebsiteURL); err != nil {
+				problems = append(problems, fmt.Sprintf("environments.%s.website_url: %v", name, err))
+			}
+		}
+	}
+	if cfg.GPGPassphraseFile != "" {
+		if _, err := os.Stat(cfg.GPGPassphraseFile); err != nil {
+			problems = append(problems, fmt.Sprintf("gpg_passphrase_file: %v", err))
+		}
+	}
+	for _, fpr := range cfg.AllowedSigningKeys {
+		if !fingerprintRe.MatchString(normalizeFingerprint(fpr)) {
+			problems = append(problems, fmt.Sprintf("allowed_signing_keys: %q is not a full key fingerprint", fpr))
+		}
+	}
+	if cfg.StableTag != "" {
+		if err := validStableTag(cfg.StableTag, cfg.TagPrefix); err != nil {
+			problems = append(problems, fmt.Sprintf("stable_tag: %v", err))
+		}
+	}
+	if cfg.CloseMilestone && !cfg.MilestoneTags {
+		problems = append(problems, "close_milestone needs milestone_tags")
+	}
+	if cfg.GitRemote == "" {
+		problems = append(problems, "git_remote cannot be empty")
+	}
+	if cfg.GitSSHKey != "" {
+		if _, err := os.Stat(cfg.GitSSHKey); err != nil {
+			problems = append(problems, fmt.Sprintf("git_ssh_key: %v", err))
+		}
+	}
+	if cfg.HomebrewFormulaPath == "" {
+		problems = append(problems, "homebrew_formula_path cannot be empty")
+	}
+	if cfg.BuildConcurrency < 1 {
+		problems = append(problems, "build_concurrency must be at least 1")
+	}
+	if cfg.UploadConcurrency < 1 {
+		problems = append(problems, "upload_concurrency must be at least 1")
+	}
+	if cfg.AverageBuildSeconds < 0 {
+		problems = append(problems, "average_build_seconds cannot be negative")
+	}
+	if os.Getenv("GOPATH") == "" {
+		problems = append(problems, "environment variable GOPATH cannot be empty")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// NewS3Mirror returns the configured S3 mirror, or an
+// error listing the settings that are missing.
+func (cfg Config) NewS3Mirror() (*S3Mirror, error) {
+	var problems []string
+	if cfg.S3Endpoint == "" {
+		problems = append(problems, "s3_endpoint cannot be empty")
+	}
+	if cfg.S3Region == "" {
+		problems = append(problems, "s3_region cannot be empty")
+	}
+	if cfg.S3Bucket == "" {
+		problems = append(problems, "s3_bucket cannot be empty")
+	}
+	if cfg.S3AccessKey == "" || cfg.S3SecretKey == "" {
+		problems = append(problems, "S3 credentials are required (AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or s3_access_key and s3_secret_key)")
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid S3 configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return &S3Mirror{
+		Endpoint:  cfg.S3Endpoint,
+		Region:    cfg.S3Region,
+		Bucket:    cfg.S3Bucket,
+		Prefix:    cfg.S3Prefix,
+		AccessKey: cfg.S3AccessKey,
+		SecretKey: cfg.S3SecretKey,
+	}, nil
+}
+
+// StagingDir returns the directory in which the temporary
+// folder for build assets is made.
+func (cfg Config) StagingDir() string {
+	if cfg.TempDir != "" {
+		return cfg.TempDir
+	}
+	return os.TempDir()
+}
+
+// CheckStagingDir asserts that the staging directory exists
+// and that files can be written to it.
+func (cfg Config) CheckStagingDir() error {
+	dir := cfg.StagingDir()
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("temporary directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("temporary directory %s is not a directory", dir)
+	}
+	f, err := ioutil.TempFile(dir, "caddy_deployment_check_")
+	if err != nil {
+		return fmt.Errorf("temporary directory %s is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// NewProvider returns the provider to publish
+// releases to, as configured, which logs to log.
+func (cfg Config) NewProvider(log Logger) (Provider, error) {
+	switch cfg.Provider {
+	case "github":
+		p := NewGitHubProvider(cfg.GitHubToken, cfg.GitHubOwner, cfg.GitHubRepo)
+		p.Log = log
+		return p, nil
+	case "gitlab":
+		return &GitLabProvider{
+			BaseURL: cfg.GitLabURL,
+			Project: cfg.GitLabProject,
+			Token:   cfg.GitLabToken,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown provider %q", cfg.Provider)
+}
+
+func boolPtr(b bool) *bool { return &b }
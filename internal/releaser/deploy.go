@@ -0,0 +1,1012 @@
+// Package releaser implements the steps of a Caddy release:
+// checking Caddy, tagging the release, building it for each
+// platform, publishing it on GitHub, and deploying it to the
+// Caddy build server. The release-caddy command wires it up
+// to flags and interactive prompts.
+package releaser
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// Logger is where a Deployer writes its log messages.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Deployer releases Caddy. Its fields are the dependencies
+// and options of a deploy; all must be set except where
+// noted otherwise.
+type Deployer struct {
+	Config      Config
+	Channel     ChannelConfig     // the channel to deploy to; see Config.Channel
+	Environment EnvironmentConfig // the devportal to deploy to; see Config.Environment
+	RepoDir     string            // path to the Caddy repository to release
+	OpenEnv     EnvFactory        // normally OpenBuildworker
+	Log         Logger
+
+	// Provider is where the release is published, for
+	// example a GitHubProvider.
+	Provider Provider
+
+	// TagWait is how long to wait for a pushed tag
+	// to become visible on GitHub.
+	TagWait time.Duration
+
+	// DeployTimeout is how long to wait for the build
+	// server to confirm that a deploy has gone live.
+	DeployTimeout time.Duration
+
+	// BuildRetries and UploadRetries are how many more times
+	// to try building a platform, or uploading a file, after
+	// it fails. RetryBackoff is how long to wait before the
+	// first retry; the wait doubles with each one after that.
+	BuildRetries  int
+	UploadRetries int
+	RetryBackoff  time.Duration
+
+	// SignAssets enables uploading a detached GPG
+	// signature for each asset and the checksums file.
+	SignAssets bool
+
+	// NoSigningPrompt makes signing fail, rather than wait
+	// for a passphrase, if gpg-agent doesn't have it cached
+	// and there is no passphrase file; set it when nobody
+	// is there to type the passphrase.
+	NoSigningPrompt bool
+
+	// DeleteUnverifiedTag deletes the tag, which hasn't been
+	// pushed, if it isn't signed by one of the configured
+	// AllowedSigningKeys, so that it can be made again.
+	DeleteUnverifiedTag bool
+
+	// ReplaceExisting replaces release assets that
+	// already exist, rather than skipping them.
+	ReplaceExisting bool
+
+	// VerifyUploads downloads each uploaded asset to check
+	// its SHA-256, not just its size, if the provider can.
+	VerifyUploads bool
+
+	// VerifyDownloads checks that each asset can be
+	// downloaded from its public URL once the release
+	// is published, before anything else is done.
+	VerifyDownloads bool
+
+	// UpdateGopath updates the master GOPATH before the
+	// checks, as the build server does before a deploy.
+	// It is off by default because it overwrites packages
+	// in the operator's GOPATH and can't be undone.
+	UpdateGopath bool
+
+	// SkipChecks skips CheckCaddy on a new deploy, so
+	// the release is made without running any checks.
+	SkipChecks bool
+
+	// IsolatedChecks runs the checks in a shallow clone of
+	// the commit in a temporary GOPATH, which is removed
+	// afterwards, rather than against the master GOPATH.
+	IsolatedChecks bool
+
+	// VerboseChecks streams the log of the checks to
+	// stdout as they run.
+	VerboseChecks bool
+
+	// ChecksCache, if set, is the path of a file that records
+	// the commit whose checks last passed, so CheckCaddy can
+	// skip them for the same commit. ForceChecks runs them
+	// anyway, still recording the result.
+	ChecksCache string
+	ForceChecks bool
+
+	// StateFile, if set, is the path of a file that records
+	// the release made for a tag, so that resuming the deploy
+	// finds that release by its ID rather than making another.
+	StateFile string
+
+	// KeepAssets, if set, is a directory into which each
+	// asset, with its signature, is moved once it has been
+	// uploaded, and the checksums file written, so that the
+	// published files are kept. It must exist.
+	KeepAssets string
+
+	// ReleaseID, if set, is the ID of a release made outside
+	// of the deploy, such as by a CI workflow, which a deploy
+	// from StageUpload uploads to instead of the release made
+	// for the tag. Its tag must be the one being deployed.
+	ReleaseID int64
+
+	// HomebrewFormula, if not nil, is rendered into a
+	// Homebrew formula after a release that is not a
+	// pre-release; see ParseHomebrewTemplate and
+	// UpdateHomebrew.
+	HomebrewFormula *template.Template
+
+	// Milestone, if not nil, is the milestone of the
+	// release, which is closed once it is released.
+	Milestone *Milestone
+
+	// ReleaseBody, if not nil, is rendered into new release
+	// notes once the assets are uploaded, and replaces the
+	// ones the release was made with; see
+	// ParseReleaseBodyTemplate.
+	ReleaseBody *template.Template
+
+	// PushDocker builds a Docker image from the Linux
+	// binaries once the release is published, and pushes
+	// it to the configured registry; see PushDockerImage.
+	PushDocker bool
+
+	// S3, if not nil, is a bucket to which every asset is
+	// also uploaded, in a folder named for the tag.
+	S3 *S3Mirror
+
+	// SkipRelease skips creating a release on the Provider,
+	// so assets are only uploaded to S3.
+	SkipRelease bool
+
+	// PerAssetChecksums uploads, next to each asset, a file
+	// with its own SHA-256, named for the asset with .sha256
+	// added, as well as the combined checksums file.
+	PerAssetChecksums bool
+
+	// Commit is the commit to check and tag on a new
+	// deploy; if empty, it is the current commit (HEAD).
+	Commit string
+
+	// NoPush stops a new deploy once the tag is made
+	// locally, so it can be reviewed before it is pushed;
+	// the deploy can then be resumed at StagePush.
+	NoPush bool
+
+	// MaxFailures is how many platforms may fail to build
+	// or upload while the release is still published without
+	// them; if more fail, the deploy fails. By default, any
+	// failure fails the deploy.
+	MaxFailures int
+
+	// FailFast stops starting builds, and cancels uploads in
+	// progress, as soon as more than MaxFailures platforms
+	// have failed, rather than finishing all the others
+	// first to report every failure.
+	FailFast bool
+
+	// ReportProgress, if not nil, is called frequently
+	// with the progress of the uploads in progress while
+	// assets are uploaded, and with nil when they're done.
+	ReportProgress func([]UploadProgress)
+
+	// TagMessage is the annotation of the new tag; if
+	// empty, it is "Release <tag>" and the changelog
+	// since the previous tag.
+	TagMessage string
+
+	// IncludeSource uploads an archive of the source
+	// at the tag along with the binaries.
+	IncludeSource bool
+
+	// Plugins are built into Caddy, both for the checks
+	// and for the release; see LoadPlugins.
+	Plugins []buildworker.CaddyPlugin
+
+	// AssetNames gives the name of each release asset; see
+	// ParseAssetNameTemplate. If nil, buildworker's names
+	// are used.
+	AssetNames *template.Template
+
+	// IncludePrereleases makes pre-release tags count as
+	// the previous release when making the changelog in
+	// the tag message; see PreviousTag.
+	IncludePrereleases bool
+
+	// LDFlags gives the linker flags to build with; see
+	// ParseLDFlagsTemplate. If nil, none are added.
+	LDFlags *template.Template
+}
+
+// recordCommit records in result the commit that
+// result.Tag points to.
+func (d *Deployer) recordCommit(result *Result) error {
+	commit, short, err := TagCommit(d.RepoDir, result.Tag)
+	if err != nil {
+		return err
+	}
+	result.Commit, result.ShortCommit = commit, short
+	d.Log.Infof("%s is at commit %s", result.Tag, commit)
+	return nil
+}
+
+// Deploy runs checks on caddy, and if they succeed, tags
+// the current commit and releases Caddy. Pass in the name
+// of the tag, whether it is a pre-release, the platforms
+// to build, and the stage at which to start: StageNew for
+// a new deploy, or a later stage to resume one. The result
+// is returned even if there is an error, describing how
+// far the deploy got.
+//
+// If ctx is cancelled, the deploy stops as soon as it can,
+// with an error of kind ErrInterrupted. Builds and uploads
+// in progress are given interruptGrace to stop.
+func (d *Deployer) Deploy(ctx context.Context, tag string, prerelease bool, platforms []buildworker.Platform, stage Stage) (*Result, error) {
+	result := &Result{
+		Tag:             tag,
+		Prerelease:      prerelease,
+		TagPushed:       stage != StageNew && stage != StagePush,
+		Plugins:         pluginList(d.Plugins),
+		BuildDurations:  make(map[string]float64),
+		UploadDurations: make(map[string]float64),
+	}
+
+	// a resumed deploy's tag was already made
+	if stage != StageNew {
+		if err := d.recordCommit(result); err != nil {
+			return result, err
+		}
+	}
+
+	// everything but the build server deploy is already done
+	if stage == StageBuildServer {
+		if d.Config.NoBuildServer {
+			return result, fmt.Errorf("the build server deploy is turned off (no_build_server or -no-build-server)")
+		}
+		if !d.Channel.DeploysToBuildServer(prerelease) {
+			return result, fmt.Errorf("%s is a pre-release; pre-releases are not deployed to the build server in the %s channel", tag, d.Channel.Name)
+		}
+		assets, err := d.publishedAssets(ctx, tag)
+		if err != nil {
+			d.Log.Warnf("Could not get the release's assets to send to the build server: %v", err)
+		}
+		result.Assets = assets
+		return result, d.ReleaseToBuildServer(ctx, tag, result)
+	}
+
+	// make sure of the toolchain before anything is tagged
+	goVersion, err := d.checkGoVersion()
+	if err != nil {
+		return result, err
+	}
+	result.GoVersion = goVersion
+
+	// and that the tag and assets can be signed, before
+	// the checks, which take a while, rather than after
+	if stage == StageNew || d.SignAssets {
+		d.Log.Infof("Checking that gpg can sign")
+		if err := d.CheckSigning(); err != nil {
+			return result, &DeployError{Kind: ErrPreflight, Msg: "signing", Err: err}
+		}
+	}
+
+	if stage == StageNew {
+		d.Log.Infof("Preparing to deploy new tag: %s", tag)
+
+		// run checks to make sure it, you know, works.
+		if d.SkipChecks {
+			d.Log.Warnf("SKIPPING CHECKS: releasing %s without running tests or build checks", tag)
+		} else {
+			err := d.CheckCaddy()
+			if err := interrupted(ctx); err != nil {
+				return result, err
+			}
+			if err != nil {
+				return result, &DeployError{Kind: ErrChecksFailed, Msg: "checks", Err: err}
+			}
+		}
+
+		// don't clobber a release that's already been made
+		exists, err := TagExists(d.RepoDir, tag)
+		if err != nil {
+			return result, fmt.Errorf("checking for existing tag: %w", err)
+		}
+		if exists {
+			return result, &DeployError{Kind: ErrTagExists, Msg: "tag " + tag + " already exists"}
+		}
+
+		// last chance to stop before anything is published
+		if err := interrupted(ctx); err != nil {
+			return result, err
+		}
+
+		// the passphrase may have left gpg-agent's cache while
+		// the checks ran; git can't be told where to get it
+		if err := d.CheckSigning(); err != nil {
+			return result, &DeployError{Kind: ErrTagPush, Msg: "signing tag", Err: err}
+		}
+
+		// git tag (signed)
+		d.Log.Infof("Tagging release")
+		message := d.TagMessage
+		if message == "" {
+			message = d.defaultTagMessage(tag)
+		}
+		args := []string{"tag", "-s", tag, "-m", message}
+		if d.Config.SigningKey != "" {
+			args = []string{"tag", "-u", d.Config.SigningKey, tag, "-m", message}
+		}
+		if d.Commit != "" {
+			args = append(args, d.Commit)
+		}
+		err = d.run("git", args...)
+		if err != nil {
+			return result, &DeployError{Kind: ErrTagPush, Msg: "creating signed tag", Err: err}
+		}
+		if err := d.recordCommit(result); err != nil {
+			return result, err
+		}
+		if err := d.verifyTagSigner(tag); err != nil {
+			return result, &DeployError{Kind: ErrTagPush, Msg: "verifying tag signature", Err: err}
+		}
+
+		if d.NoPush {
+			d.Log.Infof("Tag %s was made locally; not pushing it", tag)
+			return result, nil
+		}
+	}
+
+	if stage == StagePush {
+		// the tag was made by an earlier deploy
+		if err := d.verifyTagSigner(tag); err != nil {
+			return result, &DeployError{Kind: ErrTagPush, Msg: "verifying tag signature", Err: err}
+		}
+	}
+
+	if stage == StageNew || stage == StagePush {
+		// git push
+		d.Log.Infof("Pushing tag")
+		err := d.push()
+		if err != nil {
+			return result, &DeployError{Kind: ErrTagPush, Msg: "git push", Err: err}
+		}
+
+		// git push tag; only the release tag if there is a
+		// stable tag, since the local one may be behind the
+		// remote's if another deploy has moved it since
+		d.Log.Infof("Pushing any remaining commits")
+		tagRefs := []string{"--tags"}
+		if d.Config.StableTag != "" {
+			tagRefs = []string{"refs/tags/" + tag}
+		}
+		err = d.push(tagRefs...)
+		if err != nil {
+			return result, &DeployError{Kind: ErrTagPush, Msg: "pushing tag", Err: err}
+		}
+		result.TagPushed = true
+
+		// Wait before creating the release; I've seen the API call
+		// to publish a release on GitHub fail with "Published releases must
+		// have a valid tag" even after pushing the tag. I suspect that their
+		// system must be only "eventually consistent" so by waiting until
+		// GitHub reports the tag, we'll avoid any sort of race condition
+		// they have.
+		if !d.SkipRelease {
+			d.Log.Infof("Waiting for %s to see the new tag...", d.Provider.Name())
+			err = d.WaitForTag(ctx, tag, d.TagWait)
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	// create release (as a draft, if the provider has them),
+	// or find the one already created if resuming at upload
+	var release *Release
+	if !d.SkipRelease && stage == StageUpload {
+		d.Log.Infof("Finding release on %s", d.Provider.Name())
+		var err error
+		release, err = d.findRelease(ctx, tag)
+		if err != nil {
+			return result, &DeployError{Kind: ErrReleaseCreate, Msg: "finding release", Err: err}
+		}
+		if release == nil {
+			return result, &DeployError{Kind: ErrReleaseCreate, Msg: "there is no release for " + tag + " to upload to; resume at release instead"}
+		}
+		result.ReleaseID = release.ID
+		result.ReleaseURL = release.URL
+	} else if !d.SkipRelease {
+		// an earlier attempt may have made the release even
+		// if it failed, so never make a second one for a tag
+		var err error
+		release, err = d.findRelease(ctx, tag)
+		if err != nil {
+			return result, &DeployError{Kind: ErrReleaseCreate, Msg: "finding release", Err: err}
+		}
+		if release != nil {
+			d.Log.Infof("Using the existing release for %s on %s: %s", tag, d.Provider.Name(), release.URL)
+		} else {
+			d.Log.Infof("Creating release on %s", d.Provider.Name())
+			release, err = d.Provider.CreateRelease(ctx, tag, TagVersion(tag, d.Config.TagPrefix), d.releaseNotes(result), prerelease)
+			if err != nil {
+				return result, &DeployError{Kind: ErrReleaseCreate, Msg: "creating release", Err: err}
+			}
+		}
+		d.recordRelease(release)
+		result.ReleaseID = release.ID
+		result.ReleaseURL = release.URL
+	}
+
+	uploader, err := d.newReleaseUploader(ctx, tag, release)
+	if err != nil {
+		return result, err
+	}
+	stopProgress := d.reportProgress(uploader.tracker)
+	defer stopProgress()
+
+	// set up environment in which to perform builds
+	d.Log.Infof("Preparing builds")
+	deployEnv, err := d.OpenEnv(tag, d.Plugins)
+	if err != nil {
+		return result, d.envOpenError("build environment", err)
+	}
+	defer deployEnv.Close()
+
+	// make a temporary folder where we will store build assets while
+	// they upload; the name of each asset will be unique by platform.
+	tmpdir, err := ioutil.TempDir(d.Config.StagingDir(), "caddy_deployment_")
+	if err != nil {
+		return result, fmt.Errorf("making temporary directory: %w", err)
+	}
+
+	// the binaries for the Docker image are kept here
+	dockerDir := filepath.Join(tmpdir, "docker")
+
+	// build logs are written to the temporary folder; if a
+	// build fails, keep the folder so its log can be read
+	var keepTmpdir bool
+	// workersDone is closed once the builds and uploads have
+	// all returned; until then, they may still be using the
+	// temporary folder, so it can't be removed
+	var workersDone chan struct{}
+	defer func() {
+		if workersDone != nil {
+			select {
+			case <-workersDone:
+			default:
+				d.Log.Warnf("Builds or uploads are still running; waiting for them to stop before removing %s", tmpdir)
+				<-workersDone
+			}
+		}
+		if keepTmpdir {
+			d.Log.Warnf("Some builds failed; their logs are in %s", tmpdir)
+			return
+		}
+		os.RemoveAll(tmpdir)
+	}()
+
+	// with FailFast, buildCtx is cancelled once too many
+	// platforms have failed for the release to be published
+	buildCtx, cancelBuilds := context.WithCancel(ctx)
+	defer cancelBuilds()
+	failed := func(plat string) {
+		result.FailedPlatforms = append(result.FailedPlatforms, plat)
+		if d.FailFast && len(result.FailedPlatforms) > d.MaxFailures && buildCtx.Err() == nil {
+			d.Log.Errorf("%d platforms failed; stopping the remaining builds and uploads", len(result.FailedPlatforms))
+			cancelBuilds()
+		}
+	}
+
+	// the source archive is quick to make, so do it first
+	if d.IncludeSource {
+		d.Log.Infof("Uploading source archive")
+		asset, err := d.uploadSource(ctx, uploader, tag, tmpdir)
+		if err == nil && d.PerAssetChecksums {
+			err = uploadAssetChecksum(ctx, uploader, asset, tmpdir)
+			if err != nil {
+				err = fmt.Errorf("uploading checksum: %w", err)
+			}
+		}
+		if err != nil {
+			d.Log.Errorf("!! COULD NOT UPLOAD SOURCE ARCHIVE: %v", err)
+			failed(sourcePlatform)
+		} else {
+			asset.URL, asset.MirrorURL = uploader.urls(asset.Name)
+			result.Assets = append(result.Assets, asset)
+			result.Platforms = append(result.Platforms, sourcePlatform)
+			if _, _, kept := uploader.keptAsset(asset.Name); !kept {
+				result.UploadedBytes += asset.Size
+			}
+		}
+	}
+
+	buildTime := time.Now()
+	restoreGoflags, err := d.useBuildFlags(strings.TrimPrefix(tag, d.Config.TagPrefix), result.Commit, buildTime)
+	if err != nil {
+		return result, err
+	}
+	defer restoreGoflags()
+	var resultMu sync.Mutex
+	fail := func(plat string) {
+		resultMu.Lock()
+		failed(plat)
+		resultMu.Unlock()
+	}
+
+	// build and upload a static release for each platform we
+	// choose: a pool of build workers hands each built asset to
+	// a pool of upload workers, so a built asset waits on disk
+	// only until an upload worker is free, and at most
+	// stagedAssetLimit of them are on disk at once
+	jobs := make(chan buildworker.Platform)
+	built := make(chan *builtAsset)
+	go func() {
+		defer close(jobs)
+		for i, plat := range platforms {
+			select {
+			case jobs <- plat:
+			case <-buildCtx.Done():
+				// don't start any more builds; unless interrupted,
+				// the rest count as failed so they can be resumed
+				if ctx.Err() == nil {
+					resultMu.Lock()
+					for _, p := range platforms[i:] {
+						result.FailedPlatforms = append(result.FailedPlatforms, p.String())
+					}
+					resultMu.Unlock()
+				}
+				return
+			}
+		}
+	}()
+
+	// buildAsset builds plat and prepares its asset for
+	// uploading, or returns nil if it can't
+	buildAsset := func(plat buildworker.Platform) *builtAsset {
+		d.Log.Infof("Building %s...", plat)
+		start := time.Now()
+		file, err := d.build(buildCtx, deployEnv, plat, tmpdir)
+		resultMu.Lock()
+		result.BuildDurations[plat.String()] = time.Since(start).Seconds()
+		resultMu.Unlock()
+		// the build environment's log is shared by builds
+		// running at the same time, so it may also contain
+		// output from other platforms
+		logPath := BuildLogPath(tmpdir, plat)
+		if logErr := ioutil.WriteFile(logPath, []byte(deployEnv.Output()), 0644); logErr != nil {
+			d.Log.Warnf("writing build log for %s: %v", plat, logErr)
+		}
+		if err != nil {
+			d.Log.Errorf("building %s: %v (build log: %s)", plat, err, logPath)
+			resultMu.Lock()
+			keepTmpdir = true
+			resultMu.Unlock()
+			return nil
+		}
+
+		// buildworker usually archives the binary, but
+		// make sure the asset is in the right format
+		file, err = ensureArchived(file, plat, tmpdir)
+		if err != nil {
+			d.Log.Errorf("!! COULD NOT PACKAGE %+v: %v", plat, err)
+			return nil
+		}
+		b := &builtAsset{plat: plat, file: file}
+
+		// the archive is removed after uploading,
+		// so keep the binary for the Docker image
+		if d.wantsDockerImage(plat) {
+			err = extractDockerBinary(file, plat, dockerDir)
+			if err != nil {
+				d.Log.Errorf("!! COULD NOT EXTRACT BINARY FOR DOCKER IMAGE FOR %+v: %v", plat, err)
+			}
+		}
+
+		// gather the asset's name, size, and checksum
+		b.asset, err = describeAsset(file, plat.String())
+		if err != nil {
+			d.Log.Errorf("!! COULD NOT READ BUILT FILE FOR %+v: %v", plat, err)
+			b.remove()
+			return nil
+		}
+		if d.AssetNames != nil {
+			b.asset.Name, err = executeAssetNameTemplate(d.AssetNames, d.Config.GitHubRepo, tag, plat, assetExt(b.asset.Name))
+			if err != nil {
+				d.Log.Errorf("!! COULD NOT NAME ASSET FOR %+v: %v", plat, err)
+				b.remove()
+				return nil
+			}
+		}
+
+		// sign, if enabled; an asset that can't be
+		// signed is not uploaded at all
+		if d.SignAssets {
+			b.sigFile, err = d.signFile(file.Name())
+			if err != nil {
+				d.Log.Errorf("!! COULD NOT SIGN %+v: %v", plat, err)
+				b.remove()
+				return nil
+			}
+		}
+		return b
+	}
+
+	// uploadAsset uploads b, with its signature and checksum
+	// if enabled, and reports whether all of them were
+	uploadAsset := func(b *builtAsset) bool {
+		plat, asset := b.plat, b.asset
+		start := time.Now()
+		err := uploader.upload(buildCtx, asset.Name, b.file)
+		if err != nil {
+			d.Log.Errorf("!! COULD NOT UPLOAD %+v: %v", plat, err)
+			return false
+		}
+
+		// the release's asset is listed, not the rebuild
+		kept, keptPath, wasKept := uploader.keptAsset(asset.Name)
+		if wasKept {
+			kept.Platform = asset.Platform
+			asset, b.asset, b.keptPath = kept, kept, keptPath
+		}
+		if b.sigFile != nil {
+			err = uploader.upload(buildCtx, asset.Name+".asc", b.sigFile)
+			if err != nil {
+				d.Log.Errorf("!! COULD NOT UPLOAD SIGNATURE FOR %+v: %v", plat, err)
+				return false
+			}
+		}
+		if d.PerAssetChecksums {
+			err = uploadAssetChecksum(buildCtx, uploader, asset, tmpdir)
+			if err != nil {
+				d.Log.Errorf("!! COULD NOT UPLOAD CHECKSUM FOR %+v: %v", plat, err)
+				return false
+			}
+		}
+		d.Log.Infof("Uploaded %s successfully", plat)
+		asset.URL, asset.MirrorURL = uploader.urls(asset.Name)
+		resultMu.Lock()
+		result.Assets = append(result.Assets, asset)
+		result.Platforms = append(result.Platforms, plat.String())
+		result.UploadDurations[plat.String()] = time.Since(start).Seconds()
+		if !wasKept {
+			result.UploadedBytes += asset.Size
+		}
+		resultMu.Unlock()
+		return true
+	}
+
+	var builders sync.WaitGroup
+	for i := 0; i < d.Config.BuildConcurrency; i++ {
+		builders.Add(1)
+		go func() {
+			defer builders.Done()
+			for plat := range jobs {
+				if buildCtx.Err() != nil {
+					if ctx.Err() == nil {
+						fail(plat.String())
+					}
+					continue
+				}
+				b := buildAsset(plat)
+				if b == nil {
+					fail(plat.String())
+					continue
+				}
+				select {
+				case built <- b:
+				case <-buildCtx.Done():
+					b.remove()
+					fail(plat.String())
+				}
+			}
+		}()
+	}
+	go func() {
+		builders.Wait()
+		close(built)
+	}()
+
+	var uploaders sync.WaitGroup
+	for i := 0; i < d.Config.UploadConcurrency; i++ {
+		uploaders.Add(1)
+		go func() {
+			defer uploaders.Done()
+			for b := range built {
+				if buildCtx.Err() != nil || !uploadAsset(b) {
+					fail(b.plat.String())
+				} else {
+					d.keep(b)
+				}
+				b.remove()
+			}
+		}()
+	}
+
+	// wait for the builds and uploads, but if interrupted,
+	// only give them a little while to finish what they're
+	// doing; they can't all be cancelled. The uploaders
+	// finish only after the builders, so waiting for
+	// them waits for both.
+	workersDone = make(chan struct{})
+	go func() {
+		uploaders.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+		d.Log.Warnf("Interrupted; waiting up to %s for builds and uploads in progress", interruptGrace)
+		select {
+		case <-workersDone:
+		case <-time.After(interruptGrace):
+		}
+		resultMu.Lock()
+		defer resultMu.Unlock()
+		return result.clone(), interrupted(ctx)
+	}
+	sort.Strings(result.Platforms)
+
+	// upload a text file with the SHA-256 of all release
+	// assets uploaded to GitHub, so they can be verified
+	if len(result.Assets) > 0 {
+		d.Log.Infof("Uploading checksums")
+		err = d.uploadChecksums(ctx, uploader, result.Assets, tmpdir)
+		if err != nil {
+			return result, fmt.Errorf("uploading checksums: %w", err)
+		}
+		d.keepData(checksumsFilename, checksumsFile(result.Assets))
+		d.Log.Infof("Uploading manifest")
+		err = d.uploadManifest(ctx, uploader, result, buildTime, platforms, tmpdir)
+		if err != nil {
+			return result, fmt.Errorf("uploading manifest: %w", err)
+		}
+
+		// the notes are only cosmetic, so the release
+		// goes on without them
+		if d.ReleaseBody != nil && release != nil {
+			d.Log.Infof("Updating release notes")
+			err = d.updateReleaseBody(ctx, release, result)
+			if err != nil {
+				d.Log.Warnf("Could not update the release notes: %v", err)
+			}
+		}
+	}
+
+	// the release was created as a draft so that nobody sees
+	// it half-populated; publish it only if no more than
+	// MaxFailures platforms failed
+	if len(result.FailedPlatforms) > 0 {
+		sort.Strings(result.FailedPlatforms)
+		total := len(platforms)
+		if d.IncludeSource {
+			total++
+		}
+		failures := fmt.Sprintf("%d of %d platforms failed (%s)",
+			len(result.FailedPlatforms), total, strings.Join(result.FailedPlatforms, ", "))
+		if len(result.FailedPlatforms) > d.MaxFailures {
+			state := "is incomplete"
+			if release != nil && release.Draft {
+				state = "was left as a draft"
+			}
+			return result, &DeployError{
+				Kind: ErrUploadPartial,
+				Msg: fmt.Sprintf("%s; the release %s (resume with -resume=upload): %s",
+					failures, state, result.ReleaseURL),
+			}
+		}
+		d.Log.Warnf("%s, which is within the limit of %d; releasing without them", failures, d.MaxFailures)
+	}
+	if release != nil && release.Draft {
+		d.Log.Infof("Publishing release on %s", d.Provider.Name())
+		release, err = d.Provider.PublishRelease(ctx, release)
+		if err != nil {
+			return result, &DeployError{Kind: ErrReleaseCreate, Msg: "publishing release (it is still a draft)", Err: err}
+		}
+		result.ReleaseURL = release.URL
+	}
+
+	// make sure people can actually download it before
+	// the build server starts pointing them to it
+	if d.VerifyDownloads && release != nil {
+		d.Log.Infof("Verifying downloads")
+		err = d.CheckDownloads(ctx, result.Assets, result)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// deploy to Caddy build server if not a pre-release
+	// (unless the channel deploys pre-releases too)
+	if d.deploysToBuildServer(prerelease) {
+		err = d.ReleaseToBuildServer(ctx, tag, result)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if err := interrupted(ctx); err != nil {
+		return result, err
+	}
+
+	// pre-releases never move the stable tag
+	if d.Config.StableTag != "" && !prerelease {
+		d.Log.Infof("Moving tag %s to %s", d.Config.StableTag, tag)
+		err = d.moveStableTag(tag)
+		if err != nil {
+			return result, fmt.Errorf("moving stable tag: %w", err)
+		}
+		result.StableTagMoved = true
+	}
+
+	// the release is out, so a milestone left open
+	// is no reason to fail the deploy
+	if d.Milestone != nil {
+		d.Log.Infof("Closing milestone %s", d.Milestone.Title)
+		err = d.Provider.CloseMilestone(ctx, *d.Milestone)
+		if err != nil {
+			d.Log.Warnf("Closing milestone %s: %v", d.Milestone.Title, err)
+		} else {
+			result.MilestoneClosed = true
+		}
+	}
+
+	// pre-releases don't go to Homebrew
+	if d.HomebrewFormula != nil && !prerelease {
+		d.Log.Infof("Updating Homebrew formula")
+		err = d.UpdateHomebrew(result)
+		if err != nil {
+			return result, fmt.Errorf("updating Homebrew formula: %w", err)
+		}
+		result.HomebrewUpdated = true
+	}
+
+	// the assets are all uploaded by now, so a failed
+	// push doesn't leave the release itself incomplete
+	if d.PushDocker {
+		err = d.PushDockerImage(tag, prerelease, dockerDir)
+		if err != nil {
+			return result, fmt.Errorf("pushing Docker image: %w", err)
+		}
+		result.DockerPushed = true
+	}
+
+	return result, nil
+}
+
+// interruptGrace is how long to wait for builds and
+// uploads in progress to stop when a deploy is interrupted.
+const interruptGrace = 10 * time.Second
+
+// waitToRetry waits before the given retry (1 for the
+// first) for backoff, doubled for each retry after the
+// first. It returns ctx's error if ctx is done first.
+func waitToRetry(ctx context.Context, backoff time.Duration, retry int) error {
+	select {
+	case <-time.After(backoff << uint(retry-1)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// interrupted returns an error of kind ErrInterrupted
+// if ctx is done, or nil if it is not.
+func interrupted(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return &DeployError{Kind: ErrInterrupted, Msg: "deploy interrupted", Err: err}
+	}
+	return nil
+}
+
+// CheckCaddy runs the tests and cross-platform build checks
+// on the Caddy repository at d.Commit or its current commit, after
+// updating the master GOPATH if d.UpdateGopath is set, and
+// then each of the configured check commands in turn. If
+// d.ChecksCache records that they already passed for the
+// commit, they are skipped, unless d.ForceChecks is set.
+// With d.IsolatedChecks, they all run in a shallow clone of
+// the commit in a temporary GOPATH instead.
+func (d *Deployer) CheckCaddy() error {
+	// get commit to check
+	rev := "HEAD"
+	if d.Commit != "" {
+		rev = d.Commit
+	}
+	cmd := Command("git", "rev-parse", rev+"^{commit}")
+	cmd.Dir = d.RepoDir
+	out, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+	currentCommit := strings.TrimSpace(string(out))
+	d.Log.Infof("Checking Caddy at commit: %s", currentCommit)
+
+	if d.ChecksCache != "" && !d.ForceChecks && d.checksPassed(currentCommit) {
+		d.Log.Infof("Checks already passed for this commit; skipping them (use -force-checks to run them again)")
+		return nil
+	}
+
+	// create build environment, with the same plugins
+	// as the release builds so the checks cover them
+	repoDir := d.RepoDir
+	var be BuildEnv
+	if d.IsolatedChecks {
+		d.Log.Infof("Cloning Caddy into a temporary GOPATH for the checks")
+		var closeEnv func()
+		be, repoDir, closeEnv, err = d.openIsolatedEnv(currentCommit)
+		if err != nil {
+			return d.envOpenError("isolated build environment", err)
+		}
+		defer closeEnv()
+	} else {
+		d.Log.Infof("Opening build environment")
+		be, err = d.OpenEnv(currentCommit, d.Plugins)
+		if err != nil {
+			return d.envOpenError("build environment", err)
+		}
+		defer be.Close()
+	}
+
+	// update master GOPATH to help ensure the tests
+	// here will get the same results as the build
+	// server which also updates its GOPATH each time
+	// a deploy is made; it's not bulletproof but it's
+	// good enough. if this update introduces some
+	// breaking change, the tests we're about to run
+	// will catch that -- however, we don't revert
+	// the update, as that would involve a massive
+	// overwrite of the whole GOPATH on some developer's
+	// machine, which is why it must be asked for.
+	if d.UpdateGopath {
+		d.Log.Infof("Updating master GOPATH")
+		err = be.UpdateMasterGopath()
+		if err != nil {
+			return fmt.Errorf("updating master GOPATH: %w", err)
+		}
+	} else if !d.IsolatedChecks {
+		d.Log.Warnf("Not updating master GOPATH; the checks may not get the same results as the build server")
+	}
+
+	// run checks and report results
+	d.Log.Infof("Running tests and cross-platform build checks on Caddy (this may take a while)")
+	done, watched := make(chan struct{}), make(chan struct{})
+	go func() {
+		d.watchChecks(be.Output, done)
+		close(watched)
+	}()
+	err = be.RunCaddyChecks()
+	close(done)
+	<-watched
+	if err != nil {
+		if !d.VerboseChecks {
+			d.Log.Errorf("checks failed; here's the log:\n>>>>>>>>>>>>%s\n<<<<<<<<<<<<", be.Output())
+		}
+		return err
+	}
+
+	for _, command := range d.Config.CheckCommands {
+		err := d.runCheckCommand(repoDir, command)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.ChecksCache != "" {
+		d.recordChecksPassed(currentCommit)
+	}
+	return nil
+}
+
+// run runs command with the given args in the caddy repo.
+// It directs stdout and stderr through to the user, with
+// secrets redacted. It does not capture the output.
+func (d *Deployer) run(command string, args ...string) error {
+	return runIn(d.RepoDir, command, args...)
+}
+
+// runIn is like run, but runs command in dir.
+func runIn(dir, command string, args ...string) error {
+	cmd := Command(command, args...)
+	cmd.Dir = dir
+	return RunRedacted(cmd)
+}
@@ -0,0 +1,95 @@
+package releaser
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// testPlatforms are the platforms that test deploys build.
+var testPlatforms = []buildworker.Platform{
+	{OS: "linux", Arch: "amd64"},
+	{OS: "windows", Arch: "amd64"},
+}
+
+// testTag is the tag that test deploys release. It is a
+// pre-release so that it isn't deployed to the build server.
+const testTag = "v1.2.3-beta.1"
+
+// newTestDeployer returns a Deployer that releases the Caddy
+// repo at repoDir to provider, building with a fakeEnv.
+func newTestDeployer(t *testing.T, repoDir string, provider Provider) *Deployer {
+	cfg := DefaultConfig()
+	return &Deployer{
+		Config:   cfg,
+		Channel:  cfg.Channels["stable"],
+		RepoDir:  repoDir,
+		OpenEnv:  openFakeEnv,
+		Log:      testLogger{t},
+		Provider: provider,
+	}
+}
+
+func TestDeployPublishes(t *testing.T) {
+	provider := newFakeProvider()
+	d := newTestDeployer(t, newTestRepo(t, testTag), provider)
+
+	result, err := d.Deploy(context.Background(), testTag, true, testPlatforms, StageRelease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rel := provider.release(testTag)
+	if rel == nil {
+		t.Fatal("no release was made")
+	}
+	if rel.Draft {
+		t.Error("the release was left as a draft")
+	}
+	if got := provider.called("PublishRelease"); !reflect.DeepEqual(got, []string{testTag}) {
+		t.Errorf("PublishRelease was called for %q, want once for %s", got, testTag)
+	}
+	want := []string{
+		"caddy_linux_amd64.tar.gz",
+		"caddy_windows_amd64.zip",
+		checksumsFilename,
+		manifestFilename,
+	}
+	if got := provider.assetNames(rel); !reflect.DeepEqual(got, want) {
+		t.Errorf("release has assets %q, want %q", got, want)
+	}
+	if len(result.FailedPlatforms) > 0 {
+		t.Errorf("platforms failed: %q", result.FailedPlatforms)
+	}
+	if result.ReleaseURL != rel.URL {
+		t.Errorf("result's release URL is %q, want %q", result.ReleaseURL, rel.URL)
+	}
+}
+
+func TestDeployFailedUploadLeavesDraft(t *testing.T) {
+	provider := newFakeProvider()
+	provider.failUploads["caddy_windows_amd64.zip"] = true
+	d := newTestDeployer(t, newTestRepo(t, testTag), provider)
+
+	result, err := d.Deploy(context.Background(), testTag, true, testPlatforms, StageRelease)
+	if !errors.Is(err, ErrUploadPartial) {
+		t.Fatalf("Deploy returned %v, want an error of kind ErrUploadPartial", err)
+	}
+
+	rel := provider.release(testTag)
+	if rel == nil {
+		t.Fatal("no release was made")
+	}
+	if !rel.Draft {
+		t.Error("the release was published")
+	}
+	if got := provider.called("PublishRelease"); len(got) > 0 {
+		t.Errorf("PublishRelease was called for %q", got)
+	}
+	if want := []string{"windows/amd64"}; !reflect.DeepEqual(result.FailedPlatforms, want) {
+		t.Errorf("failed platforms are %q, want %q", result.FailedPlatforms, want)
+	}
+}
@@ -0,0 +1,72 @@
+package releaser
+
+import (
+	"fmt"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// Rough sizes of what a deploy keeps on disk, on the high
+// side so an estimate is more likely to be too much than
+// too little.
+const (
+	approxAssetSize  = 25 << 20 // a compressed release archive
+	approxBinarySize = 60 << 20 // an uncompressed binary, as kept for Docker
+)
+
+// stagedAssetLimit returns how many built assets may be on
+// disk at once: enough to keep both the builds and the
+// uploads busy. Each is removed as soon as it's uploaded.
+func stagedAssetLimit(cfg Config) int {
+	return cfg.BuildConcurrency + cfg.UploadConcurrency
+}
+
+// DiskSpaceNeeded estimates how much space, in bytes, the
+// temporary folder needs to deploy platforms, including the
+// binaries kept for the Docker image if docker is true.
+func DiskSpaceNeeded(cfg Config, platforms []buildworker.Platform, docker bool) uint64 {
+	staged := len(platforms)
+	if limit := stagedAssetLimit(cfg); staged > limit {
+		staged = limit
+	}
+	need := uint64(staged) * approxAssetSize
+	if docker {
+		for _, plat := range platforms {
+			for _, p := range cfg.DockerPlatforms {
+				if p == dockerPlatform(plat) {
+					need += approxBinarySize
+				}
+			}
+		}
+	}
+	return need
+}
+
+// CheckDiskSpace returns an error if the filesystem of dir
+// has less than need bytes free, and logs a warning if it
+// has less than twice that, since need is only an estimate.
+// If the free space can't be found, it only logs a warning.
+func CheckDiskSpace(log Logger, dir string, need uint64) error {
+	free, err := freeSpace(dir)
+	if err != nil {
+		log.Warnf("Could not check free disk space in %s: %v", dir, err)
+		return nil
+	}
+	if free < need {
+		return fmt.Errorf("not enough disk space in %s: %s free, but about %s is needed",
+			dir, formatBytes(free), formatBytes(need))
+	}
+	if free < 2*need {
+		log.Warnf("Disk space in %s is low: %s free, and about %s is needed",
+			dir, formatBytes(free), formatBytes(need))
+	}
+	return nil
+}
+
+// formatBytes returns n as a number of MiB or GiB.
+func formatBytes(n uint64) string {
+	if n >= 1<<30 {
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	}
+	return fmt.Sprintf("%.0f MiB", float64(n)/(1<<20))
+}
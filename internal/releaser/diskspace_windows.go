@@ -0,0 +1,8 @@
+package releaser
+
+import "errors"
+
+// freeSpace is not implemented on Windows.
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.New("not supported on Windows")
+}
@@ -0,0 +1,149 @@
+package releaser
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// dockerfile builds the Caddy image from the binaries put
+// in the build context by extractDockerBinary, one per
+// target platform.
+const dockerfile = `FROM alpine:3
+RUN apk add --no-cache ca-certificates
+ARG TARGETOS
+ARG TARGETARCH
+ARG TARGETVARIANT
+COPY bin/${TARGETOS}_${TARGETARCH}${TARGETVARIANT:+_}${TARGETVARIANT}/caddy /usr/bin/caddy
+EXPOSE 80 443 2015
+ENTRYPOINT ["/usr/bin/caddy"]
+`
+
+// dockerPlatform returns the Docker name of plat,
+// such as "linux/arm/v7".
+func dockerPlatform(plat buildworker.Platform) string {
+	name := plat.OS + "/" + plat.Arch
+	if plat.ARM != "" {
+		name += "/v" + plat.ARM
+	}
+	return name
+}
+
+// wantsDockerImage returns true if the image
+// is configured to be built for plat.
+func (d *Deployer) wantsDockerImage(plat buildworker.Platform) bool {
+	if !d.PushDocker {
+		return false
+	}
+	for _, p := range d.Config.DockerPlatforms {
+		if p == dockerPlatform(plat) {
+			return true
+		}
+	}
+	return false
+}
+
+// dockerBinaryPath returns where the binary for the Docker
+// platform named platform goes in the build context dir.
+func dockerBinaryPath(dir, platform string) string {
+	return filepath.Join(dir, "bin", strings.Replace(platform, "/", "_", -1), "caddy")
+}
+
+// extractDockerBinary copies the caddy binary out of the
+// .tar.gz archive, which is the release asset for plat,
+// into the Docker build context in dir. It then seeks
+// back to the beginning of archive.
+func extractDockerBinary(archive *os.File, plat buildworker.Platform, dir string) error {
+	defer archive.Seek(0, 0)
+
+	gzr, err := gzip.NewReader(archive)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("no caddy binary in %s", filepath.Base(archive.Name()))
+		}
+		if err != nil {
+			return err
+		}
+		if filepath.Base(hdr.Name) != "caddy" || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		dest := dockerBinaryPath(dir, dockerPlatform(plat))
+		err = os.MkdirAll(filepath.Dir(dest), 0755)
+		if err != nil {
+			return err
+		}
+		out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+}
+
+// PushDockerImage builds a multi-platform Docker image of the
+// release with the given tag from the binaries extracted into
+// dir, and pushes it to the configured registry. The image is
+// tagged with the version, and also as latest if the release
+// is neither a pre-release nor outside the stable channel.
+func (d *Deployer) PushDockerImage(tag string, prerelease bool, dir string) error {
+	for _, platform := range d.Config.DockerPlatforms {
+		if _, err := os.Stat(dockerBinaryPath(dir, platform)); err != nil {
+			return fmt.Errorf("no binary for %s: %w", platform, err)
+		}
+	}
+	err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0644)
+	if err != nil {
+		return err
+	}
+
+	if d.Config.DockerUsername != "" {
+		d.Log.Infof("Logging in to Docker registry")
+		args := []string{"login", "--username", d.Config.DockerUsername, "--password-stdin"}
+		if d.Config.DockerRegistry != "" {
+			args = append(args, d.Config.DockerRegistry)
+		}
+		cmd := Command("docker", args...)
+		cmd.Stdin = strings.NewReader(d.Config.DockerPassword)
+		err = RunRedacted(cmd)
+		if err != nil {
+			return fmt.Errorf("docker login: %w", err)
+		}
+	}
+
+	image := d.Config.DockerImage
+	if d.Config.DockerRegistry != "" {
+		image = d.Config.DockerRegistry + "/" + image
+	}
+	args := []string{"buildx", "build",
+		"--platform", strings.Join(d.Config.DockerPlatforms, ","),
+		"--tag", image + ":" + TagVersion(tag, d.Config.TagPrefix),
+	}
+	if !prerelease && d.Channel.Name == "stable" {
+		args = append(args, "--tag", image+":latest")
+	}
+	args = append(args, "--push", dir)
+
+	d.Log.Infof("Building and pushing Docker image %s", image)
+	err = runIn(dir, "docker", args...)
+	if err != nil {
+		return fmt.Errorf("docker buildx: %w", err)
+	}
+	return nil
+}
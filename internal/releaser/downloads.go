@@ -0,0 +1,88 @@
+package releaser
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// downloadClient makes the requests that check download
+// URLs; it follows redirects, as browsers do.
+var downloadClient = &http.Client{Timeout: 30 * time.Second}
+
+// Checking a download URL: how many times to try, and how
+// long to wait between tries, since a newly published asset
+// may take a moment to be served everywhere.
+const (
+	downloadCheckAttempts = 3
+	downloadCheckWait     = 5 * time.Second
+)
+
+// CheckDownloads makes a HEAD request to the download URL
+// of each of assets, and returns an error of kind
+// ErrDownloadUnreachable listing those that don't respond
+// with 200 OK and a Content-Length equal to their size,
+// which are also recorded in result. Assets without a
+// download URL are skipped.
+func (d *Deployer) CheckDownloads(ctx context.Context, assets []AssetInfo, result *Result) error {
+	var problems []string
+	for _, asset := range assets {
+		if asset.URL == "" {
+			continue
+		}
+		var err error
+		for i := 0; i < downloadCheckAttempts; i++ {
+			if i > 0 {
+				select {
+				case <-time.After(downloadCheckWait):
+				case <-ctx.Done():
+					return interrupted(ctx)
+				}
+			}
+			err = checkDownload(ctx, asset)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			d.Log.Errorf("!! %s CAN'T BE DOWNLOADED: %v", asset.Name, err)
+			result.UnreachableAssets = append(result.UnreachableAssets, asset.Name)
+			problems = append(problems, fmt.Sprintf("%s: %v", asset.Name, err))
+			continue
+		}
+		d.Log.Debugf("%s can be downloaded", asset.Name)
+	}
+	if len(problems) > 0 {
+		return &DeployError{
+			Kind: ErrDownloadUnreachable,
+			Msg: fmt.Sprintf("%d of %d assets can't be downloaded (the release is published):\n  - %s",
+				len(problems), len(assets), strings.Join(problems, "\n  - ")),
+		}
+	}
+	return nil
+}
+
+// checkDownload makes a HEAD request to the download URL
+// of asset, and returns an error if the response is not
+// 200 OK or does not have the size of asset.
+func checkDownload(ctx context.Context, asset AssetInfo) error {
+	req, err := http.NewRequest("HEAD", asset.URL, nil)
+	if err != nil {
+		return fmt.Errorf("preparing request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("network error: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: HTTP %d", asset.URL, resp.StatusCode)
+	}
+	if resp.ContentLength != asset.Size {
+		return fmt.Errorf("%s: Content-Length is %d, but %d bytes were uploaded", asset.URL, resp.ContentLength, asset.Size)
+	}
+	return nil
+}
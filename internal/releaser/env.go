@@ -0,0 +1,111 @@
+package releaser
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// BuildEnv is an environment in which Caddy can be
+// checked and built.
+type BuildEnv interface {
+	Build(plat buildworker.Platform, outputFolder string) (*os.File, error)
+	UpdateMasterGopath() error
+	RunCaddyChecks() error
+	Close() error
+
+	// Output returns everything the environment
+	// has logged so far.
+	Output() string
+}
+
+// EnvFactory opens a build environment for the given
+// version of Caddy with the given plugins.
+type EnvFactory func(caddyVersion string, plugins []buildworker.CaddyPlugin) (BuildEnv, error)
+
+// OpenBuildworker is an EnvFactory that opens a
+// buildworker environment.
+func OpenBuildworker(caddyVersion string, plugins []buildworker.CaddyPlugin) (BuildEnv, error) {
+	be, err := buildworker.Open(caddyVersion, plugins)
+	if err != nil {
+		return nil, err
+	}
+	return buildworkerEnv{be}, nil
+}
+
+// buildworkerEnv adapts a buildworker environment to BuildEnv.
+type buildworkerEnv struct {
+	*buildworker.BuildEnv
+}
+
+func (be buildworkerEnv) Output() string { return be.Log.String() }
+
+// envProblem is a common reason for a build environment to
+// fail to open, recognized by a substring of the error.
+type envProblem struct {
+	matches []string
+	cause   string
+	hint    string
+}
+
+// envProblems are the usual ways that opening a build
+// environment fails, most of them on the first run on a
+// new machine, in the order they are checked.
+var envProblems = []envProblem{
+	{
+		matches: []string{"GOPATH not set", "GOPATH is not set", "GOPATH entry is relative"},
+		cause:   "GOPATH is not set up",
+		hint:    "set GOPATH to an absolute path, with Caddy at $GOPATH/src/" + buildworker.CaddyPackage,
+	},
+	{
+		matches: []string{"cannot find package", "no Go files in", "is not in GOROOT", "no buildable Go source files"},
+		cause:   "a package is missing from GOPATH",
+		hint:    "fetch Caddy and its dependencies with `go get -u " + buildworker.CaddyPackage + "/...`, and any plugins, then try again",
+	},
+	{
+		matches: []string{"unknown revision", "did not match any file(s) known to git", "reference is not a tree", "not a valid object name"},
+		cause:   "the version isn't in the Caddy repo in GOPATH",
+		hint:    "fetch the tags and commits into $GOPATH/src/" + buildworker.CaddyPackage + " with `git fetch --tags`; it may be a different clone than the one being released",
+	},
+	{
+		matches: []string{"dial tcp", "no such host", "Could not resolve host", "i/o timeout", "connection refused", "connection reset", "unable to access"},
+		cause:   "fetching a package over the network failed",
+		hint:    "check the network connection and any proxy settings; plugins are fetched with go get, so their repositories must be reachable from this machine",
+	},
+	{
+		matches: []string{"permission denied"},
+		cause:   "a file in GOPATH can't be written",
+		hint:    "make sure GOPATH, and the temporary folder, are writable by the user running the deploy",
+	},
+}
+
+// diagnoseEnvError returns the likely cause of err, from
+// opening a build environment, and a hint at how to fix
+// it, or "" for both if it's not a problem known to be
+// common.
+func diagnoseEnvError(err error) (cause, hint string) {
+	msg := err.Error()
+	for _, p := range envProblems {
+		for _, m := range p.matches {
+			if strings.Contains(msg, m) {
+				return p.cause, p.hint
+			}
+		}
+	}
+	return "", ""
+}
+
+// envOpenError returns err, from opening a build environment
+// (described by what, such as "build environment"), with its
+// likely cause, if it's a common one, and logs a hint at
+// what to do about it.
+func (d *Deployer) envOpenError(what string, err error) error {
+	cause, hint := diagnoseEnvError(err)
+	if cause == "" {
+		return fmt.Errorf("opening %s: %w", what, err)
+	}
+	d.Log.Warnf("Troubleshooting: %s", hint)
+	return fmt.Errorf("opening %s (%s): %w", what, cause, err)
+}
@@ -0,0 +1,72 @@
+package releaser
+
+import "errors"
+
+// Kinds of deploy failures. Errors returned by Deploy can be
+// tested against these with errors.Is to find out which step
+// failed; errors.As with a *DeployError gives more detail.
+var (
+	// ErrPreflight means the deploy could not start
+	// because the environment is not as required.
+	ErrPreflight = errors.New("preflight check failed")
+
+	// ErrChecksFailed means the tests or build checks on
+	// Caddy failed, so nothing was tagged or released.
+	ErrChecksFailed = errors.New("checks failed")
+
+	// ErrTagExists means the tag for the new release
+	// already exists in the repository.
+	ErrTagExists = errors.New("tag already exists")
+
+	// ErrTagPush means the tag could not be made or
+	// pushed, so nothing was released.
+	ErrTagPush = errors.New("tag or push failed")
+
+	// ErrReleaseCreate means the release could not be
+	// created, found, or published on the provider.
+	ErrReleaseCreate = errors.New("release creation failed")
+
+	// ErrUploadPartial means some platforms could not
+	// be built or uploaded, so the release is incomplete.
+	ErrUploadPartial = errors.New("not all assets were uploaded")
+
+	// ErrNotSupported means a provider can't do
+	// what was asked of it.
+	ErrNotSupported = errors.New("not supported by provider")
+
+	// ErrInterrupted means the deploy was cancelled
+	// before it finished, usually by the operator.
+	ErrInterrupted = errors.New("deploy interrupted")
+
+	// ErrBuildServerDeploy means the release could not be
+	// deployed to the build server, or it didn't go live.
+	ErrBuildServerDeploy = errors.New("build server deploy failed")
+
+	// ErrDownloadUnreachable means some assets of the
+	// published release could not be downloaded.
+	ErrDownloadUnreachable = errors.New("assets can't be downloaded")
+)
+
+// DeployError is an error from a step of the deploy. It
+// matches its Kind with errors.Is, and unwraps to Err,
+// so the underlying cause can be inspected too.
+type DeployError struct {
+	Kind error  // one of the Err* values
+	Msg  string // human-readable description of what failed
+	Err  error  // underlying error, if any
+}
+
+// Error returns the description of what failed and why,
+// with any secrets in either redacted.
+func (e *DeployError) Error() string {
+	if e.Err == nil {
+		return Redact(e.Msg)
+	}
+	return Redact(e.Msg + ": " + e.Err.Error())
+}
+
+// Is returns true if target is e's kind of error.
+func (e *DeployError) Is(target error) bool { return target == e.Kind }
+
+// Unwrap returns the underlying error.
+func (e *DeployError) Unwrap() error { return e.Err }
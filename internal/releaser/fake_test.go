@@ -0,0 +1,244 @@
+package releaser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// fakeProvider is a Provider that keeps its releases in
+// memory and records the calls made to it.
+type fakeProvider struct {
+	// failUploads are the names of the assets
+	// whose uploads fail.
+	failUploads map[string]bool
+
+	mu       sync.Mutex
+	calls    []call
+	releases []*Release
+	assets   map[int64]map[string][]byte // by release ID, then name
+}
+
+func newFakeProvider() *fakeProvider {
+	return &fakeProvider{
+		failUploads: make(map[string]bool),
+		assets:      make(map[int64]map[string][]byte),
+	}
+}
+
+// call is a call made to a fakeProvider: the name of the
+// method, and the tag or asset name it was called with.
+type call struct {
+	method, arg string
+}
+
+// record records a call to method with arg.
+func (p *fakeProvider) record(method, arg string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, call{method, arg})
+}
+
+// called returns the args of each call to method.
+func (p *fakeProvider) called(method string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var args []string
+	for _, c := range p.calls {
+		if c.method == method {
+			args = append(args, c.arg)
+		}
+	}
+	return args
+}
+
+// release returns a copy of the release for tag,
+// or nil if there is none.
+func (p *fakeProvider) release(tag string) *Release {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, rel := range p.releases {
+		if rel.Tag == tag {
+			copied := *rel
+			return &copied
+		}
+	}
+	return nil
+}
+
+// assetNames returns the names of the assets
+// of rel, sorted.
+func (p *fakeProvider) assetNames(rel *Release) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var names []string
+	for name := range p.assets[rel.ID] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *fakeProvider) Name() string { return "Fake" }
+
+func (p *fakeProvider) CheckAccess(ctx context.Context) error {
+	p.record("CheckAccess", "")
+	return nil
+}
+
+func (p *fakeProvider) HasTag(ctx context.Context, tag string) (bool, error) {
+	p.record("HasTag", tag)
+	return true, nil
+}
+
+func (p *fakeProvider) CreateRelease(ctx context.Context, tag, name, body string, prerelease bool) (*Release, error) {
+	p.record("CreateRelease", tag)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rel := &Release{
+		ID:    int64(len(p.releases) + 1),
+		Tag:   tag,
+		Name:  name,
+		URL:   "https://example.com/releases/" + tag,
+		Draft: true,
+	}
+	p.releases = append(p.releases, rel)
+	p.assets[rel.ID] = make(map[string][]byte)
+	copied := *rel
+	return &copied, nil
+}
+
+func (p *fakeProvider) GetReleaseByTag(ctx context.Context, tag string) (*Release, error) {
+	p.record("GetReleaseByTag", tag)
+	return p.release(tag), nil
+}
+
+func (p *fakeProvider) GetRelease(ctx context.Context, id int64) (*Release, error) {
+	p.record("GetRelease", fmt.Sprint(id))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, rel := range p.releases {
+		if rel.ID == id {
+			copied := *rel
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *fakeProvider) PublishRelease(ctx context.Context, rel *Release) (*Release, error) {
+	p.record("PublishRelease", rel.Tag)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, r := range p.releases {
+		if r.ID == rel.ID {
+			r.Draft = false
+			copied := *r
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("no release %d", rel.ID)
+}
+
+func (p *fakeProvider) EditReleaseNotes(ctx context.Context, rel *Release, body string) error {
+	p.record("EditReleaseNotes", rel.Tag)
+	return nil
+}
+
+func (p *fakeProvider) ListAssets(ctx context.Context, rel *Release) ([]Asset, error) {
+	p.record("ListAssets", rel.Tag)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var assets []Asset
+	for name, data := range p.assets[rel.ID] {
+		assets = append(assets, Asset{Name: name, Size: int64(len(data))})
+	}
+	return assets, nil
+}
+
+func (p *fakeProvider) UploadAsset(ctx context.Context, rel *Release, name string, body io.ReadSeeker, size int64) (Asset, error) {
+	p.record("UploadAsset", name)
+	if p.failUploads[name] {
+		return Asset{}, fmt.Errorf("uploading %s: HTTP 502", name)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return Asset{}, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.assets[rel.ID][name] = data
+	return Asset{Name: name, Size: int64(len(data))}, nil
+}
+
+func (p *fakeProvider) DeleteAsset(ctx context.Context, rel *Release, asset Asset) error {
+	p.record("DeleteAsset", asset.Name)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.assets[rel.ID], asset.Name)
+	return nil
+}
+
+func (p *fakeProvider) DownloadAsset(ctx context.Context, rel *Release, asset Asset) (io.ReadCloser, error) {
+	p.record("DownloadAsset", asset.Name)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	data, ok := p.assets[rel.ID][asset.Name]
+	if !ok {
+		return nil, fmt.Errorf("no asset %s", asset.Name)
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (p *fakeProvider) DownloadURL(rel *Release, name string) string {
+	return "https://example.com/download/" + rel.Tag + "/" + name
+}
+
+func (p *fakeProvider) OpenMilestones(ctx context.Context) ([]Milestone, error) {
+	p.record("OpenMilestones", "")
+	return nil, nil
+}
+
+func (p *fakeProvider) CloseMilestone(ctx context.Context, m Milestone) error {
+	p.record("CloseMilestone", m.Title)
+	return nil
+}
+
+// fakeEnv is a BuildEnv whose builds write a small
+// bare binary for each platform.
+type fakeEnv struct{}
+
+// openFakeEnv is an EnvFactory that opens a fakeEnv.
+func openFakeEnv(caddyVersion string, plugins []buildworker.CaddyPlugin) (BuildEnv, error) {
+	return fakeEnv{}, nil
+}
+
+func (fakeEnv) Build(plat buildworker.Platform, outputFolder string) (*os.File, error) {
+	path := filepath.Join(outputFolder, "caddy_"+plat.OS+"_"+plat.Arch)
+	if err := ioutil.WriteFile(path, []byte("caddy for "+plat.String()), 0755); err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (fakeEnv) UpdateMasterGopath() error { return nil }
+func (fakeEnv) RunCaddyChecks() error     { return nil }
+func (fakeEnv) Close() error              { return nil }
+func (fakeEnv) Output() string            { return "" }
+
+// testLogger is a Logger that writes to the test log.
+type testLogger struct{ t *testing.T }
+
+func (l testLogger) Debugf(format string, args ...interface{}) { l.t.Logf("DEBUG "+format, args...) }
+func (l testLogger) Infof(format string, args ...interface{})  { l.t.Logf("INFO "+format, args...) }
+func (l testLogger) Warnf(format string, args ...interface{})  { l.t.Logf("WARN "+format, args...) }
+func (l testLogger) Errorf(format string, args ...interface{}) { l.t.Logf("ERROR "+format, args...) }
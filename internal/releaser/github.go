@@ -0,0 +1,458 @@
+package releaser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+// NewGitHubClient returns a GitHub client
+// authenticated with token.
+func NewGitHubClient(token string) *github.Client {
+	tc := oauth2.NewClient(oauth2.NoContext, oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: token},
+	))
+	return github.NewClient(tc)
+}
+
+// ReleaseService is the part of the GitHub API used to make
+// a release and manage its assets. A GitHub client's
+// Repositories service implements it.
+type ReleaseService interface {
+	Get(ctx context.Context, owner, repo string) (*github.Repository, *github.Response, error)
+	CreateRelease(ctx context.Context, owner, repo string, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error)
+	GetRelease(ctx context.Context, owner, repo string, id int64) (*github.RepositoryRelease, *github.Response, error)
+	GetReleaseByTag(ctx context.Context, owner, repo, tag string) (*github.RepositoryRelease, *github.Response, error)
+	ListReleases(ctx context.Context, owner, repo string, opt *github.ListOptions) ([]*github.RepositoryRelease, *github.Response, error)
+	EditRelease(ctx context.Context, owner, repo string, id int64, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error)
+	ListReleaseAssets(ctx context.Context, owner, repo string, id int64, opt *github.ListOptions) ([]*github.ReleaseAsset, *github.Response, error)
+	DownloadReleaseAsset(ctx context.Context, owner, repo string, id int64) (io.ReadCloser, string, error)
+	DeleteReleaseAsset(ctx context.Context, owner, repo string, id int64) (*github.Response, error)
+}
+
+// RefService is the part of the GitHub API used to see
+// whether a pushed tag has arrived. A GitHub client's
+// Git service implements it.
+type RefService interface {
+	GetRef(ctx context.Context, owner, repo, ref string) (*github.Reference, *github.Response, error)
+}
+
+// UploadService is the part of the GitHub API used to
+// upload release assets. A GitHub client implements it.
+// It is used instead of ReleaseService.UploadReleaseAsset,
+// which closes the file it uploads.
+type UploadService interface {
+	NewUploadRequest(urlStr string, reader io.Reader, size int64, mediaType string) (*http.Request, error)
+	Do(ctx context.Context, req *http.Request, v interface{}) (*github.Response, error)
+}
+
+// MilestoneService is the part of the GitHub API used to
+// find and close the milestone of a release. A GitHub
+// client's Issues service implements it.
+type MilestoneService interface {
+	ListMilestones(ctx context.Context, owner, repo string, opt *github.MilestoneListOptions) ([]*github.Milestone, *github.Response, error)
+	EditMilestone(ctx context.Context, owner, repo string, number int, milestone *github.Milestone) (*github.Milestone, *github.Response, error)
+}
+
+// GitHubProvider publishes releases on GitHub.
+type GitHubProvider struct {
+	Owner, Repo string
+
+	// Releases, Refs, and Milestones are normally the
+	// Repositories, Git, and Issues services of a GitHub
+	// client, and Uploads the client itself; see
+	// NewGitHubClient.
+	Releases   ReleaseService
+	Refs       RefService
+	Milestones MilestoneService
+	Uploads    UploadService
+
+	// Log, if not nil, is told when a request is rate
+	// limited and will be retried.
+	Log Logger
+}
+
+// NewGitHubProvider returns a provider that publishes
+// releases to owner's repo on GitHub, authenticated
+// with token.
+func NewGitHubProvider(token, owner, repo string) *GitHubProvider {
+	client := NewGitHubClient(token)
+	return &GitHubProvider{
+		Owner:      owner,
+		Repo:       repo,
+		Releases:   client.Repositories,
+		Refs:       client.Git,
+		Milestones: client.Issues,
+		Uploads:    client,
+	}
+}
+
+// Name returns "GitHub".
+func (p *GitHubProvider) Name() string { return "GitHub" }
+
+// CheckAccess returns an error if the token can't publish
+// releases to the repository: that is, if it can't push to
+// it, or if it is a classic token without the repo scope
+// (or public_repo, for a public repository). Fine-grained
+// tokens have no scopes, so only the permission is checked.
+func (p *GitHubProvider) CheckAccess(ctx context.Context) error {
+	var repo *github.Repository
+	var resp *github.Response
+	err := p.retryRateLimited(ctx, "getting the repository", func() (err error) {
+		repo, resp, err = p.Releases.Get(ctx, p.Owner, p.Repo)
+		return err
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf("the token is invalid or expired")
+		}
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("repository %s/%s is not found, or the token can't see it", p.Owner, p.Repo)
+		}
+		return fmt.Errorf("getting repository %s/%s: %w", p.Owner, p.Repo, err)
+	}
+	if perms := repo.GetPermissions(); !perms["push"] {
+		return fmt.Errorf("the token can't push to %s/%s, which is needed to make releases", p.Owner, p.Repo)
+	}
+
+	if header, ok := resp.Header["X-Oauth-Scopes"]; ok {
+		scopes := make(map[string]bool)
+		for _, scope := range strings.Split(strings.Join(header, ","), ",") {
+			scopes[strings.TrimSpace(scope)] = true
+		}
+		if !scopes["repo"] && !(scopes["public_repo"] && !repo.GetPrivate()) {
+			return fmt.Errorf("the token has scopes %q, but needs repo (or public_repo, for a public repository)", strings.Join(header, ","))
+		}
+	}
+	return nil
+}
+
+// HasTag returns true if GitHub sees tag.
+func (p *GitHubProvider) HasTag(ctx context.Context, tag string) (bool, error) {
+	var resp *github.Response
+	err := p.retryRateLimited(ctx, "looking for the tag", func() (err error) {
+		_, resp, err = p.Refs.GetRef(ctx, p.Owner, p.Repo, "tags/"+tag)
+		return err
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateRelease makes a new draft release on GitHub.
+func (p *GitHubProvider) CreateRelease(ctx context.Context, tag, name, body string, prerelease bool) (*Release, error) {
+	var release *github.RepositoryRelease
+	err := p.retryRateLimited(ctx, "creating the release", func() (err error) {
+		release, _, err = p.Releases.CreateRelease(ctx, p.Owner, p.Repo,
+			&github.RepositoryRelease{
+				TagName:    github.String(tag),
+				Name:       github.String(name),
+				Body:       github.String(body),
+				Prerelease: github.Bool(prerelease),
+				Draft:      github.Bool(true),
+			})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return githubRelease(release), nil
+}
+
+// GetReleaseByTag returns the release for tag, or nil if
+// there is none. GitHub does not find drafts by tag, so if
+// there is no published release, the drafts are searched.
+func (p *GitHubProvider) GetReleaseByTag(ctx context.Context, tag string) (*Release, error) {
+	var release *github.RepositoryRelease
+	var resp *github.Response
+	err := p.retryRateLimited(ctx, "getting the release", func() (err error) {
+		release, resp, err = p.Releases.GetReleaseByTag(ctx, p.Owner, p.Repo, tag)
+		return err
+	})
+	if err == nil {
+		return githubRelease(release), nil
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return nil, err
+	}
+
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		var releases []*github.RepositoryRelease
+		err := p.retryRateLimited(ctx, "listing releases", func() (err error) {
+			releases, resp, err = p.Releases.ListReleases(ctx, p.Owner, p.Repo, opt)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("listing releases: %w", err)
+		}
+		for _, release := range releases {
+			if release.GetDraft() && release.GetTagName() == tag {
+				return githubRelease(release), nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// GetRelease returns the release with the given ID,
+// or nil if there is none.
+func (p *GitHubProvider) GetRelease(ctx context.Context, id int64) (*Release, error) {
+	var release *github.RepositoryRelease
+	var resp *github.Response
+	err := p.retryRateLimited(ctx, "getting the release", func() (err error) {
+		release, resp, err = p.Releases.GetRelease(ctx, p.Owner, p.Repo, id)
+		return err
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return githubRelease(release), nil
+}
+
+// PublishRelease publishes rel, which must be a draft.
+func (p *GitHubProvider) PublishRelease(ctx context.Context, rel *Release) (*Release, error) {
+	var release *github.RepositoryRelease
+	err := p.retryRateLimited(ctx, "publishing the release", func() (err error) {
+		release, _, err = p.Releases.EditRelease(ctx, p.Owner, p.Repo,
+			rel.ID, &github.RepositoryRelease{Draft: github.Bool(false)})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return githubRelease(release), nil
+}
+
+// EditReleaseNotes replaces the body of rel with body.
+func (p *GitHubProvider) EditReleaseNotes(ctx context.Context, rel *Release, body string) error {
+	return p.retryRateLimited(ctx, "editing the release notes", func() (err error) {
+		_, _, err = p.Releases.EditRelease(ctx, p.Owner, p.Repo,
+			rel.ID, &github.RepositoryRelease{Body: github.String(body)})
+		return err
+	})
+}
+
+// ListAssets returns all the assets of rel.
+func (p *GitHubProvider) ListAssets(ctx context.Context, rel *Release) ([]Asset, error) {
+	var all []Asset
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		var assets []*github.ReleaseAsset
+		var resp *github.Response
+		err := p.retryRateLimited(ctx, "listing release assets", func() (err error) {
+			assets, resp, err = p.Releases.ListReleaseAssets(ctx, p.Owner, p.Repo, rel.ID, opt)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, asset := range assets {
+			all = append(all, githubAsset(asset))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return all, nil
+}
+
+// UploadAsset uploads the size bytes of body to rel
+// with the given name.
+func (p *GitHubProvider) UploadAsset(ctx context.Context, rel *Release, name string, body io.ReadSeeker, size int64) (Asset, error) {
+	u := fmt.Sprintf("repos/%s/%s/releases/%d/assets?name=%s",
+		p.Owner, p.Repo, rel.ID, url.QueryEscape(name))
+
+	asset := new(github.ReleaseAsset)
+	err := p.retryRateLimited(ctx, "uploading "+name, func() error {
+		if _, err := body.Seek(0, 0); err != nil {
+			return err
+		}
+		// the HTTP client closes a request body that can be
+		// closed once it's sent, so hide any Close of body
+		req, err := p.Uploads.NewUploadRequest(u, struct{ io.Reader }{body}, size, mime.TypeByExtension(filepath.Ext(name)))
+		if err != nil {
+			return err
+		}
+		_, err = p.Uploads.Do(ctx, req, asset)
+		return err
+	})
+	if err != nil {
+		return Asset{}, err
+	}
+	return githubAsset(asset), nil
+}
+
+// DownloadAsset downloads asset from rel through the API,
+// which works even while rel is a draft.
+func (p *GitHubProvider) DownloadAsset(ctx context.Context, rel *Release, asset Asset) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	var redirectURL string
+	err := p.retryRateLimited(ctx, "downloading "+asset.Name, func() (err error) {
+		rc, redirectURL, err = p.Releases.DownloadReleaseAsset(ctx, p.Owner, p.Repo, asset.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rc != nil {
+		return rc, nil
+	}
+	req, err := http.NewRequest("GET", redirectURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("preparing request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("network error: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("downloading %s: HTTP %d", asset.Name, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// DeleteAsset deletes asset from rel.
+func (p *GitHubProvider) DeleteAsset(ctx context.Context, rel *Release, asset Asset) error {
+	return p.retryRateLimited(ctx, "deleting "+asset.Name, func() error {
+		_, err := p.Releases.DeleteReleaseAsset(ctx, p.Owner, p.Repo, asset.ID)
+		return err
+	})
+}
+
+// DownloadURL returns the URL of the asset of rel with
+// the given name.
+func (p *GitHubProvider) DownloadURL(rel *Release, name string) string {
+	return fmt.Sprintf("https://github.com/%s/%s/releases/download/%s/%s",
+		p.Owner, p.Repo, url.PathEscape(rel.Tag), url.PathEscape(name))
+}
+
+// OpenMilestones returns all the open milestones.
+func (p *GitHubProvider) OpenMilestones(ctx context.Context) ([]Milestone, error) {
+	var all []Milestone
+	opt := &github.MilestoneListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		var milestones []*github.Milestone
+		var resp *github.Response
+		err := p.retryRateLimited(ctx, "listing milestones", func() (err error) {
+			milestones, resp, err = p.Milestones.ListMilestones(ctx, p.Owner, p.Repo, opt)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range milestones {
+			all = append(all, Milestone{ID: int64(m.GetNumber()), Title: m.GetTitle()})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return all, nil
+}
+
+// CloseMilestone closes m.
+func (p *GitHubProvider) CloseMilestone(ctx context.Context, m Milestone) error {
+	return p.retryRateLimited(ctx, "closing the milestone", func() (err error) {
+		_, _, err = p.Milestones.EditMilestone(ctx, p.Owner, p.Repo,
+			int(m.ID), &github.Milestone{State: github.String("closed")})
+		return err
+	})
+}
+
+// githubAsset converts a GitHub release asset to an Asset.
+func githubAsset(asset *github.ReleaseAsset) Asset {
+	return Asset{
+		ID:   asset.GetID(),
+		Name: asset.GetName(),
+		Size: int64(asset.GetSize()),
+	}
+}
+
+// githubRelease converts a GitHub release to a Release.
+func githubRelease(release *github.RepositoryRelease) *Release {
+	return &Release{
+		ID:    release.GetID(),
+		Tag:   release.GetTagName(),
+		Name:  release.GetName(),
+		URL:   release.GetHTMLURL(),
+		Draft: release.GetDraft(),
+	}
+}
+
+// maxRateLimitWait is the longest to wait for GitHub's
+// rate limit to reset; if it would take longer, the
+// request fails instead.
+const maxRateLimitWait = 15 * time.Minute
+
+// rateLimitRetries is how many times a rate-limited
+// request is retried before giving up.
+const rateLimitRetries = 5
+
+// retryRateLimited calls call, which makes a request to the
+// GitHub API for the purpose what. If the request is rate
+// limited, including by GitHub's secondary (abuse) limits, it
+// waits until the limit resets and calls it again, a few times
+// at most.
+func (p *GitHubProvider) retryRateLimited(ctx context.Context, what string, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := call()
+		wait, limited := rateLimitWait(err)
+		if !limited || attempt == rateLimitRetries || wait > maxRateLimitWait {
+			return err
+		}
+		if p.Log != nil {
+			p.Log.Warnf("GitHub rate limit hit while %s; retrying in %s", what, wait.Round(time.Second))
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// rateLimitWait returns how long to wait before retrying a
+// request that failed with err, and whether it failed because
+// it was rate limited at all.
+func rateLimitWait(err error) (time.Duration, bool) {
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		wait := time.Until(rateErr.Rate.Reset.Time) + time.Second
+		if wait < time.Second {
+			wait = time.Second
+		}
+		return wait, true
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil {
+			return *abuseErr.RetryAfter, true
+		}
+		return time.Minute, true // GitHub's advice when it doesn't say
+	}
+	return 0, false
+}
@@ -0,0 +1,323 @@
+package releaser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// GitLabProvider publishes releases on GitLab. GitLab
+// has no draft releases, so a release is visible as
+// soon as it is created, and uploaded assets are
+// attached to it as links.
+type GitLabProvider struct {
+	BaseURL string // e.g. "https://gitlab.com"
+	Project string // path of the project, e.g. "mholt/caddy", or its ID
+	Token   string // personal or project access token
+
+	// Client makes the API requests; if nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Name returns "GitLab".
+func (p *GitLabProvider) Name() string { return "GitLab" }
+
+// gitlabRelease is a release in the GitLab API.
+type gitlabRelease struct {
+	TagName string `json:"tag_name"`
+	Name    string `json:"name"`
+	Links   struct {
+		Self string `json:"self"`
+	} `json:"_links"`
+}
+
+// gitlabLink is a release asset link in the GitLab API.
+type gitlabLink struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// gitlabDeveloperAccess is the lowest access level of a
+// GitLab project member that can create releases.
+const gitlabDeveloperAccess = 30
+
+// CheckAccess returns an error if the token can't create
+// releases in the project: that is, if it doesn't have at
+// least Developer access to it, directly or by its group.
+func (p *GitLabProvider) CheckAccess(ctx context.Context) error {
+	type access struct {
+		AccessLevel int `json:"access_level"`
+	}
+	var project struct {
+		Permissions struct {
+			ProjectAccess *access `json:"project_access"`
+			GroupAccess   *access `json:"group_access"`
+		} `json:"permissions"`
+	}
+	err := p.do(ctx, "GET", "", nil, "", &project)
+	if glErr, ok := err.(*gitlabError); ok && glErr.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("the token is invalid or expired")
+	}
+	if isGitLabNotFound(err) {
+		return fmt.Errorf("project %s is not found, or the token can't see it", p.Project)
+	}
+	if err != nil {
+		return fmt.Errorf("getting project %s: %w", p.Project, err)
+	}
+	level := 0
+	for _, a := range []*access{project.Permissions.ProjectAccess, project.Permissions.GroupAccess} {
+		if a != nil && a.AccessLevel > level {
+			level = a.AccessLevel
+		}
+	}
+	if level < gitlabDeveloperAccess {
+		return fmt.Errorf("the token has access level %d to %s, but needs at least Developer (%d) to make releases",
+			level, p.Project, gitlabDeveloperAccess)
+	}
+	return nil
+}
+
+// HasTag returns true if GitLab sees tag.
+func (p *GitLabProvider) HasTag(ctx context.Context, tag string) (bool, error) {
+	err := p.do(ctx, "GET", "/repository/tags/"+url.PathEscape(tag), nil, "", nil)
+	if isGitLabNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CreateRelease makes a new release on GitLab. The
+// prerelease flag is ignored, since GitLab has no
+// equivalent.
+func (p *GitLabProvider) CreateRelease(ctx context.Context, tag, name, notes string, prerelease bool) (*Release, error) {
+	body, err := json.Marshal(map[string]string{"tag_name": tag, "name": name, "description": notes})
+	if err != nil {
+		return nil, err
+	}
+	var rel gitlabRelease
+	err = p.do(ctx, "POST", "/releases", bytes.NewReader(body), "application/json", &rel)
+	if err != nil {
+		return nil, err
+	}
+	return p.release(rel), nil
+}
+
+// GetReleaseByTag returns the release for tag, or
+// nil if there is none.
+func (p *GitLabProvider) GetReleaseByTag(ctx context.Context, tag string) (*Release, error) {
+	var rel gitlabRelease
+	err := p.do(ctx, "GET", "/releases/"+url.PathEscape(tag), nil, "", &rel)
+	if isGitLabNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.release(rel), nil
+}
+
+// GetRelease returns ErrNotSupported; GitLab releases
+// are keyed by tag, so there is at most one per tag.
+func (p *GitLabProvider) GetRelease(ctx context.Context, id int64) (*Release, error) {
+	return nil, ErrNotSupported
+}
+
+// PublishRelease returns rel unchanged, since
+// GitLab releases are always published.
+func (p *GitLabProvider) PublishRelease(ctx context.Context, rel *Release) (*Release, error) {
+	return rel, nil
+}
+
+// EditReleaseNotes replaces the description of rel with body.
+func (p *GitLabProvider) EditReleaseNotes(ctx context.Context, rel *Release, body string) error {
+	data, err := json.Marshal(map[string]string{"description": body})
+	if err != nil {
+		return err
+	}
+	return p.do(ctx, "PUT", "/releases/"+url.PathEscape(rel.Tag), bytes.NewReader(data), "application/json", nil)
+}
+
+// ListAssets returns the links attached to rel.
+func (p *GitLabProvider) ListAssets(ctx context.Context, rel *Release) ([]Asset, error) {
+	var links []gitlabLink
+	err := p.do(ctx, "GET", "/releases/"+url.PathEscape(rel.Tag)+"/assets/links?per_page=100", nil, "", &links)
+	if err != nil {
+		return nil, err
+	}
+	var assets []Asset
+	for _, link := range links {
+		assets = append(assets, Asset{ID: link.ID, Name: link.Name})
+	}
+	return assets, nil
+}
+
+// UploadAsset uploads body to the project, then links it
+// to rel with the given name. GitLab doesn't report the
+// size of the link, so the returned asset has none.
+func (p *GitLabProvider) UploadAsset(ctx context.Context, rel *Release, name string, body io.ReadSeeker, size int64) (Asset, error) {
+	// the form is written as the request is sent, so the
+	// file isn't held in memory and is read only as fast
+	// as it is uploaded
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		fw, err := mw.CreateFormFile("file", filepath.Base(name))
+		if err == nil {
+			_, err = io.Copy(fw, body)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	var upload struct {
+		URL string `json:"url"` // relative to the project's web URL
+	}
+	err := p.do(ctx, "POST", "/uploads", pr, mw.FormDataContentType(), &upload)
+	pr.Close() // stops the form being written if the request failed
+	<-written
+	if err != nil {
+		return Asset{}, fmt.Errorf("uploading file: %w", err)
+	}
+
+	data, err := json.Marshal(map[string]string{
+		"name":     name,
+		"url":      p.webURL() + upload.URL,
+		"filepath": "/" + name, // gives the permanent DownloadURL
+	})
+	if err != nil {
+		return Asset{}, err
+	}
+	var link gitlabLink
+	err = p.do(ctx, "POST", "/releases/"+url.PathEscape(rel.Tag)+"/assets/links",
+		bytes.NewReader(data), "application/json", &link)
+	if err != nil {
+		return Asset{}, fmt.Errorf("linking file to release: %w", err)
+	}
+	return Asset{ID: link.ID, Name: link.Name}, nil
+}
+
+// DownloadAsset returns ErrNotSupported; the uploaded file
+// is only reachable through the project's web URL.
+func (p *GitLabProvider) DownloadAsset(ctx context.Context, rel *Release, asset Asset) (io.ReadCloser, error) {
+	return nil, ErrNotSupported
+}
+
+// DeleteAsset removes the link to asset from rel.
+func (p *GitLabProvider) DeleteAsset(ctx context.Context, rel *Release, asset Asset) error {
+	return p.do(ctx, "DELETE", fmt.Sprintf("/releases/%s/assets/links/%d", url.PathEscape(rel.Tag), asset.ID), nil, "", nil)
+}
+
+// DownloadURL returns the permanent URL of the asset
+// of rel with the given name.
+func (p *GitLabProvider) DownloadURL(rel *Release, name string) string {
+	return p.webURL() + "/-/releases/" + url.PathEscape(rel.Tag) + "/downloads/" + url.PathEscape(name)
+}
+
+// OpenMilestones returns the project's active milestones.
+func (p *GitLabProvider) OpenMilestones(ctx context.Context) ([]Milestone, error) {
+	var found []struct {
+		ID    int64  `json:"id"`
+		Title string `json:"title"`
+	}
+	err := p.do(ctx, "GET", "/milestones?state=active&per_page=100", nil, "", &found)
+	if err != nil {
+		return nil, err
+	}
+	var milestones []Milestone
+	for _, m := range found {
+		milestones = append(milestones, Milestone{ID: m.ID, Title: m.Title})
+	}
+	return milestones, nil
+}
+
+// CloseMilestone closes m.
+func (p *GitLabProvider) CloseMilestone(ctx context.Context, m Milestone) error {
+	data, err := json.Marshal(map[string]string{"state_event": "close"})
+	if err != nil {
+		return err
+	}
+	return p.do(ctx, "PUT", fmt.Sprintf("/milestones/%d", m.ID), bytes.NewReader(data), "application/json", nil)
+}
+
+// webURL returns the URL of the project's web page.
+func (p *GitLabProvider) webURL() string {
+	return strings.TrimSuffix(p.BaseURL, "/") + "/" + p.Project
+}
+
+// release converts a GitLab release to a Release.
+func (p *GitLabProvider) release(rel gitlabRelease) *Release {
+	return &Release{
+		Tag:  rel.TagName,
+		Name: rel.Name,
+		URL:  rel.Links.Self,
+	}
+}
+
+// gitlabError is an error response from the GitLab API.
+type gitlabError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *gitlabError) Error() string {
+	return fmt.Sprintf("GitLab API: HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// isGitLabNotFound returns true if err is a 404
+// response from the GitLab API.
+func isGitLabNotFound(err error) bool {
+	glErr, ok := err.(*gitlabError)
+	return ok && glErr.StatusCode == http.StatusNotFound
+}
+
+// do makes a request to path under the project's API
+// endpoint, decoding the JSON response into v if it
+// is not nil.
+func (p *GitLabProvider) do(ctx context.Context, method, path string, body io.Reader, contentType string, v interface{}) error {
+	endpoint := strings.TrimSuffix(p.BaseURL, "/") + "/api/v4/projects/" + url.PathEscape(p.Project) + path
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("preparing request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("PRIVATE-TOKEN", p.Token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("network error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return &gitlabError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+	if v == nil {
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
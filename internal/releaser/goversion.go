@@ -0,0 +1,50 @@
+package releaser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GoVersion returns the version of the go command in the
+// PATH, which the builds use, such as "go1.10.3".
+func GoVersion() (string, error) {
+	out, err := Command("go", "version").Output()
+	if err != nil {
+		return "", fmt.Errorf("running go version: %w", err)
+	}
+	// the output is like "go version go1.10.3 linux/amd64"
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 {
+		return "", fmt.Errorf("unexpected output from go version: %s", strings.TrimSpace(string(out)))
+	}
+	return fields[2], nil
+}
+
+// goVersionMatches returns true if the Go version got is
+// the version want, which may leave off the "go" and any
+// trailing numbers: "1.10" matches "go1.10" and "go1.10.3",
+// but not "go1.11" or "go1.10rc1".
+func goVersionMatches(got, want string) bool {
+	if !strings.HasPrefix(want, "go") {
+		want = "go" + want
+	}
+	return got == want || strings.HasPrefix(got, want+".")
+}
+
+// checkGoVersion returns the version of Go that the builds
+// will use, and an error of kind ErrPreflight if
+// d.Config.GoVersion is set and that version doesn't
+// match it.
+func (d *Deployer) checkGoVersion() (string, error) {
+	got, err := GoVersion()
+	if err != nil {
+		return "", err
+	}
+	if d.Config.GoVersion != "" && !goVersionMatches(got, d.Config.GoVersion) {
+		return got, &DeployError{
+			Kind: ErrPreflight,
+			Msg:  fmt.Sprintf("builds would use %s, but Go %s is expected", got, strings.TrimPrefix(d.Config.GoVersion, "go")),
+		}
+	}
+	return got, nil
+}
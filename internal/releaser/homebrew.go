@@ -0,0 +1,164 @@
+package releaser
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultHomebrewFormula is the template of the Homebrew
+// formula used if no other template is configured.
+const defaultHomebrewFormula = `class Caddy < Formula
+  desc "Fast, cross-platform HTTP/2 web server with automatic HTTPS"
+  homepage "https://caddyserver.com"
+  version "{{.Version}}"
+{{- with .AMD64}}
+
+  if Hardware::CPU.intel?
+    url "{{.URL}}"
+    sha256 "{{.SHA256}}"
+  end
+{{- end}}
+{{- with .ARM64}}
+
+  if Hardware::CPU.arm?
+    url "{{.URL}}"
+    sha256 "{{.SHA256}}"
+  end
+{{- end}}
+
+  def install
+    bin.install "caddy"
+  end
+
+  test do
+    system "#{bin}/caddy", "-version"
+  end
+end
+`
+
+// HomebrewData is the data given to the Homebrew formula
+// template. The macOS assets are those uploaded for the
+// release, so the formula always matches them.
+type HomebrewData struct {
+	Tag     string // the release tag, e.g. "v0.10.12"
+	Version string // the tag without the "v", e.g. "0.10.12"
+
+	// AMD64 and ARM64 are the macOS assets for each
+	// architecture, or nil if there is none.
+	AMD64, ARM64 *AssetInfo
+}
+
+// ParseHomebrewTemplate parses the Homebrew formula
+// template in the file at path, or the default one if
+// path is empty.
+func ParseHomebrewTemplate(path string) (*template.Template, error) {
+	text := defaultHomebrewFormula
+	if path != "" {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading Homebrew formula template: %w", err)
+		}
+		text = string(contents)
+	}
+	tmpl, err := template.New("homebrew formula").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing Homebrew formula template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderHomebrewFormula executes tmpl for the release
+// described by result, which must have macOS assets; its
+// tag begins with tagPrefix.
+func renderHomebrewFormula(tmpl *template.Template, result *Result, tagPrefix string) (string, error) {
+	data := HomebrewData{
+		Tag:     result.Tag,
+		Version: TagVersion(result.Tag, tagPrefix),
+	}
+	for i, asset := range result.Assets {
+		switch asset.Platform {
+		case "darwin/amd64":
+			data.AMD64 = &result.Assets[i]
+		case "darwin/arm64":
+			data.ARM64 = &result.Assets[i]
+		}
+	}
+	if data.AMD64 == nil && data.ARM64 == nil {
+		return "", fmt.Errorf("no macOS assets were uploaded")
+	}
+
+	var sb strings.Builder
+	err := tmpl.Execute(&sb, data)
+	if err != nil {
+		return "", fmt.Errorf("executing Homebrew formula template: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// UpdateHomebrew renders the Homebrew formula for the release
+// described by result. If a tap is configured, the formula is
+// committed to it and pushed; otherwise it is written to the
+// configured formula path, relative to the current directory.
+func (d *Deployer) UpdateHomebrew(result *Result) error {
+	formula, err := renderHomebrewFormula(d.HomebrewFormula, result, d.Config.TagPrefix)
+	if err != nil {
+		return err
+	}
+
+	if d.Config.HomebrewTap == "" {
+		err = writeFormula(d.Config.HomebrewFormulaPath, formula)
+		if err != nil {
+			return err
+		}
+		d.Log.Infof("Wrote Homebrew formula to %s", d.Config.HomebrewFormulaPath)
+		return nil
+	}
+
+	tapDir, err := ioutil.TempDir("", "caddy_homebrew_")
+	if err != nil {
+		return fmt.Errorf("making temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tapDir)
+
+	d.Log.Infof("Cloning Homebrew tap %s", d.Config.HomebrewTap)
+	err = runIn("", "git", "clone", "--quiet", "--depth=1", d.Config.HomebrewTap, tapDir)
+	if err != nil {
+		return fmt.Errorf("cloning tap: %w", err)
+	}
+	err = writeFormula(filepath.Join(tapDir, d.Config.HomebrewFormulaPath), formula)
+	if err != nil {
+		return err
+	}
+	err = runIn(tapDir, "git", "add", d.Config.HomebrewFormulaPath)
+	if err != nil {
+		return fmt.Errorf("adding formula: %w", err)
+	}
+	err = runIn(tapDir, "git", "commit", "--quiet", "-m", "caddy "+TagVersion(result.Tag, d.Config.TagPrefix))
+	if err != nil {
+		return fmt.Errorf("committing formula: %w", err)
+	}
+	d.Log.Infof("Pushing Homebrew formula")
+	err = runIn(tapDir, "git", "push", "--quiet")
+	if err != nil {
+		return fmt.Errorf("pushing tap: %w", err)
+	}
+	return nil
+}
+
+// writeFormula writes formula to the file at path,
+// creating its directory if needed.
+func writeFormula(path, formula string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path, []byte(formula), 0644)
+	if err != nil {
+		return fmt.Errorf("writing Homebrew formula: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package releaser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// TestDeployIntegration deploys a new release of a throwaway
+// repo end to end: it is tagged and pushed to a bare repo,
+// released on a fake GitHub API, and deployed to a fake
+// build server.
+func TestDeployIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	newTestSigningKey(t)
+
+	repo := newTestRepo(t)
+	remote := t.TempDir()
+	runGit(t, remote, "init", "--bare", "--quiet")
+	runGit(t, repo, "remote", "add", "origin", remote)
+	runGit(t, repo, "push", "--quiet", "--set-upstream", "origin", "HEAD")
+
+	gh := &fakeGitHub{t: t, remote: remote, assets: make(map[string][]byte)}
+	ghServer := httptest.NewServer(gh)
+	defer ghServer.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(ghServer.URL + "/")
+	client.UploadURL, _ = url.Parse(ghServer.URL + "/uploads/")
+
+	bs := &fakeBuildServer{t: t}
+	bsServer := httptest.NewServer(bs)
+	defer bsServer.Close()
+
+	cfg := DefaultConfig()
+	cfg.GitHubOwner, cfg.GitHubRepo = "caddyserver", "caddy"
+	cfg.WebsiteURL = bsServer.URL
+	cfg.DevportalID, cfg.DevportalKey = "me", "secret"
+	cfg.TempDir = t.TempDir()
+	channel, err := cfg.Channel("stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := cfg.Environment("production")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Deployer{
+		Config:      cfg,
+		Channel:     channel,
+		Environment: env,
+		RepoDir:     repo,
+		OpenEnv:     openFakeEnv,
+		Log:         testLogger{t},
+		Provider: &GitHubProvider{
+			Owner:      cfg.GitHubOwner,
+			Repo:       cfg.GitHubRepo,
+			Releases:   client.Repositories,
+			Refs:       client.Git,
+			Milestones: client.Issues,
+			Uploads:    client,
+		},
+		TagWait:       10 * time.Second,
+		DeployTimeout: 10 * time.Second,
+		SkipChecks:    true,
+	}
+
+	result, err := d.Deploy(context.Background(), "v1.2.3", false, testPlatforms, StageNew)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the signed tag was pushed
+	if !result.TagPushed {
+		t.Error("result says the tag was not pushed")
+	}
+	pushed := strings.TrimSpace(runGit(t, remote, "rev-parse", "refs/tags/v1.2.3^{commit}"))
+	if head := strings.TrimSpace(runGit(t, repo, "rev-parse", "HEAD")); pushed != head {
+		t.Errorf("the remote's tag points to %q, want %q", pushed, head)
+	}
+	runGit(t, repo, "verify-tag", "v1.2.3")
+
+	// the assets were uploaded to the release,
+	// which was published
+	gh.mu.Lock()
+	release := gh.release
+	var uploaded []string
+	for name := range gh.assets {
+		uploaded = append(uploaded, name)
+	}
+	gh.mu.Unlock()
+	sort.Strings(uploaded)
+	if release == nil {
+		t.Fatal("no release was made")
+	}
+	if release.GetTagName() != "v1.2.3" || release.GetName() != "1.2.3" {
+		t.Errorf("release is for tag %q, named %q; want v1.2.3, named 1.2.3", release.GetTagName(), release.GetName())
+	}
+	if release.GetDraft() {
+		t.Error("the release was left as a draft")
+	}
+	want := []string{
+		"caddy_linux_amd64.tar.gz",
+		"caddy_windows_amd64.zip",
+		checksumsFilename,
+		manifestFilename,
+	}
+	if !reflect.DeepEqual(uploaded, want) {
+		t.Errorf("uploaded %q, want %q", uploaded, want)
+	}
+
+	// and the build server was told about them
+	if !result.BuildServerDeployed {
+		t.Error("result says the build server deploy was not made")
+	}
+	bs.mu.Lock()
+	requests := bs.requests
+	bs.mu.Unlock()
+	if len(requests) != 1 {
+		t.Fatalf("build server got %d deploy requests, want 1", len(requests))
+	}
+	if requests[0].CaddyVersion != "v1.2.3" {
+		t.Errorf("build server deployed %q, want v1.2.3", requests[0].CaddyVersion)
+	}
+	var deployed []string
+	for _, asset := range requests[0].Assets {
+		deployed = append(deployed, asset.Name)
+	}
+	sort.Strings(deployed)
+	if want := want[:2]; !reflect.DeepEqual(deployed, want) {
+		t.Errorf("build server got assets %q, want %q", deployed, want)
+	}
+}
+
+// newTestSigningKey makes a GPG signing key without a
+// passphrase for testCommitter, in a new GNUPGHOME that
+// is used until the test ends, and returns its fingerprint.
+// The test is skipped if gpg is not installed.
+func newTestSigningKey(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	oldHome, hadHome := os.LookupEnv("GNUPGHOME")
+	os.Setenv("GNUPGHOME", t.TempDir())
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+		if hadHome {
+			os.Setenv("GNUPGHOME", oldHome)
+		} else {
+			os.Unsetenv("GNUPGHOME")
+		}
+	})
+
+	gen := exec.Command("gpg", "--batch", "--pinentry-mode", "loopback", "--passphrase", "",
+		"--quick-gen-key", "Test <"+testCommitter+">", "ed25519", "sign", "never")
+	if out, err := gen.CombinedOutput(); err != nil {
+		t.Fatalf("generating GPG key: %v: %s", err, out)
+	}
+	out, err := exec.Command("gpg", "--list-secret-keys", "--with-colons").Output()
+	if err != nil {
+		t.Fatalf("listing GPG keys: %v", err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Split(line, ":"); fields[0] == "fpr" && len(fields) > 9 {
+			return fields[9]
+		}
+	}
+	t.Fatalf("no fingerprint in GPG key listing: %s", out)
+	return ""
+}
+
+// fakeGitHub is the part of the GitHub API that a deploy
+// uses, for a repo with at most one release. It sees the
+// tags pushed to the bare repo at remote.
+type fakeGitHub struct {
+	t      *testing.T
+	remote string
+
+	// pause, if not nil, is sent on once an upload has read
+	// its first pauseAfter bytes, and the upload then waits
+	// to receive from it before reading the rest.
+	pause chan struct{}
+
+	mu      sync.Mutex
+	release *github.RepositoryRelease
+	assets  map[string][]byte // by name
+}
+
+// pauseAfter is how much of an upload a fakeGitHub
+// reads before pausing it.
+const pauseAfter = 1 << 20
+
+func (g *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	const repo = "/repos/caddyserver/caddy"
+	path := r.URL.Path
+	switch {
+	case r.Method == "GET" && strings.HasPrefix(path, repo+"/git/refs/tags/"):
+		ref := strings.TrimPrefix(path, repo+"/git/")
+		cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", ref)
+		cmd.Dir = g.remote
+		sha, err := cmd.Output()
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, &github.Reference{
+			Ref:    github.String(ref),
+			Object: &github.GitObject{Type: github.String("tag"), SHA: github.String(strings.TrimSpace(string(sha)))},
+		})
+
+	case r.Method == "GET" && strings.HasPrefix(path, repo+"/releases/tags/"):
+		// like GitHub, drafts aren't found by tag
+		if g.release == nil || g.release.GetDraft() || g.release.GetTagName() != strings.TrimPrefix(path, repo+"/releases/tags/") {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, g.release)
+
+	case r.Method == "GET" && path == repo+"/releases":
+		releases := []*github.RepositoryRelease{}
+		if g.release != nil {
+			releases = append(releases, g.release)
+		}
+		writeJSON(w, http.StatusOK, releases)
+
+	case r.Method == "POST" && path == repo+"/releases":
+		var release github.RepositoryRelease
+		if err := json.NewDecoder(r.Body).Decode(&release); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		release.ID = github.Int64(1)
+		release.HTMLURL = github.String("https://github.com/caddyserver/caddy/releases/tag/" + release.GetTagName())
+		g.release = &release
+		writeJSON(w, http.StatusCreated, g.release)
+
+	case r.Method == "PATCH" && path == repo+"/releases/1" && g.release != nil:
+		var edit github.RepositoryRelease
+		if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if edit.Draft != nil {
+			g.release.Draft = edit.Draft
+		}
+		if edit.Body != nil {
+			g.release.Body = edit.Body
+		}
+		writeJSON(w, http.StatusOK, g.release)
+
+	case r.Method == "GET" && path == repo+"/releases/1/assets" && g.release != nil:
+		assets := []*github.ReleaseAsset{}
+		for name, data := range g.assets {
+			assets = append(assets, &github.ReleaseAsset{Name: github.String(name), Size: github.Int(len(data))})
+		}
+		writeJSON(w, http.StatusOK, assets)
+
+	case r.Method == "POST" && path == "/uploads"+repo+"/releases/1/assets" && g.release != nil:
+		name := r.URL.Query().Get("name")
+		body := io.Reader(r.Body)
+		if g.pause != nil {
+			head := make([]byte, pauseAfter)
+			if _, err := io.ReadFull(r.Body, head); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			g.pause <- struct{}{}
+			<-g.pause
+			body = io.MultiReader(bytes.NewReader(head), r.Body)
+		}
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		g.assets[name] = data
+		writeJSON(w, http.StatusCreated, &github.ReleaseAsset{
+			ID:   github.Int64(int64(len(g.assets))),
+			Name: github.String(name),
+			Size: github.Int(len(data)),
+		})
+
+	default:
+		g.t.Errorf("unexpected request to GitHub: %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+	}
+}
+
+// fakeBuildServer is a build server that accepts deploy
+// requests, and reports every deploy as live at once.
+type fakeBuildServer struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	requests []deployRequest
+}
+
+func (s *fakeBuildServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if id, key, ok := r.BasicAuth(); !ok || id != "me" || key != "secret" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/api/deploy-caddy":
+		var req deployRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		s.mu.Unlock()
+
+	case r.Method == "GET" && r.URL.Path == "/api/deploy-caddy/status":
+		writeJSON(w, http.StatusOK, buildServerStatus{Status: "live"})
+
+	default:
+		s.t.Errorf("unexpected request to the build server: %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+	}
+}
+
+// writeJSON writes v as the JSON body of a
+// response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Fprintln(w, err)
+	}
+}
@@ -0,0 +1,58 @@
+package releaser
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// keepFile moves the file at path, which has been uploaded,
+// into d.KeepAssets with the given name, if that is set, so
+// that it outlasts the deploy. Failing to only warns, since
+// the file is published either way.
+func (d *Deployer) keepFile(path, name string) {
+	if d.KeepAssets == "" {
+		return
+	}
+	if err := moveFile(path, filepath.Join(d.KeepAssets, name)); err != nil {
+		d.Log.Warnf("Keeping %s: %v", name, err)
+	}
+}
+
+// keepData writes data, which has been uploaded as a file
+// with the given name, into d.KeepAssets, if that is set.
+func (d *Deployer) keepData(name string, data []byte) {
+	if d.KeepAssets == "" {
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(d.KeepAssets, name), data, 0644); err != nil {
+		d.Log.Warnf("Keeping %s: %v", name, err)
+	}
+}
+
+// moveFile moves the file at src to dst, copying it if
+// they are on different file systems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
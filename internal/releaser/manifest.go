@@ -0,0 +1,81 @@
+package releaser
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// manifestFilename is the name of the release asset
+// that describes the release and its other assets.
+const manifestFilename = "manifest.json"
+
+// Manifest describes a release and its downloads in a
+// form that programs, such as update checkers, can read.
+// It is uploaded to the release as manifest.json.
+type Manifest struct {
+	Version     string          `json:"version"`      // the tag, e.g. "v0.10.12"
+	Commit      string          `json:"commit"`       // the SHA of the tagged commit
+	ShortCommit string          `json:"short_commit"` // the abbreviated SHA, as git shows it
+	BuildTime   time.Time       `json:"build_time"`   // when the assets were built
+	GoVersion   string          `json:"go_version"`   // e.g. "go1.10.3"
+	Assets      []ManifestAsset `json:"assets"`
+}
+
+// ManifestAsset is a downloadable asset in a Manifest.
+// The source archive has no OS or architecture.
+type ManifestAsset struct {
+	OS       string `json:"os,omitempty"`
+	Arch     string `json:"arch,omitempty"`
+	ARM      string `json:"arm,omitempty"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+}
+
+// makeManifest returns the manifest of the release
+// described by result, whose assets for platforms were
+// built at buildTime.
+func makeManifest(result *Result, buildTime time.Time, platforms []buildworker.Platform) Manifest {
+	manifest := Manifest{
+		Version:     result.Tag,
+		Commit:      result.Commit,
+		ShortCommit: result.ShortCommit,
+		BuildTime:   buildTime.UTC(),
+		GoVersion:   result.GoVersion,
+	}
+
+	byName := make(map[string]buildworker.Platform)
+	for _, plat := range platforms {
+		byName[plat.String()] = plat
+	}
+	for _, asset := range result.Assets {
+		plat := byName[asset.Platform]
+		manifest.Assets = append(manifest.Assets, ManifestAsset{
+			OS:       plat.OS,
+			Arch:     plat.Arch,
+			ARM:      plat.ARM,
+			Filename: asset.Name,
+			Size:     asset.Size,
+			SHA256:   asset.SHA256,
+		})
+	}
+	sort.Slice(manifest.Assets, func(i, j int) bool {
+		return manifest.Assets[i].Filename < manifest.Assets[j].Filename
+	})
+	return manifest
+}
+
+// uploadManifest uploads the manifest of the release
+// described by result, with uploader; dir is where the
+// file is written first.
+func (d *Deployer) uploadManifest(ctx context.Context, uploader *releaseUploader, result *Result, buildTime time.Time, platforms []buildworker.Platform, dir string) error {
+	data, err := json.MarshalIndent(makeManifest(result, buildTime, platforms), "", "\t")
+	if err != nil {
+		return err
+	}
+	return d.uploadFile(ctx, uploader, dir, manifestFilename, append(data, '\n'))
+}
@@ -0,0 +1,120 @@
+package releaser
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/caddyserver/buildworker"
+)
+
+// ParsePlatform parses s, which is in the form "os/arch/arm",
+// into a platform. Trailing parts may be omitted, and any part
+// may be empty to match all values of that part; for example,
+// "darwin" or "//5".
+func ParsePlatform(s string) (buildworker.Platform, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) > 3 {
+		return buildworker.Platform{}, fmt.Errorf("platform %q: expected at most os/arch/arm", s)
+	}
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	if parts[0] == "" && parts[1] == "" && parts[2] == "" {
+		return buildworker.Platform{}, fmt.Errorf("platform %q: at least one of os, arch, or arm must be set", s)
+	}
+	return buildworker.Platform{OS: parts[0], Arch: parts[1], ARM: parts[2]}, nil
+}
+
+// ParsePlatforms parses each entry of list with ParsePlatform.
+func ParsePlatforms(list []string) ([]buildworker.Platform, error) {
+	var plats []buildworker.Platform
+	for _, s := range list {
+		plat, err := ParsePlatform(s)
+		if err != nil {
+			return nil, err
+		}
+		plats = append(plats, plat)
+	}
+	return plats, nil
+}
+
+// ResolvePlatforms returns the platforms to build: all those
+// supported by buildworker, except the ones in skipList and
+// the ones buildworker knows to be unsupported.
+func ResolvePlatforms(skipList []string) ([]buildworker.Platform, error) {
+	skip, err := ParsePlatforms(skipList)
+	if err != nil {
+		return nil, err
+	}
+	skip = append(skip, buildworker.UnsupportedPlatforms...)
+	return buildworker.SupportedPlatforms(skip)
+}
+
+// SelectPlatform returns the one platform supported by
+// buildworker that matches s, which is in the form
+// "os/arch" or "os/arch/arm". The skip list is not
+// consulted. An error is returned if s does not match
+// exactly one supported platform.
+func SelectPlatform(s string) (buildworker.Platform, error) {
+	want, err := ParsePlatform(s)
+	if err != nil {
+		return want, err
+	}
+	if want.OS == "" || want.Arch == "" {
+		return want, fmt.Errorf("platform %q: both os and arch are required", s)
+	}
+
+	supported, err := buildworker.SupportedPlatforms(buildworker.UnsupportedPlatforms)
+	if err != nil {
+		return want, err
+	}
+
+	var matches []buildworker.Platform
+	for _, plat := range supported {
+		if plat.OS == want.OS && plat.Arch == want.Arch &&
+			(want.ARM == "" || plat.ARM == want.ARM) {
+			matches = append(matches, plat)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return want, fmt.Errorf("platform %q is not supported", s)
+	case 1:
+		return matches[0], nil
+	}
+	return want, fmt.Errorf("platform %q is ambiguous; specify the ARM version, e.g. %s/%s/%s",
+		s, want.OS, want.Arch, matches[len(matches)-1].ARM)
+}
+
+// SelectPlatforms returns the platforms matching each entry
+// of list, as SelectPlatform does, in the same order. This
+// is an allowlist, so the skip list is not consulted. Each
+// entry must match a different platform.
+func SelectPlatforms(list []string) ([]buildworker.Platform, error) {
+	var plats []buildworker.Platform
+	seen := make(map[buildworker.Platform]bool)
+	for _, s := range list {
+		plat, err := SelectPlatform(s)
+		if err != nil {
+			return nil, err
+		}
+		if seen[plat] {
+			return nil, fmt.Errorf("platform %s is listed more than once", plat)
+		}
+		seen[plat] = true
+		plats = append(plats, plat)
+	}
+	return plats, nil
+}
+
+// BuildLogPath returns the path of the file in dir to
+// which the build log for plat is written.
+func BuildLogPath(dir string, plat buildworker.Platform) string {
+	name := "build_" + plat.OS + "_" + plat.Arch
+	if plat.ARM != "" {
+		name += "_arm" + plat.ARM
+	}
+	return filepath.Join(dir, name+".log")
+}
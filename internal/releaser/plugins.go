@@ -0,0 +1,97 @@
+package releaser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/caddyserver/buildworker"
+)
+
+// PluginConfig is a plugin to build into Caddy, as listed
+// in a plugins file.
+type PluginConfig struct {
+	Package string `json:"package" toml:"package"` // import path, e.g. "github.com/captncraig/cors"
+	Version string `json:"version" toml:"version"` // a tag, branch, or commit of the plugin
+	Name    string `json:"name" toml:"name"`       // optional, e.g. "http.cors"
+	ID      string `json:"id" toml:"id"`           // optional ID of the plugin at caddyserver.com
+}
+
+// pluginsFile is the contents of a plugins file.
+type pluginsFile struct {
+	Plugins []PluginConfig `json:"plugins" toml:"plugins"`
+}
+
+// LoadPlugins returns the plugins listed in the file at
+// path, which is decoded as TOML if its name ends in .toml
+// and as JSON otherwise. Every plugin must have a package
+// and a version, so builds are reproducible.
+func LoadPlugins(path string) ([]buildworker.CaddyPlugin, error) {
+	var file pluginsFile
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		if _, err := toml.DecodeFile(path, &file); err != nil {
+			return nil, fmt.Errorf("decoding plugins file %s: %w", path, err)
+		}
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening plugins file: %w", err)
+		}
+		defer f.Close()
+		if err := json.NewDecoder(f).Decode(&file); err != nil {
+			return nil, fmt.Errorf("decoding plugins file %s: %w", path, err)
+		}
+	}
+
+	var plugins []buildworker.CaddyPlugin
+	seen := make(map[string]bool)
+	for i, p := range file.Plugins {
+		if p.Package == "" {
+			return nil, fmt.Errorf("plugins file %s: plugin %d has no package", path, i+1)
+		}
+		if p.Version == "" {
+			return nil, fmt.Errorf("plugins file %s: plugin %s has no version", path, p.Package)
+		}
+		if seen[p.Package] {
+			return nil, fmt.Errorf("plugins file %s: plugin %s is listed more than once", path, p.Package)
+		}
+		seen[p.Package] = true
+		plugins = append(plugins, buildworker.CaddyPlugin{
+			Package: p.Package,
+			Version: p.Version,
+			Name:    p.Name,
+			ID:      p.ID,
+		})
+	}
+	return plugins, nil
+}
+
+// pluginList returns each of plugins as "package@version".
+func pluginList(plugins []buildworker.CaddyPlugin) []string {
+	var list []string
+	for _, p := range plugins {
+		list = append(list, p.Package+"@"+p.Version)
+	}
+	return list
+}
+
+// pluginNotes returns release notes listing the plugins
+// built into the release, or "" if there are none.
+func pluginNotes(plugins []buildworker.CaddyPlugin) string {
+	if len(plugins) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("This release is built with the following plugins:\n\n")
+	for _, p := range plugins {
+		if p.Name != "" {
+			fmt.Fprintf(&sb, "- %s (`%s` %s)\n", p.Name, p.Package, p.Version)
+		} else {
+			fmt.Fprintf(&sb, "- `%s` %s\n", p.Package, p.Version)
+		}
+	}
+	return sb.String()
+}
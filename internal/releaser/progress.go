@@ -0,0 +1,122 @@
+package releaser
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UploadProgress is how far an upload has got.
+type UploadProgress struct {
+	Name string
+	Sent int64 // bytes of the request body read so far
+	Size int64
+}
+
+// progressInterval is how often upload progress is reported.
+const progressInterval = 500 * time.Millisecond
+
+// uploadTracker keeps track of the files being uploaded so
+// their progress can be reported. Progress is measured by
+// how far the body of each upload request has been read.
+// It is safe for concurrent use.
+type uploadTracker struct {
+	mu     sync.Mutex
+	bodies map[string]*uploadBody // by asset name
+}
+
+func newUploadTracker() *uploadTracker {
+	return &uploadTracker{bodies: make(map[string]*uploadBody)}
+}
+
+// track starts tracking the upload of file, which is size
+// bytes long, as name, and returns the body to upload it with.
+func (t *uploadTracker) track(name string, file *os.File, size int64) *uploadBody {
+	body := &uploadBody{file: file, size: size}
+	t.mu.Lock()
+	t.bodies[name] = body
+	t.mu.Unlock()
+	return body
+}
+
+// untrack stops tracking the upload named name.
+func (t *uploadTracker) untrack(name string) {
+	t.mu.Lock()
+	delete(t.bodies, name)
+	t.mu.Unlock()
+}
+
+// progress returns the progress of the uploads being
+// tracked, sorted by name.
+func (t *uploadTracker) progress() []UploadProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var all []UploadProgress
+	for name, body := range t.bodies {
+		all = append(all, UploadProgress{
+			Name: name,
+			Sent: atomic.LoadInt64(&body.offset),
+			Size: body.size,
+		})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// uploadBody is the body of an upload request: it reads
+// from file, keeping count of how far it has got. It has no
+// Close method, so that the HTTP client, which closes the
+// request bodies that can be, leaves file open to verify
+// the upload with.
+type uploadBody struct {
+	file   *os.File
+	size   int64
+	offset int64 // accessed atomically
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	n, err := b.file.Read(p)
+	atomic.AddInt64(&b.offset, int64(n))
+	return n, err
+}
+
+// Seek seeks file, to upload it again.
+func (b *uploadBody) Seek(offset int64, whence int) (int64, error) {
+	pos, err := b.file.Seek(offset, whence)
+	if err == nil {
+		atomic.StoreInt64(&b.offset, pos)
+	}
+	return pos, err
+}
+
+// reportProgress calls d.ReportProgress with the progress
+// of the uploads tracked by t every progressInterval, until
+// the returned function is called. It does nothing if
+// d.ReportProgress is nil.
+func (d *Deployer) reportProgress(t *uploadTracker) (stop func()) {
+	if d.ReportProgress == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.ReportProgress(t.progress())
+			case <-done:
+				d.ReportProgress(nil)
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
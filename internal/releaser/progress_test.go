@@ -0,0 +1,78 @@
+package releaser
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestUploadProgress(t *testing.T) {
+	gh := &fakeGitHub{
+		t:       t,
+		pause:   make(chan struct{}),
+		release: &github.RepositoryRelease{ID: github.Int64(1), TagName: github.String("v1.2.3")},
+		assets:  make(map[string][]byte),
+	}
+	server := httptest.NewServer(gh)
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	client.UploadURL, _ = url.Parse(server.URL + "/uploads/")
+	provider := &GitHubProvider{
+		Owner:    "caddyserver",
+		Repo:     "caddy",
+		Releases: client.Repositories,
+		Refs:     client.Git,
+		Uploads:  client,
+	}
+
+	// big enough that it can't all be buffered
+	// on its way to the server
+	const name, size = "caddy_linux_amd64.tar.gz", 32 << 20
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tracker := newUploadTracker()
+	body := tracker.track(name, file, size)
+	uploaded := make(chan error, 1)
+	go func() {
+		_, err := provider.UploadAsset(context.Background(), &Release{ID: 1, Tag: "v1.2.3"}, name, body, size)
+		uploaded <- err
+	}()
+
+	<-gh.pause
+	during := tracker.progress()
+	gh.pause <- struct{}{}
+	if err := <-uploaded; err != nil {
+		t.Fatal(err)
+	}
+	after := tracker.progress()
+
+	if len(during) != 1 || during[0].Name != name || during[0].Size != size {
+		t.Fatalf("progress during the upload is %+v, want one upload of %s, %d bytes", during, name, size)
+	}
+	if sent := during[0].Sent; sent < pauseAfter || sent >= size {
+		t.Errorf("%d bytes were sent when the server had read %d, want at least that and less than %d", sent, pauseAfter, size)
+	}
+	if len(after) != 1 || after[0].Sent != size {
+		t.Errorf("progress after the upload is %+v, want all %d bytes sent", after, size)
+	}
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	if got := len(gh.assets[name]); got != size {
+		t.Errorf("server got %d bytes, want %d", got, size)
+	}
+}
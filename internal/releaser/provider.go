@@ -0,0 +1,137 @@
+package releaser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Provider publishes releases on a code hosting
+// service, such as GitHub or GitLab.
+type Provider interface {
+	// Name is the name of the service, for messages.
+	Name() string
+
+	// CheckAccess returns an error if the credentials
+	// can't be used to publish releases.
+	CheckAccess(ctx context.Context) error
+
+	// HasTag returns true if the service sees tag,
+	// which has been pushed to it.
+	HasTag(ctx context.Context, tag string) (bool, error)
+
+	// CreateRelease makes a new release for tag, with
+	// body as its release notes. If the service supports
+	// it, the release is a draft until PublishRelease is
+	// called.
+	CreateRelease(ctx context.Context, tag, name, body string, prerelease bool) (*Release, error)
+
+	// GetReleaseByTag returns the release for tag,
+	// even if it is a draft, or nil if there is none.
+	GetReleaseByTag(ctx context.Context, tag string) (*Release, error)
+
+	// GetRelease returns the release with the given ID,
+	// even if it is a draft, or nil if there is none. It
+	// returns ErrNotSupported if releases have no IDs.
+	GetRelease(ctx context.Context, id int64) (*Release, error)
+
+	// PublishRelease makes a draft release visible.
+	PublishRelease(ctx context.Context, rel *Release) (*Release, error)
+
+	// EditReleaseNotes replaces the release notes of rel
+	// with body.
+	EditReleaseNotes(ctx context.Context, rel *Release, body string) error
+
+	// ListAssets returns the assets attached to rel.
+	ListAssets(ctx context.Context, rel *Release) ([]Asset, error)
+
+	// UploadAsset attaches the size bytes of body to
+	// rel as an asset with the given name, returning
+	// the asset as the service stored it. The body is
+	// at its start, and may be seeked back to it to
+	// retry the upload.
+	UploadAsset(ctx context.Context, rel *Release, name string, body io.ReadSeeker, size int64) (Asset, error)
+
+	// DeleteAsset removes asset from rel.
+	DeleteAsset(ctx context.Context, rel *Release, asset Asset) error
+
+	// DownloadAsset returns the contents of asset as the
+	// service stored them, or ErrNotSupported if they
+	// can't be downloaded before rel is published.
+	DownloadAsset(ctx context.Context, rel *Release, asset Asset) (io.ReadCloser, error)
+
+	// DownloadURL returns the URL from which the asset
+	// of rel with the given name can be downloaded once
+	// rel is published.
+	DownloadURL(rel *Release, name string) string
+
+	// OpenMilestones returns the milestones that
+	// are still open.
+	OpenMilestones(ctx context.Context) ([]Milestone, error)
+
+	// CloseMilestone closes m.
+	CloseMilestone(ctx context.Context, m Milestone) error
+}
+
+// Release is a release on a Provider.
+type Release struct {
+	ID    int64 // zero if the provider keys releases by tag
+	Tag   string
+	Name  string
+	URL   string // web page of the release
+	Draft bool
+}
+
+// Milestone is a milestone on a Provider, by
+// which releases can be planned.
+type Milestone struct {
+	ID    int64 // GitHub's number or GitLab's ID
+	Title string
+}
+
+// Asset is a file attached to a Release.
+type Asset struct {
+	ID   int64
+	Name string
+	Size int64 // zero if the provider doesn't report it
+}
+
+// tagWaitFallback is how long to wait for the provider to
+// see a pushed tag if it can't be asked whether it does.
+const tagWaitFallback = 5 * time.Second
+
+// WaitForTag polls the provider until it sees tag, for up
+// to timeout. If the provider can't be polled, it just waits
+// for tagWaitFallback, which is usually long enough. It
+// stops early if ctx is cancelled.
+func (d *Deployer) WaitForTag(ctx context.Context, tag string, timeout time.Duration) error {
+	start := time.Now()
+	for {
+		ok, err := d.Provider.HasTag(ctx, tag)
+		if err := interrupted(ctx); err != nil {
+			return err
+		}
+		if err != nil {
+			d.Log.Warnf("Checking for tag on %s: %v; waiting %s instead", d.Provider.Name(), err, tagWaitFallback)
+			select {
+			case <-time.After(tagWaitFallback):
+			case <-ctx.Done():
+				return interrupted(ctx)
+			}
+			return nil
+		}
+		if ok {
+			d.Log.Infof("%s sees tag %s after %s", d.Provider.Name(), tag, time.Since(start).Round(time.Second))
+			return nil
+		}
+		if time.Since(start) > timeout {
+			return fmt.Errorf("%s did not see tag %s within %s", d.Provider.Name(), tag, timeout)
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return interrupted(ctx)
+		}
+	}
+}
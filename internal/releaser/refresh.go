@@ -0,0 +1,153 @@
+package releaser
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// RefreshChecksums recomputes the checksums file of the
+// published release for tag from its assets as they are
+// stored by the provider, and replaces the old checksums
+// file (and its signature), if any, with it. This fixes
+// releases whose checksums file is missing or wrong, such
+// as those made before there was one. Each asset has to
+// be downloaded, so the provider must support that.
+func (d *Deployer) RefreshChecksums(ctx context.Context, tag string) error {
+	if d.SignAssets {
+		if err := d.CheckSigning(); err != nil {
+			return &DeployError{Kind: ErrPreflight, Msg: "signing", Err: err}
+		}
+	}
+	release, err := d.Provider.GetReleaseByTag(ctx, tag)
+	if err != nil {
+		return fmt.Errorf("getting release: %w", err)
+	}
+	if release == nil {
+		return fmt.Errorf("no published release for %s on %s", tag, d.Provider.Name())
+	}
+
+	assets, err := d.Provider.ListAssets(ctx, release)
+	if err != nil {
+		return fmt.Errorf("listing release assets: %w", err)
+	}
+
+	var infos []AssetInfo
+	var old []Asset
+	for _, asset := range assets {
+		if asset.Name == checksumsFilename || asset.Name == checksumsFilename+".asc" {
+			old = append(old, asset)
+			continue
+		}
+		if strings.HasSuffix(asset.Name, ".asc") || strings.HasSuffix(asset.Name, assetChecksumExt) || asset.Name == manifestFilename {
+			continue // signatures, checksums, and the manifest aren't listed in the checksums file
+		}
+
+		d.Log.Infof("Downloading %s", asset.Name)
+		info, err := d.hashRemoteAsset(ctx, release, asset)
+		if errors.Is(err, ErrNotSupported) {
+			return fmt.Errorf("%s assets can't be downloaded to compute their checksums", d.Provider.Name())
+		}
+		if err != nil {
+			return fmt.Errorf("downloading %s: %w", asset.Name, err)
+		}
+		infos = append(infos, info)
+	}
+	if len(infos) == 0 {
+		return fmt.Errorf("release for %s has no assets", tag)
+	}
+
+	// only now that the new checksums are known
+	for _, asset := range old {
+		d.Log.Infof("Deleting old %s", asset.Name)
+		err := d.Provider.DeleteAsset(ctx, release, asset)
+		if err != nil {
+			return fmt.Errorf("deleting old %s: %w", asset.Name, err)
+		}
+	}
+
+	dir, err := ioutil.TempDir(d.Config.StagingDir(), "caddy_checksums_")
+	if err != nil {
+		return fmt.Errorf("making temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	uploader, err := d.newReleaseUploader(ctx, tag, release)
+	if err != nil {
+		return err
+	}
+	d.Log.Infof("Uploading checksums of %d assets", len(infos))
+	return d.uploadChecksums(ctx, uploader, infos, dir)
+}
+
+// hashRemoteAsset downloads asset from rel and
+// describes it, computing its size and checksum.
+func (d *Deployer) hashRemoteAsset(ctx context.Context, rel *Release, asset Asset) (AssetInfo, error) {
+	info := AssetInfo{
+		Name: asset.Name,
+		URL:  d.Provider.DownloadURL(rel, asset.Name),
+	}
+	rc, err := d.Provider.DownloadAsset(ctx, rel, asset)
+	if err != nil {
+		return info, err
+	}
+	defer rc.Close()
+	h := sha256.New()
+	info.Size, err = io.Copy(h, rc)
+	if err != nil {
+		return info, err
+	}
+	info.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return info, nil
+}
+
+// publishedAssets returns the assets listed in the checksums
+// file of the published release for tag, with their URLs.
+func (d *Deployer) publishedAssets(ctx context.Context, tag string) ([]AssetInfo, error) {
+	release, err := d.findRelease(ctx, tag)
+	if err != nil {
+		return nil, fmt.Errorf("getting release: %w", err)
+	}
+	if release == nil {
+		return nil, fmt.Errorf("no published release for %s on %s", tag, d.Provider.Name())
+	}
+	assets, err := d.Provider.ListAssets(ctx, release)
+	if err != nil {
+		return nil, fmt.Errorf("listing release assets: %w", err)
+	}
+	for _, asset := range assets {
+		if asset.Name != checksumsFilename {
+			continue
+		}
+		rc, err := d.Provider.DownloadAsset(ctx, release, asset)
+		if err != nil {
+			return nil, fmt.Errorf("downloading %s: %w", checksumsFilename, err)
+		}
+		defer rc.Close()
+		checksums, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return nil, fmt.Errorf("downloading %s: %w", checksumsFilename, err)
+		}
+
+		var infos []AssetInfo
+		for _, line := range strings.Split(strings.TrimSpace(string(checksums)), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				continue
+			}
+			infos = append(infos, AssetInfo{
+				Name:   fields[1],
+				SHA256: fields[0],
+				URL:    d.Provider.DownloadURL(release, fields[1]),
+			})
+		}
+		return infos, nil
+	}
+	return nil, fmt.Errorf("release has no %s", checksumsFilename)
+}
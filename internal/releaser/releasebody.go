@@ -0,0 +1,117 @@
+package releaser
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// defaultReleaseBody is the template of the release notes
+// used if no other template is configured: the notes the
+// release was made with, followed by a table of downloads.
+const defaultReleaseBody = `{{.Notes}}
+## Downloads
+
+| Platform | Asset | Size |
+|----------|-------|------|
+{{- range .Assets}}
+| {{.Platform}} | [{{.Name}}]({{.URL}}) | {{size .Size}} |
+{{- end}}
+
+The SHA-256 checksum of each asset is in [{{.ChecksumsName}}]({{.ChecksumsURL}}).
+`
+
+// ReleaseBodyData is the data given to the release body
+// template once all the assets have been uploaded.
+type ReleaseBodyData struct {
+	Tag     string // the release tag, e.g. "v0.10.12"
+	Version string // the tag without the "v", e.g. "0.10.12"
+	Commit  string // the full hash of the released commit
+
+	// Notes are the release notes the release was made
+	// with, as Markdown.
+	Notes string
+
+	// Assets are the uploaded assets, sorted by platform.
+	Assets []AssetInfo
+
+	// ChecksumsName and ChecksumsURL are the name and
+	// download URL of the checksums file.
+	ChecksumsName, ChecksumsURL string
+}
+
+// releaseBodyFuncs are the functions that release body
+// templates can use besides the built-in ones.
+var releaseBodyFuncs = template.FuncMap{
+	// size formats a number of bytes, such as "10.4 MiB"
+	"size": func(n int64) string {
+		if n < 1<<20 {
+			return fmt.Sprintf("%.0f KiB", float64(n)/(1<<10))
+		}
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	},
+}
+
+// ParseReleaseBodyTemplate parses the release body template
+// in the file at path, or the default one if path is empty,
+// and makes sure it can be executed.
+func ParseReleaseBodyTemplate(path string) (*template.Template, error) {
+	text := defaultReleaseBody
+	if path != "" {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading release body template: %w", err)
+		}
+		text = string(contents)
+	}
+	tmpl, err := template.New("release body").Option("missingkey=error").Funcs(releaseBodyFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing release body template: %w", err)
+	}
+	_, err = executeReleaseBodyTemplate(tmpl, ReleaseBodyData{
+		Tag:           "v0.0.0",
+		Version:       "0.0.0",
+		Commit:        strings.Repeat("0", 40),
+		Assets:        []AssetInfo{{Name: "caddy_v0.0.0_linux_amd64.tar.gz", Platform: "linux/amd64"}},
+		ChecksumsName: checksumsFilename,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// executeReleaseBodyTemplate returns the release body
+// given by tmpl for data.
+func executeReleaseBodyTemplate(tmpl *template.Template, data ReleaseBodyData) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("executing release body template: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// updateReleaseBody replaces the notes of rel with those
+// rendered from d.ReleaseBody for the assets in result.
+func (d *Deployer) updateReleaseBody(ctx context.Context, rel *Release, result *Result) error {
+	assets := make([]AssetInfo, len(result.Assets))
+	copy(assets, result.Assets)
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Platform < assets[j].Platform })
+
+	body, err := executeReleaseBodyTemplate(d.ReleaseBody, ReleaseBodyData{
+		Tag:           result.Tag,
+		Version:       TagVersion(result.Tag, d.Config.TagPrefix),
+		Commit:        result.Commit,
+		Notes:         d.releaseNotes(result),
+		Assets:        assets,
+		ChecksumsName: checksumsFilename,
+		ChecksumsURL:  d.Provider.DownloadURL(rel, checksumsFilename),
+	})
+	if err != nil {
+		return err
+	}
+	return d.Provider.EditReleaseNotes(ctx, rel, body)
+}
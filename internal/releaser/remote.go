@@ -0,0 +1,51 @@
+package releaser
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CheckRemote asserts that the Caddy repo at repoDir has
+// a git remote named remote, which releases are pushed to.
+func CheckRemote(repoDir, remote string) error {
+	cmd := Command("git", "remote", "get-url", remote)
+	cmd.Dir = repoDir
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("the Caddy repo has no git remote named %q (see git_remote or -git-remote)", remote)
+	}
+	return nil
+}
+
+// PushCommand returns the command that runs git push in
+// the Caddy repo at repoDir with args, which should begin
+// with the remote. The configured SSH key and credential
+// helper, if any, are used instead of any that git is
+// configured with, so the push identity can differ from
+// the operator's.
+func (cfg Config) PushCommand(repoDir string, args ...string) *exec.Cmd {
+	var gitArgs []string
+	if cfg.GitCredentialHelper != "" {
+		// the empty value clears the helpers configured
+		// so far, so only this one is asked
+		gitArgs = append(gitArgs, "-c", "credential.helper=", "-c", "credential.helper="+cfg.GitCredentialHelper)
+	}
+	gitArgs = append(gitArgs, "push")
+	cmd := Command("git", append(gitArgs, args...)...)
+	cmd.Dir = repoDir
+	if cfg.GitSSHKey != "" {
+		cmd.Env = append(os.Environ(), "GIT_SSH_COMMAND=ssh -i "+shellQuote(cfg.GitSSHKey)+" -o IdentitiesOnly=yes")
+	}
+	return cmd
+}
+
+// push runs git push to the configured remote with args.
+func (d *Deployer) push(args ...string) error {
+	return RunRedacted(d.Config.PushCommand(d.RepoDir, append([]string{d.Config.GitRemote}, args...)...))
+}
+
+// shellQuote quotes s for sh, which runs GIT_SSH_COMMAND.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,127 @@
+package releaser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Result describes the outcome of a deploy, as far as
+// the deploy got. It is also the release summary that
+// can be written to a file as JSON.
+type Result struct {
+	Tag        string `json:"tag"`
+	Prerelease bool   `json:"prerelease"`
+	ReleaseID  int64  `json:"release_id,omitempty"`
+	ReleaseURL string `json:"release_url,omitempty"`
+	TagPushed  bool   `json:"tag_pushed"`
+
+	// Commit and ShortCommit are the full and short SHA
+	// of the commit that was tagged and released.
+	Commit      string `json:"commit,omitempty"`
+	ShortCommit string `json:"short_commit,omitempty"`
+
+	// GoVersion is the version of Go the release was
+	// built with, such as "go1.10.3".
+	GoVersion string `json:"go_version,omitempty"`
+
+	// Plugins are the plugins built into the release,
+	// each as "package@version".
+	Plugins []string `json:"plugins,omitempty"`
+
+	// Assets are the assets that were uploaded successfully.
+	Assets []AssetInfo `json:"assets"`
+
+	// Platforms are the platforms that were built and
+	// uploaded successfully, including "source" for the
+	// source archive.
+	Platforms []string `json:"platforms"`
+
+	// FailedPlatforms are the platforms that could not
+	// be built or uploaded.
+	FailedPlatforms []string `json:"failed_platforms,omitempty"`
+
+	// UnreachableAssets are the assets that could not be
+	// downloaded after the release was published, if that
+	// was checked.
+	UnreachableAssets []string `json:"unreachable_assets,omitempty"`
+
+	// BuildDurations is how long each platform took to
+	// build, in seconds, keyed by platform.
+	BuildDurations map[string]float64 `json:"build_seconds"`
+
+	// UploadDurations is how long each platform's asset
+	// took to upload, in seconds, including any retries.
+	UploadDurations map[string]float64 `json:"upload_seconds"`
+
+	// UploadedBytes is the total size of the assets that
+	// were uploaded successfully, not counting signatures
+	// and checksums.
+	UploadedBytes int64 `json:"uploaded_bytes"`
+
+	BuildServerDeployed bool   `json:"build_server_deployed"`
+	StableTagMoved      bool   `json:"stable_tag_moved"`
+	MilestoneClosed     bool   `json:"milestone_closed"`
+	HomebrewUpdated     bool   `json:"homebrew_updated"`
+	DockerPushed        bool   `json:"docker_pushed"`
+	Error               string `json:"error,omitempty"`
+}
+
+// clone returns a copy of r that shares nothing with it.
+func (r *Result) clone() *Result {
+	c := *r
+	c.Assets = append([]AssetInfo(nil), r.Assets...)
+	c.Plugins = append([]string(nil), r.Plugins...)
+	c.Platforms = append([]string(nil), r.Platforms...)
+	c.FailedPlatforms = append([]string(nil), r.FailedPlatforms...)
+	c.UnreachableAssets = append([]string(nil), r.UnreachableAssets...)
+	c.BuildDurations = make(map[string]float64, len(r.BuildDurations))
+	for k, v := range r.BuildDurations {
+		c.BuildDurations[k] = v
+	}
+	c.UploadDurations = make(map[string]float64, len(r.UploadDurations))
+	for k, v := range r.UploadDurations {
+		c.UploadDurations[k] = v
+	}
+	return &c
+}
+
+// AssetInfo describes a release asset.
+type AssetInfo struct {
+	Name     string `json:"name"`
+	Platform string `json:"platform"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	URL      string `json:"url,omitempty"` // where the published asset can be downloaded
+
+	// MirrorURL is the URL of the asset's copy in
+	// the S3 mirror, if it was mirrored.
+	MirrorURL string `json:"mirror_url,omitempty"`
+}
+
+// describeAsset returns information about file, which is
+// the asset for platform. It reads file to compute its
+// checksum, then seeks back to the beginning of it.
+func describeAsset(file *os.File, platform string) (AssetInfo, error) {
+	info := AssetInfo{
+		Name:     filepath.Base(file.Name()),
+		Platform: platform,
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return info, fmt.Errorf("hashing %s: %w", info.Name, err)
+	}
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		return info, fmt.Errorf("seeking to beginning of %s: %w", info.Name, err)
+	}
+
+	info.Size = size
+	info.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return info, nil
+}
@@ -0,0 +1,124 @@
+package releaser
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Mirror uploads release assets to a bucket in Amazon S3
+// or a service compatible with it, such as MinIO or a CDN's
+// object storage. Requests are signed with AWS Signature
+// Version 4 and addressed path-style, which all S3-compatible
+// services support.
+type S3Mirror struct {
+	Endpoint  string // e.g. "https://s3.us-east-1.amazonaws.com"
+	Region    string // e.g. "us-east-1"
+	Bucket    string
+	Prefix    string // prepended to the name of each object, e.g. "caddy/v0.10.12/"
+	AccessKey string
+	SecretKey string
+
+	// Client makes the requests; if nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Upload puts the size bytes of body in the bucket, named
+// name under the prefix. S3 checks the content against its
+// SHA-256, which is part of the signature, so a corrupted
+// upload is rejected.
+func (m *S3Mirror) Upload(ctx context.Context, name string, body io.ReadSeeker, size int64) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return fmt.Errorf("hashing %s: %w", name, err)
+	}
+	if _, err := body.Seek(0, 0); err != nil {
+		return err
+	}
+	payloadHash := hex.EncodeToString(h.Sum(nil))
+
+	req, err := http.NewRequest("PUT", m.URL(name), ioutil.NopCloser(body))
+	if err != nil {
+		return fmt.Errorf("preparing request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = size
+	m.sign(req, payloadHash, time.Now())
+
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("network error: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("S3: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// URL returns the URL of the object for the asset
+// with the given name.
+func (m *S3Mirror) URL(name string) string {
+	key := m.Prefix + name
+	var segments []string
+	for _, s := range strings.Split(key, "/") {
+		segments = append(segments, url.PathEscape(s))
+	}
+	return strings.TrimSuffix(m.Endpoint, "/") + "/" + url.PathEscape(m.Bucket) + "/" + strings.Join(segments, "/")
+}
+
+// sign adds an AWS Signature Version 4 authorization to req,
+// whose body has the SHA-256 payloadHash, as made at t.
+func (m *S3Mirror) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + m.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+m.SecretKey), date)
+	key = hmacSHA256(key, m.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		m.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
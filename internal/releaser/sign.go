@@ -0,0 +1,138 @@
+package releaser
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// gpgPromptArgs returns the gpg arguments that decide how a
+// passphrase is got: from the configured passphrase file,
+// through loopback pinentry; not at all, so that gpg fails
+// rather than prompting, if d.NoSigningPrompt is set; or
+// otherwise however gpg-agent usually gets it.
+func (d *Deployer) gpgPromptArgs() []string {
+	if d.Config.GPGPassphraseFile != "" {
+		return []string{"--batch", "--pinentry-mode", "loopback", "--passphrase-file", d.Config.GPGPassphraseFile}
+	}
+	if d.NoSigningPrompt {
+		return []string{"--batch", "--pinentry-mode", "error"}
+	}
+	return nil
+}
+
+// CheckSigning makes sure that the signing key can sign now,
+// without waiting on a passphrase that can't be given, by
+// signing a few bytes with it. The passphrase, if one is
+// asked for or read from the passphrase file, is then cached
+// by gpg-agent, so signatures made soon after, including the
+// tag's, which git makes, don't ask for it again.
+func (d *Deployer) CheckSigning() error {
+	args := append(d.gpgPromptArgs(), "--detach-sign", "--armor", "--output", os.DevNull)
+	if d.Config.SigningKey != "" {
+		args = append(args, "--local-user", d.Config.SigningKey)
+	}
+	cmd := Command("gpg", args...)
+	cmd.Stdin = strings.NewReader("release-caddy signing check\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if d.NoSigningPrompt && d.Config.GPGPassphraseFile == "" {
+			return fmt.Errorf("gpg can't sign without a passphrase, which can't be asked for without a terminal; "+
+				"preload it into gpg-agent (such as with gpg-preset-passphrase) or set gpg_passphrase_file: %v: %s", err, msg)
+		}
+		return fmt.Errorf("gpg can't sign: %v: %s", err, msg)
+	}
+	return nil
+}
+
+// signFile makes a detached, ASCII-armored GPG signature of
+// the file at path, using the configured key, or gpg's default
+// key if none is. The signature is written next to the file
+// with a .asc suffix and returned opened for reading.
+func (d *Deployer) signFile(path string) (*os.File, error) {
+	sigPath := path + ".asc"
+	args := append(d.gpgPromptArgs(), "--detach-sign", "--armor", "--yes", "--output", sigPath)
+	if d.Config.SigningKey != "" {
+		args = append(args, "--local-user", d.Config.SigningKey)
+	}
+	args = append(args, path)
+
+	cmd := Command("gpg", args...)
+	cmd.Stdout = ioutil.Discard
+	if err := RunRedacted(cmd); err != nil {
+		return nil, fmt.Errorf("gpg: %w", err)
+	}
+	return os.Open(sigPath)
+}
+
+// fingerprintRe matches a full fingerprint of an OpenPGP
+// key, as normalized by normalizeFingerprint.
+var fingerprintRe = regexp.MustCompile(`^(?:[0-9A-F]{40}|[0-9A-F]{64})$`)
+
+// normalizeFingerprint returns fpr in upper case without
+// spaces, as gpg reports fingerprints in its status lines.
+func normalizeFingerprint(fpr string) string {
+	return strings.ToUpper(strings.Replace(fpr, " ", "", -1))
+}
+
+// tagSigners returns the fingerprints of the key that made
+// the valid signature of tag in the Caddy repo: that of the
+// signing key and, if that is a subkey, of its primary key.
+func (d *Deployer) tagSigners(tag string) ([]string, error) {
+	cmd := Command("git", "verify-tag", "--raw", tag)
+	cmd.Dir = d.RepoDir
+	var status bytes.Buffer
+	cmd.Stderr = &status
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("signature of %s is not valid: %v: %s", tag, err, strings.TrimSpace(status.String()))
+	}
+
+	// the line is "[GNUPG:] VALIDSIG <fpr> <date> ... <primary fpr>"
+	for _, line := range strings.Split(status.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "[GNUPG:]" || fields[1] != "VALIDSIG" {
+			continue
+		}
+		signers := []string{fields[2]}
+		if len(fields) >= 12 && fields[11] != fields[2] {
+			signers = append(signers, fields[11])
+		}
+		return signers, nil
+	}
+	return nil, fmt.Errorf("gpg did not report who signed %s", tag)
+}
+
+// verifyTagSigner makes sure that tag, which has not been
+// pushed, was signed by one of the allowed signing keys, if
+// any are configured. If it wasn't, and d.DeleteUnverifiedTag
+// is set, the tag is deleted so it can be made again.
+func (d *Deployer) verifyTagSigner(tag string) error {
+	if len(d.Config.AllowedSigningKeys) == 0 {
+		return nil
+	}
+	d.Log.Infof("Verifying the signer of %s", tag)
+	signers, err := d.tagSigners(tag)
+	if err == nil {
+		for _, signer := range signers {
+			for _, allowed := range d.Config.AllowedSigningKeys {
+				if normalizeFingerprint(allowed) == signer {
+					d.Log.Infof("%s is signed by allowed key %s", tag, signer)
+					return nil
+				}
+			}
+		}
+		err = fmt.Errorf("%s is signed by %s, which is not in allowed_signing_keys (check signing_key)", tag, signers[0])
+	}
+	if d.DeleteUnverifiedTag {
+		d.Log.Warnf("Deleting tag %s, which was not pushed", tag)
+		if delErr := d.run("git", "tag", "--delete", tag); delErr != nil {
+			d.Log.Errorf("Deleting tag %s: %v", tag, delErr)
+		}
+	}
+	return err
+}
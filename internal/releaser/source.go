@@ -0,0 +1,78 @@
+package releaser
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sourcePlatform is the platform of the source
+// archive in the results of a deploy.
+const sourcePlatform = "source"
+
+// sourceArchiveName returns the name of the source
+// archive asset of the release of the given version,
+// e.g. "caddy-0.10.12-src.tar.gz".
+func sourceArchiveName(version string) string {
+	return "caddy-" + version + "-src.tar.gz"
+}
+
+// uploadSource makes an archive of the source of the Caddy
+// repo at tag with git archive, in dir, and uploads it to
+// the release (with its signature, if signing is enabled).
+// If the release already has the archive and it is kept,
+// that one is described instead.
+func (d *Deployer) uploadSource(ctx context.Context, uploader *releaseUploader, tag, dir string) (AssetInfo, error) {
+	name := sourceArchiveName(TagVersion(tag, d.Config.TagPrefix))
+	path := filepath.Join(dir, name)
+	prefix := strings.TrimSuffix(name, "-src.tar.gz") + "/"
+	err := d.run("git", "archive", "--format=tar.gz", "--prefix="+prefix, "--output="+path, tag)
+	if err != nil {
+		return AssetInfo{}, fmt.Errorf("git archive: %w", err)
+	}
+	defer os.Remove(path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return AssetInfo{}, err
+	}
+	defer file.Close()
+	info, err := describeAsset(file, sourcePlatform)
+	if err != nil {
+		return info, err
+	}
+
+	var sigFile *os.File
+	if d.SignAssets {
+		sigFile, err = d.signFile(path)
+		if err != nil {
+			return info, fmt.Errorf("signing: %w", err)
+		}
+		defer func() {
+			sigFile.Close()
+			os.Remove(sigFile.Name())
+		}()
+	}
+
+	err = uploader.upload(ctx, name, file)
+	if err != nil {
+		return info, err
+	}
+	if kept, keptPath, ok := uploader.keptAsset(name); ok {
+		kept.Platform = sourcePlatform
+		defer os.Remove(keptPath)
+		d.keepFile(keptPath, name)
+		return kept, nil
+	}
+	if sigFile != nil {
+		err = uploader.upload(ctx, filepath.Base(sigFile.Name()), sigFile)
+		if err != nil {
+			return info, err
+		}
+		d.keepFile(sigFile.Name(), filepath.Base(sigFile.Name()))
+	}
+	d.keepFile(path, name)
+	return info, nil
+}
@@ -0,0 +1,43 @@
+package releaser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validStableTag returns an error if name can't be used
+// as the stable tag, such as if it looks like a release
+// tag, which GetCurrentTag would mistake it for.
+func validStableTag(name, prefix string) error {
+	if strings.ContainsAny(name, " ~^:?*[\\") || strings.HasPrefix(name, "-") {
+		return fmt.Errorf("%q is not a valid tag name", name)
+	}
+	if _, err := parseVersion(strings.TrimPrefix(name, prefix)); err == nil {
+		return fmt.Errorf("%q looks like a release tag", name)
+	}
+	return nil
+}
+
+// moveStableTag moves the configured stable tag to the
+// commit of tag, making it again if need be, and force-
+// pushes it. Pre-releases never move the stable tag.
+func (d *Deployer) moveStableTag(tag string) error {
+	if IsPrerelease(tag) {
+		return fmt.Errorf("%s is a pre-release", tag)
+	}
+	name := d.Config.StableTag
+	message := fmt.Sprintf("Latest stable release: %s", tag)
+	args := []string{"tag", "--force", "-s", name, "-m", message}
+	if d.Config.SigningKey != "" {
+		args = []string{"tag", "--force", "-u", d.Config.SigningKey, name, "-m", message}
+	}
+	// the tag of the release would be tagged, not its commit
+	args = append(args, tag+"^{commit}")
+	if err := d.run("git", args...); err != nil {
+		return fmt.Errorf("creating signed tag: %w", err)
+	}
+	if err := d.push("--force", "refs/tags/"+name); err != nil {
+		return fmt.Errorf("pushing tag: %w", err)
+	}
+	return nil
+}
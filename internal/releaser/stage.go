@@ -0,0 +1,70 @@
+package releaser
+
+import "fmt"
+
+// Stage is the step at which a deploy starts. A deploy
+// that failed after its tag was pushed can be resumed
+// at a later stage, skipping the steps already done.
+type Stage int
+
+// The stages of a deploy, in order.
+const (
+	// StageNew runs the checks and tags and pushes
+	// the commit, then does everything else.
+	StageNew Stage = iota
+
+	// StagePush pushes a tag that was already made
+	// locally, such as by a deploy with NoPush, then
+	// does everything else.
+	StagePush
+
+	// StageRelease starts at creating the release,
+	// for a tag that is already pushed.
+	StageRelease
+
+	// StageUpload builds and uploads the assets to the
+	// release that was already created for the tag, such
+	// as a draft left by a deploy in which some uploads
+	// failed. Assets already uploaded are skipped, unless
+	// they are to be replaced.
+	StageUpload
+
+	// StageBuildServer only deploys the published
+	// release to the build server.
+	StageBuildServer
+)
+
+// stageNames are the names of the stages,
+// as given to ParseStage.
+var stageNames = map[Stage]string{
+	StageNew:         "",
+	StagePush:        "push",
+	StageRelease:     "release",
+	StageUpload:      "upload",
+	StageBuildServer: "buildserver",
+}
+
+// ParseStage returns the stage named s: "" for a new
+// deploy, "push", "release", "upload", or "buildserver". For
+// compatibility, "github" is the same as "release".
+func ParseStage(s string) (Stage, error) {
+	if s == "github" {
+		return StageRelease, nil
+	}
+	for stage, name := range stageNames {
+		if s == name {
+			return stage, nil
+		}
+	}
+	return StageNew, fmt.Errorf("unknown resume stage %q (must be push, release, upload, or buildserver)", s)
+}
+
+func (s Stage) String() string {
+	if name, ok := stageNames[s]; ok {
+		if name == "" {
+			return "new"
+		}
+		return name
+	}
+	return fmt.Sprintf("Stage(%d)", int(s))
+}
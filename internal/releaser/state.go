@@ -0,0 +1,98 @@
+package releaser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// deployState is what the state file holds: the release
+// made for the tag of the last deploy, so a resumed deploy
+// uses that release instead of making another.
+type deployState struct {
+	Provider  string `json:"provider"`
+	Tag       string `json:"tag"`
+	ReleaseID int64  `json:"release_id"`
+}
+
+// releaseID returns the ID of the release for tag that
+// d.StateFile records, or 0 if it records none.
+func (d *Deployer) releaseID(tag string) int64 {
+	if d.StateFile == "" {
+		return 0
+	}
+	data, err := ioutil.ReadFile(d.StateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			d.Log.Warnf("Reading state file: %v", err)
+		}
+		return 0
+	}
+	var state deployState
+	if err := json.Unmarshal(data, &state); err != nil {
+		d.Log.Warnf("Reading state file %s: %v", d.StateFile, err)
+		return 0
+	}
+	if state.Provider != d.Provider.Name() || state.Tag != tag {
+		return 0
+	}
+	return state.ReleaseID
+}
+
+// recordRelease records in d.StateFile that release was
+// made for its tag, replacing any earlier record. If it
+// can't, a resumed deploy still finds the release by tag.
+func (d *Deployer) recordRelease(release *Release) {
+	if d.StateFile == "" || release.ID == 0 {
+		return
+	}
+	data, err := json.Marshal(deployState{
+		Provider:  d.Provider.Name(),
+		Tag:       release.Tag,
+		ReleaseID: release.ID,
+	})
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(d.StateFile), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(d.StateFile, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		d.Log.Warnf("Writing state file: %v", err)
+	}
+}
+
+// findRelease returns the release already made for tag, or
+// nil if there is none: the one with d.ReleaseID, if set;
+// the one whose ID the state file records, if it still
+// exists; or else the one the provider finds by tag.
+func (d *Deployer) findRelease(ctx context.Context, tag string) (*Release, error) {
+	if d.ReleaseID != 0 {
+		release, err := d.Provider.GetRelease(ctx, d.ReleaseID)
+		if err != nil {
+			return nil, err
+		}
+		if release == nil {
+			return nil, fmt.Errorf("release %d does not exist on %s", d.ReleaseID, d.Provider.Name())
+		}
+		if release.Tag != tag {
+			return nil, fmt.Errorf("release %d is for %s, not %s", d.ReleaseID, release.Tag, tag)
+		}
+		return release, nil
+	}
+	if id := d.releaseID(tag); id != 0 {
+		release, err := d.Provider.GetRelease(ctx, id)
+		if err != nil && !errors.Is(err, ErrNotSupported) {
+			return nil, err
+		}
+		if release != nil {
+			return release, nil
+		}
+		d.Log.Warnf("Release %d, recorded for %s, no longer exists; looking for it by tag", id, tag)
+	}
+	return d.Provider.GetReleaseByTag(ctx, tag)
+}
@@ -0,0 +1,419 @@
+package releaser
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GetCurrentTag returns the current tag of the Caddy repo
+// at repoDir, which is the one with the highest version
+// among the tags that begin with prefix, such as "caddy/"
+// in a monorepo; the prefix may be empty. Tags that are not
+// versions are ignored, and so are pre-releases, such as
+// "v1.2.0-rc.1", unless includePrereleases is true or there
+// are only pre-releases. If there is no current tag, a
+// "dummy" tag of prefix+"v0.0.0" will be returned for
+// consistency with semantic versioning.
+func GetCurrentTag(repoDir, prefix string, includePrereleases bool) (string, error) {
+	tags, err := ListTags(repoDir, prefix)
+	if err != nil {
+		return "", err
+	}
+	if len(tags) == 0 {
+		return prefix + "v0.0.0", nil // alright--starting from nothing, are we?
+	}
+	if !includePrereleases {
+		for i := len(tags) - 1; i >= 0; i-- {
+			if !tags[i].Prerelease {
+				return tags[i].Name, nil
+			}
+		}
+	}
+	return tags[len(tags)-1].Name, nil
+}
+
+// Tag is a tag of a version of Caddy.
+type Tag struct {
+	Name       string
+	Prerelease bool // whether the version has a pre-release part, e.g. "-rc.1"
+}
+
+// ListTags returns the tags in the Caddy repo at repoDir that
+// begin with prefix and are versions, from the lowest version
+// to the highest. Tags that are not versions are left out.
+func ListTags(repoDir, prefix string) ([]Tag, error) {
+	cmd := Command("git", "tag", "--list", prefix+"*")
+	cmd.Dir = repoDir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	// compare each version label numerically; string
+	// comparison won't do the trick because 10 < 9 as
+	// strings.
+	var tags []Tag
+	var vers []version
+	for _, name := range strings.Fields(string(out)) {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		ver, err := parseVersion(strings.TrimPrefix(name, prefix))
+		if err != nil {
+			continue
+		}
+		tags = append(tags, Tag{Name: name, Prerelease: ver.prerelease != ""})
+		vers = append(vers, ver)
+	}
+	sort.Stable(tagsByVersion{tags, vers})
+	return tags, nil
+}
+
+// tagsByVersion sorts tags by their versions, vers.
+type tagsByVersion struct {
+	tags []Tag
+	vers []version
+}
+
+func (t tagsByVersion) Len() int           { return len(t.tags) }
+func (t tagsByVersion) Less(i, j int) bool { return t.vers[i].compare(t.vers[j]) < 0 }
+func (t tagsByVersion) Swap(i, j int) {
+	t.tags[i], t.tags[j] = t.tags[j], t.tags[i]
+	t.vers[i], t.vers[j] = t.vers[j], t.vers[i]
+}
+
+// TagExists returns true if tag exists in the
+// Caddy repo at repoDir.
+func TagExists(repoDir, tag string) (bool, error) {
+	cmd := Command("git", "tag", "--list", tag)
+	cmd.Dir = repoDir
+	out, err := cmd.Output()
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(out)) != "", nil
+}
+
+// TagCommit returns the full and short SHA of the commit
+// that tag, or any other revision, points to in the Caddy
+// repo at repoDir.
+func TagCommit(repoDir, tag string) (commit, short string, err error) {
+	cmd := Command("git", "log", "-1", "--format=%H %h", tag+"^{commit}", "--")
+	cmd.Dir = repoDir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("finding commit of %s: %w", tag, err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("finding commit of %s: unexpected output %q", tag, out)
+	}
+	return fields[0], fields[1], nil
+}
+
+// PreviousTag returns the tag of the most recent release
+// of the Caddy repo at repoDir, among the tags that begin
+// with prefix, or "" if there hasn't been one; pre-releases
+// are considered as by GetCurrentTag. Unlike GetCurrentTag,
+// it never returns a dummy tag.
+func PreviousTag(repoDir, prefix string, includePrereleases bool) (string, error) {
+	current, err := GetCurrentTag(repoDir, prefix, includePrereleases)
+	if err != nil {
+		return "", err
+	}
+	exists, err := TagExists(repoDir, current)
+	if err != nil || !exists {
+		return "", err
+	}
+	return current, nil
+}
+
+// IsFirstRelease returns true if, besides tag, there are
+// no tags of versions that begin with prefix in the Caddy
+// repo at repoDir, so the release of tag is the first one.
+// The tag itself need not exist yet.
+func IsFirstRelease(repoDir, prefix, tag string) (bool, error) {
+	cmd := Command("git", "tag", "--list", prefix+"*")
+	cmd.Dir = repoDir
+	out, err := cmd.Output()
+	if err != nil {
+		return false, err
+	}
+	for _, t := range strings.Fields(string(out)) {
+		if t == tag || !strings.HasPrefix(t, prefix) {
+			continue
+		}
+		if _, err := parseVersion(strings.TrimPrefix(t, prefix)); err == nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// TagVersion returns the version of tag, which begins with
+// prefix: the rest of the tag without any "v", e.g. "1.2.3"
+// for "caddy/v1.2.3" with the prefix "caddy/".
+func TagVersion(tag, prefix string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(tag, prefix), "v")
+}
+
+// IsPrerelease returns true if tag looks like a pre-release version.
+func IsPrerelease(tag string) bool {
+	return strings.Contains(tag, "-alpha") ||
+		strings.Contains(tag, "-beta") ||
+		strings.Contains(tag, "-pre") ||
+		strings.Contains(tag, "-rc")
+}
+
+// version is a parsed semantic version number.
+type version struct {
+	parts      [3]int // major, minor, patch
+	prerelease string // anything after a "-", e.g. "beta1"
+}
+
+// parseVersion parses a tag such as "v0.10.12" or
+// "0.11-beta1". Missing minor or patch numbers are 0.
+func parseVersion(tag string) (version, error) {
+	var ver version
+	core := strings.TrimPrefix(tag, "v")
+	if i := strings.Index(core, "-"); i >= 0 {
+		core, ver.prerelease = core[:i], core[i+1:]
+	}
+	nums := strings.Split(core, ".")
+	if len(nums) > 3 {
+		return ver, fmt.Errorf("tag %q is not a version: too many parts", tag)
+	}
+	for i, s := range nums {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return ver, fmt.Errorf("tag %q is not a version: %q is not a number", tag, s)
+		}
+		ver.parts[i] = n
+	}
+	return ver, nil
+}
+
+// compare returns -1, 0, or 1 if v is lower than, equal
+// to, or higher than other. A pre-release is lower than
+// the release of the same number.
+func (v version) compare(other version) int {
+	for i := range v.parts {
+		if v.parts[i] < other.parts[i] {
+			return -1
+		}
+		if v.parts[i] > other.parts[i] {
+			return 1
+		}
+	}
+	switch {
+	case v.prerelease == other.prerelease:
+		return 0
+	case v.prerelease == "":
+		return 1
+	case other.prerelease == "":
+		return -1
+	}
+	return comparePrerelease(v.prerelease, other.prerelease)
+}
+
+// comparePrerelease compares the pre-release parts of two
+// versions as semantic versioning does: by each of their
+// dot-separated identifiers in turn, where numeric ones
+// compare as numbers and are lower than alphanumeric ones,
+// which compare as strings. If all the identifiers of one
+// begin the other, the one with fewer is lower. So "rc.9"
+// is lower than "rc.10", which is lower than "rc.10.1".
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := compareIdentifier(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifier compares a and b, identifiers of the
+// pre-release parts of versions; see comparePrerelease.
+func compareIdentifier(a, b string) int {
+	an, aErr := strconv.ParseUint(a, 10, 64)
+	bn, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		if an < bn {
+			return -1
+		}
+		if an > bn {
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// NextTagSuggestions returns a list of suggested tags based on the
+// most recent tag, which must be passed in as currentTagRaw, along
+// with the prefix that it and the suggestions begin with. There
+// is one suggestion for incrementing each of the patch, minor, and
+// major numbers, in that order. If the most recent tag is a
+// pre-release, its release ("v1.2.0" for "v1.2.0-rc.1") is
+// suggested first. If dropZeroPatch is true, a patch number
+// of 0 is left off ("v0.10" instead of "v0.10.0").
+func NextTagSuggestions(currentTagRaw, prefix string, dropZeroPatch bool) ([]string, error) {
+	currentTagRaw = strings.TrimPrefix(currentTagRaw, prefix)
+	current, err := parseVersion(currentTagRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	format := func(next [3]int) string {
+		tag := fmt.Sprintf("%d.%d.%d", next[0], next[1], next[2])
+		if dropZeroPatch && next[2] == 0 {
+			tag = fmt.Sprintf("%d.%d", next[0], next[1])
+		}
+		if strings.HasPrefix(currentTagRaw, "v") {
+			tag = "v" + tag
+		}
+		return prefix + tag
+	}
+
+	// a pre-release is most likely followed by its release
+	var nextVers []string
+	if current.prerelease != "" {
+		nextVers = append(nextVers, format(current.parts))
+	}
+
+	// viable tags come from incrementing each part
+	// of the semantic version number, and setting
+	// subsequent parts to 0.
+	for i := len(current.parts) - 1; i >= 0; i-- {
+		next := current.parts
+		next[i]++
+		for j := i + 1; j < len(next); j++ {
+			next[j] = 0
+		}
+		nextVers = append(nextVers, format(next))
+	}
+
+	return nextVers, nil
+}
+
+// BumpTag returns the tag after currentTagRaw, which begins
+// with prefix, with the part of its version given by bump
+// incremented; it is the matching one of NextTagSuggestions.
+func BumpTag(currentTagRaw, prefix string, bump Bump, dropZeroPatch bool) (string, error) {
+	nextVers, err := NextTagSuggestions(currentTagRaw, prefix, dropZeroPatch)
+	if err != nil {
+		return "", err
+	}
+	// skip the release of a pre-release, if suggested
+	return nextVers[len(nextVers)-3+int(bump)], nil
+}
+
+// FirstTagSuggestions returns the suggested tags for the
+// first release, when there is no tag to increment: v0.1.0
+// and v1.0.0, each beginning with prefix. If dropZeroPatch
+// is true, the patch number is left off, as in
+// NextTagSuggestions.
+func FirstTagSuggestions(prefix string, dropZeroPatch bool) []string {
+	if dropZeroPatch {
+		return []string{prefix + "v0.1", prefix + "v1.0"}
+	}
+	return []string{prefix + "v0.1.0", prefix + "v1.0.0"}
+}
+
+// tagInputRe matches a semantic version as it may be typed
+// for a new tag, with or without a "v", such as "1.2.3" or
+// "v1.2.0-rc.1". The patch number is optional here; whether
+// it may be left off is up to NormalizeTag.
+var tagInputRe = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)(?:\.(0|[1-9]\d*))?(-[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?$`)
+
+// NormalizeTag returns the tag for input, a version typed by
+// the operator, such as "1.2.3" or "caddy/v1.2.3-rc.1", or an
+// error if it is not a semantic version. Like ChangesTag,
+// the tag begins with prefix, whether or not input does,
+// followed by a "v" if currentTagRaw has one. All three
+// numbers are required, so that a typo like "v1.2" isn't
+// mistaken for "v1.2.0", unless dropZeroPatch is true: then,
+// as in NextTagSuggestions, a patch number of 0 is left off,
+// so "v1.2" is kept and "v1.2.0" becomes "v1.2".
+func NormalizeTag(input, currentTagRaw, prefix string, dropZeroPatch bool) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", fmt.Errorf("a tag is required")
+	}
+	m := tagInputRe.FindStringSubmatch(strings.TrimPrefix(input, prefix))
+	if m == nil {
+		return "", fmt.Errorf("%q is not a semantic version, such as v1.2.3 or v1.2.0-rc.1", input)
+	}
+	major, minor, patch, prerelease := m[1], m[2], m[3], m[4]
+	ver := major + "." + minor
+	switch {
+	case dropZeroPatch && (patch == "" || patch == "0"):
+	case patch == "":
+		return "", fmt.Errorf("%q has no patch number, such as the 0 in v1.2.0", input)
+	default:
+		ver += "." + patch
+	}
+	ver += prerelease
+	if strings.HasPrefix(strings.TrimPrefix(currentTagRaw, prefix), "v") {
+		ver = "v" + ver
+	}
+	return prefix + ver, nil
+}
+
+// changesHeadingRe matches a line of CHANGES.txt that begins
+// with a version, optionally as a Markdown heading, such as
+// "## v1.2.3" or "0.10.12 (March 27, 2018)".
+var changesHeadingRe = regexp.MustCompile(`^(?:#+\s*)?(v?\d+\.\d+(?:\.\d+)?(?:-[0-9A-Za-z.]+)?)(?:\s|$)`)
+
+// ChangesTag returns the tag for the version in the top-most
+// version heading of CHANGES.txt in the Caddy repo at repoDir,
+// as of commit, or "" if it has none. If commit is empty, the
+// file is read from the working copy. Like NextTagSuggestions,
+// the tag begins with prefix, followed by a "v" if
+// currentTagRaw has one.
+func ChangesTag(repoDir, commit, currentTagRaw, prefix string) (string, error) {
+	var contents []byte
+	var err error
+	if commit == "" {
+		contents, err = ioutil.ReadFile(filepath.Join(repoDir, "CHANGES.txt"))
+	} else {
+		cmd := Command("git", "show", commit+":CHANGES.txt")
+		cmd.Dir = repoDir
+		contents, err = cmd.Output()
+		if err != nil {
+			err = fmt.Errorf("reading CHANGES.txt at %s: %w", commit, err)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		match := changesHeadingRe.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		tag := strings.TrimPrefix(match[1], "v")
+		if strings.HasPrefix(strings.TrimPrefix(currentTagRaw, prefix), "v") {
+			tag = "v" + tag
+		}
+		return prefix + tag, nil
+	}
+	return "", nil
+}
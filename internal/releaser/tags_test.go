@@ -0,0 +1,349 @@
+package releaser
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestRepo returns the path to a new git repo with one
+// commit, tagged with each of tags. Its committer is
+// testCommitter, whatever git is configured with.
+func newTestRepo(t *testing.T, tags ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--quiet")
+	runGit(t, dir, "config", "user.name", "Test")
+	runGit(t, dir, "config", "user.email", testCommitter)
+	runGit(t, dir, "commit", "--quiet", "--allow-empty", "--no-gpg-sign", "-m", "initial commit")
+	for _, tag := range tags {
+		runGit(t, dir, "tag", tag)
+	}
+	return dir
+}
+
+// testCommitter is the email address of the committer
+// of the repos made by newTestRepo.
+const testCommitter = "test@example.com"
+
+// runGit runs git with args in dir, and returns its output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return string(out)
+}
+
+func TestNextTagSuggestions(t *testing.T) {
+	for _, tc := range []struct {
+		current       string
+		dropZeroPatch bool
+		want          []string
+		wantErr       bool
+	}{
+		{current: "v0.9", want: []string{"v0.9.1", "v0.10.0", "v1.0.0"}},
+		{current: "v0.9", dropZeroPatch: true, want: []string{"v0.9.1", "v0.10", "v1.0"}},
+		{current: "v0.10.0", want: []string{"v0.10.1", "v0.11.0", "v1.0.0"}},
+		{current: "v0.10.0", dropZeroPatch: true, want: []string{"v0.10.1", "v0.11", "v1.0"}},
+		{current: "v1.2.3", want: []string{"v1.2.4", "v1.3.0", "v2.0.0"}},
+		{current: "v1.2.3", dropZeroPatch: true, want: []string{"v1.2.4", "v1.3", "v2.0"}},
+		{current: "0.0.0", want: []string{"0.0.1", "0.1.0", "1.0.0"}},
+		{current: "0.0.0", dropZeroPatch: true, want: []string{"0.0.1", "0.1", "1.0"}},
+		{current: "v1.2.0-rc.1", want: []string{"v1.2.0", "v1.2.1", "v1.3.0", "v2.0.0"}},
+		{current: "garbage", wantErr: true},
+		{current: "v1.x.3", wantErr: true},
+		{current: "v1.2.3.4", wantErr: true},
+	} {
+		got, err := NextTagSuggestions(tc.current, "", tc.dropZeroPatch)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("NextTagSuggestions(%q) = %q, want an error", tc.current, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NextTagSuggestions(%q): %v", tc.current, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("NextTagSuggestions(%q, dropZeroPatch=%t) = %q, want %q", tc.current, tc.dropZeroPatch, got, tc.want)
+		}
+	}
+}
+
+func TestGetCurrentTag(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		tags []string
+		want string
+	}{
+		{"single", []string{"v1.2.3"}, "v1.2.3"},
+		{"numeric order", []string{"v0.9", "v0.10.0"}, "v0.10.0"},
+		{"numeric order reversed", []string{"v0.10.0", "v0.9"}, "v0.10.0"},
+		{"all", []string{"0.0.0", "v0.9", "v0.10.0", "v1.2.3"}, "v1.2.3"},
+		{"garbage ignored", []string{"v0.9", "garbage", "v9.x"}, "v0.9"},
+		{"only garbage", []string{"garbage"}, "v0.0.0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := GetCurrentTag(newTestRepo(t, tc.tags...), "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("GetCurrentTag with %q = %q, want %q", tc.tags, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestListTags(t *testing.T) {
+	repo := newTestRepo(t, "v1.10.0", "v1.2.0-rc.10", "garbage", "v0.10.0", "v1.2.0", "v1.2.0-rc.9", "v0.9", "v1.2.0-beta.2")
+
+	tags, err := ListTags(repo, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Tag{
+		{Name: "v0.9"},
+		{Name: "v0.10.0"},
+		{Name: "v1.2.0-beta.2", Prerelease: true},
+		{Name: "v1.2.0-rc.9", Prerelease: true},
+		{Name: "v1.2.0-rc.10", Prerelease: true},
+		{Name: "v1.2.0"},
+		{Name: "v1.10.0"},
+	}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("ListTags = %v, want %v", tags, want)
+	}
+}
+
+func TestTagPrefix(t *testing.T) {
+	const prefix = "caddy/"
+	repo := newTestRepo(t, "v9.9.9", "caddy/v1.2.2", "caddy/v1.2.3", "caddy/garbage", "other/v5.0.0")
+
+	tags, err := ListTags(repo, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Tag{{Name: "caddy/v1.2.2"}, {Name: "caddy/v1.2.3"}}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("ListTags = %v, want %v", tags, want)
+	}
+
+	current, err := GetCurrentTag(repo, prefix, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != "caddy/v1.2.3" {
+		t.Errorf("GetCurrentTag = %q, want %q", current, "caddy/v1.2.3")
+	}
+
+	got, err := NextTagSuggestions(current, prefix, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"caddy/v1.2.4", "caddy/v1.3.0", "caddy/v2.0.0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NextTagSuggestions(%q) = %q, want %q", current, got, want)
+	}
+	if v := TagVersion(current, prefix); v != "1.2.3" {
+		t.Errorf("TagVersion(%q) = %q, want %q", current, v, "1.2.3")
+	}
+}
+
+func TestTagPrefixNoTags(t *testing.T) {
+	repo := newTestRepo(t, "v1.2.3", "v2.0.0")
+
+	current, err := GetCurrentTag(repo, "caddy/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != "caddy/v0.0.0" {
+		t.Errorf("GetCurrentTag = %q, want %q", current, "caddy/v0.0.0")
+	}
+	previous, err := PreviousTag(repo, "caddy/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous != "" {
+		t.Errorf("PreviousTag = %q, want none", previous)
+	}
+}
+
+func TestFirstRelease(t *testing.T) {
+	repo := newTestRepo(t)
+
+	current, err := GetCurrentTag(repo, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != "v0.0.0" {
+		t.Errorf("GetCurrentTag = %q, want the dummy tag v0.0.0", current)
+	}
+	previous, err := PreviousTag(repo, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous != "" {
+		t.Errorf("PreviousTag = %q, want none", previous)
+	}
+	first, err := IsFirstRelease(repo, "", "v0.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first {
+		t.Error("IsFirstRelease = false, want true")
+	}
+
+	for _, tc := range []struct {
+		prefix        string
+		dropZeroPatch bool
+		want          []string
+	}{
+		{"", false, []string{"v0.1.0", "v1.0.0"}},
+		{"", true, []string{"v0.1", "v1.0"}},
+		{"caddy/", false, []string{"caddy/v0.1.0", "caddy/v1.0.0"}},
+	} {
+		if got := FirstTagSuggestions(tc.prefix, tc.dropZeroPatch); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("FirstTagSuggestions(%q, %t) = %q, want %q", tc.prefix, tc.dropZeroPatch, got, tc.want)
+		}
+	}
+}
+
+func TestGetCurrentTagPrereleases(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		tags               []string
+		includePrereleases bool
+		want               string
+	}{
+		{"stable", []string{"v1.1.0", "v1.2.0-rc.1"}, false, "v1.1.0"},
+		{"prereleases", []string{"v1.1.0", "v1.2.0-rc.1"}, true, "v1.2.0-rc.1"},
+		{"release beats its rc", []string{"v1.2.0-rc.1", "v1.2.0"}, true, "v1.2.0"},
+		{"later rc", []string{"v1.2.0-rc.1", "v1.2.0-rc.2"}, true, "v1.2.0-rc.2"},
+		{"rc.10 after rc.9", []string{"v1.2.0-rc.9", "v1.2.0-rc.10"}, true, "v1.2.0-rc.10"},
+		{"rc.10 after rc.9 reversed", []string{"v1.2.0-rc.10", "v1.2.0-rc.9"}, true, "v1.2.0-rc.10"},
+		{"only prereleases", []string{"v1.2.0-rc.1"}, false, "v1.2.0-rc.1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := GetCurrentTag(newTestRepo(t, tc.tags...), "", tc.includePrereleases)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("GetCurrentTag with %q, includePrereleases=%t = %q, want %q", tc.tags, tc.includePrereleases, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestComparePrerelease(t *testing.T) {
+	// each is lower than the next
+	ordered := []string{"alpha", "alpha.1", "alpha.beta", "beta", "beta.2", "beta.11", "rc.1", "rc.9", "rc.10", "rc.10.1", "rc.a"}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := comparePrerelease(a, b); got != want {
+				t.Errorf("comparePrerelease(%q, %q) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	for _, tc := range []struct {
+		input, current, prefix string
+		dropZeroPatch          bool
+		want                   string // empty if input is rejected
+	}{
+		{input: "1.2.3", current: "v1.2.2", want: "v1.2.3"},
+		{input: "v1.2.3", current: "v1.2.2", want: "v1.2.3"},
+		{input: " v1.2.3\n", current: "v1.2.2", want: "v1.2.3"},
+		{input: "v1.2.3", current: "1.2.2", want: "1.2.3"},
+		{input: "v1.3.0-rc.1", current: "v1.2.2", want: "v1.3.0-rc.1"},
+		{input: "1.3.0-beta", current: "v1.2.2", want: "v1.3.0-beta"},
+		{input: "1.2.3", current: "caddy/v1.2.2", prefix: "caddy/", want: "caddy/v1.2.3"},
+		{input: "caddy/v1.2.3", current: "caddy/v1.2.2", prefix: "caddy/", want: "caddy/v1.2.3"},
+		{input: "v1.2", current: "v1.2.2"},
+		{input: "v1.3-rc.1", current: "v1.2.2"},
+		{input: "v1.2", current: "v1.1.2", dropZeroPatch: true, want: "v1.2"},
+		{input: "1.2.0", current: "v1.1.2", dropZeroPatch: true, want: "v1.2"},
+		{input: "v1.3.0-rc.1", current: "v1.2.2", dropZeroPatch: true, want: "v1.3-rc.1"},
+		{input: "v1.2.3", current: "v1.2.2", dropZeroPatch: true, want: "v1.2.3"},
+		{input: "1.2", current: "caddy/v1.1.2", prefix: "caddy/", dropZeroPatch: true, want: "caddy/v1.2"},
+		{input: "v1", current: "v0.11", dropZeroPatch: true},
+		{input: "v1.2.x", current: "v1.1.2", dropZeroPatch: true},
+		{input: "1.2.3.4", current: "v1.2.2"},
+		{input: "v1.2.x", current: "v1.2.2"},
+		{input: "v01.2.3", current: "v1.2.2"},
+		{input: "v1.2.3-", current: "v1.2.2"},
+		{input: "", current: "v1.2.2"},
+		{input: " \t", current: "v1.2.2"},
+		{input: "other/v1.2.3", current: "caddy/v1.2.2", prefix: "caddy/"},
+	} {
+		got, err := NormalizeTag(tc.input, tc.current, tc.prefix, tc.dropZeroPatch)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("NormalizeTag(%q) = %q, want an error", tc.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NormalizeTag(%q): %v", tc.input, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("NormalizeTag(%q, %q, %q, %t) = %q, want %q", tc.input, tc.current, tc.prefix, tc.dropZeroPatch, got, tc.want)
+		}
+	}
+}
+
+func TestChangesTag(t *testing.T) {
+	dir := newTestRepo(t, "v1.1.0")
+	changes := filepath.Join(dir, "CHANGES.txt")
+	if err := ioutil.WriteFile(changes, []byte("## v1.2.0\n\n- a fix\n\n## v1.1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", "CHANGES.txt")
+	runGit(t, dir, "commit", "--quiet", "--no-gpg-sign", "-m", "changes for 1.2.0")
+	commit := strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD"))
+
+	// the working copy has moved on since the commit
+	if err := ioutil.WriteFile(changes, []byte("1.3.0 (unreleased)\n\n## v1.2.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		commit, current, prefix string
+		want                    string
+	}{
+		{commit: "", current: "v1.1.0", want: "v1.3.0"},
+		{commit: commit, current: "v1.1.0", want: "v1.2.0"},
+		{commit: commit, current: "1.1.0", want: "1.2.0"},
+		{commit: commit, current: "caddy/v1.1.0", prefix: "caddy/", want: "caddy/v1.2.0"},
+	} {
+		got, err := ChangesTag(dir, tc.commit, tc.current, tc.prefix)
+		if err != nil {
+			t.Errorf("ChangesTag(%q): %v", tc.commit, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ChangesTag(%q, %q, %q) = %q, want %q", tc.commit, tc.current, tc.prefix, got, tc.want)
+		}
+	}
+
+	if _, err := ChangesTag(dir, "v1.1.0", "v1.1.0", ""); err == nil {
+		t.Error("ChangesTag at a commit without CHANGES.txt succeeded")
+	}
+}
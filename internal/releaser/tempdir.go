@@ -0,0 +1,86 @@
+package releaser
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tempDirPrefixes are the prefixes of the temporary folders
+// that deploys make, which a deploy that fails or is killed
+// can leave behind.
+var tempDirPrefixes = []string{
+	"caddy_deployment_",
+	"caddy_checks_",
+	"caddy_checksums_",
+	"caddy_homebrew_",
+}
+
+// StaleTempDir is a temporary folder left behind by an
+// earlier deploy.
+type StaleTempDir struct {
+	Path string
+
+	// ModTime is when anything in the folder was last
+	// changed, and Size is the size of all of its files.
+	ModTime time.Time
+	Size    int64
+}
+
+// StaleTempDirs returns the temporary folders made by earlier
+// deploys, in the staging directory and the system's temporary
+// directory, in which nothing has changed for at least maxAge.
+// Only folders named with this program's prefixes are
+// considered; maxAge should be long enough that no deploy
+// still running could own them.
+func (cfg Config) StaleTempDirs(maxAge time.Duration) ([]StaleTempDir, error) {
+	dirs := []string{cfg.StagingDir()}
+	if os.TempDir() != cfg.StagingDir() {
+		dirs = append(dirs, os.TempDir())
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	var stale []StaleTempDir
+	for _, dir := range dirs {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return stale, fmt.Errorf("reading temporary directory: %w", err)
+		}
+		for _, info := range infos {
+			if !info.IsDir() || !hasTempDirPrefix(info.Name()) {
+				continue
+			}
+			found := StaleTempDir{Path: filepath.Join(dir, info.Name())}
+			filepath.Walk(found.Path, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return nil // count what can be read
+				}
+				if info.ModTime().After(found.ModTime) {
+					found.ModTime = info.ModTime()
+				}
+				if !info.IsDir() {
+					found.Size += info.Size()
+				}
+				return nil
+			})
+			if found.ModTime.Before(cutoff) {
+				stale = append(stale, found)
+			}
+		}
+	}
+	return stale, nil
+}
+
+// hasTempDirPrefix returns whether name begins with one
+// of the prefixes of deploys' temporary folders.
+func hasTempDirPrefix(name string) bool {
+	for _, prefix := range tempDirPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,443 @@
+package releaser
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checksumsFilename is the name of the release asset
+// that lists the SHA-256 of every other asset.
+const checksumsFilename = "checksums.txt"
+
+// assetChecksumExt is the extension added to the name of
+// an asset for the file with its own SHA-256, which is
+// uploaded with d.PerAssetChecksums.
+const assetChecksumExt = ".sha256"
+
+// releaseUploader uploads assets to a release, to an S3
+// mirror, or both. If an asset with the same name is already
+// attached to the release, as can happen when a deploy is
+// resumed, it is kept, or replaced if replace is true; see
+// uploadToRelease. Files that describe the build, such as
+// the checksums, are always replaced. It is safe for
+// concurrent use.
+type releaseUploader struct {
+	provider Provider
+	release  *Release // nil if not uploading to a release
+	mirror   *S3Mirror
+	replace  bool
+	verify   bool
+	retries  int           // how many times to try again after an upload fails
+	backoff  time.Duration // how long to wait before the first retry
+	log      Logger
+
+	mu       sync.Mutex
+	existing map[string]Asset        // by name
+	kept     map[string]existingCopy // existing assets kept, by name
+
+	tracker *uploadTracker
+}
+
+// newReleaseUploader returns an uploader for release, after
+// finding which assets the release already has. If release
+// is nil, assets are only uploaded to the S3 mirror, if any,
+// under a folder named for tag.
+func (d *Deployer) newReleaseUploader(ctx context.Context, tag string, release *Release) (*releaseUploader, error) {
+	u := &releaseUploader{
+		provider: d.Provider,
+		release:  release,
+		replace:  d.ReplaceExisting,
+		verify:   d.VerifyUploads,
+		retries:  d.UploadRetries,
+		backoff:  d.RetryBackoff,
+		log:      d.Log,
+		existing: make(map[string]Asset),
+		kept:     make(map[string]existingCopy),
+		tracker:  newUploadTracker(),
+	}
+	if d.S3 != nil {
+		mirror := *d.S3
+		mirror.Prefix += tag + "/"
+		u.mirror = &mirror
+	}
+	if release == nil {
+		return u, nil
+	}
+
+	assets, err := u.provider.ListAssets(ctx, release)
+	if err != nil {
+		return nil, fmt.Errorf("listing existing release assets: %w", err)
+	}
+	for _, asset := range assets {
+		u.existing[asset.Name] = asset
+	}
+
+	return u, nil
+}
+
+// existingCopy is a downloaded copy of an asset that a
+// release already had, which was kept rather than replaced
+// by the one just built.
+type existingCopy struct {
+	info AssetInfo // as the release has it
+	path string    // where it was downloaded to
+}
+
+// describesBuild returns whether the asset with the given
+// name is made from the assets just built, rather than being
+// built itself: the checksums file, the manifest, and the
+// signatures and checksums of assets.
+func describesBuild(name string) bool {
+	return name == checksumsFilename || name == manifestFilename ||
+		strings.HasSuffix(name, ".asc") || strings.HasSuffix(name, assetChecksumExt)
+}
+
+// keptAsset returns the asset with the given name that the
+// release already had, and where it was downloaded to, if
+// it was kept rather than replaced by the one just built.
+func (u *releaseUploader) keptAsset(name string) (AssetInfo, string, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	kept, ok := u.kept[name]
+	return kept.info, kept.path, ok
+}
+
+// upload uploads file with the given name to the release
+// and the mirror, whichever there are. If the release
+// already had the asset and it was kept, the copy of it
+// that was downloaded is mirrored instead of file.
+func (u *releaseUploader) upload(ctx context.Context, name string, file *os.File) error {
+	if u.release != nil {
+		source, err := u.uploadToRelease(ctx, name, file)
+		if err != nil {
+			return err
+		}
+		if source == nil {
+			return nil // not on the release, so not mirrored
+		}
+		if source != file {
+			defer source.Close()
+			file = source
+		}
+	}
+	if u.mirror != nil {
+		_, err := file.Seek(0, 0)
+		if err != nil {
+			return fmt.Errorf("seeking to beginning of file: %w", err)
+		}
+		err = u.uploadToMirror(ctx, name, file)
+		if err != nil {
+			return fmt.Errorf("mirroring to S3: %w", err)
+		}
+	}
+	return nil
+}
+
+// urls returns the URL from which the asset with the given
+// name can be downloaded once the release is published, and
+// the URL of its copy in the mirror, if any. If there is no
+// release, the first URL is also that of the mirror.
+func (u *releaseUploader) urls(name string) (url, mirrorURL string) {
+	if u.mirror != nil {
+		mirrorURL = u.mirror.URL(name)
+	}
+	if u.release == nil {
+		return mirrorURL, mirrorURL
+	}
+	return u.provider.DownloadURL(u.release, name), mirrorURL
+}
+
+// uploadToMirror uploads file to the mirror with the given
+// name, trying up to u.retries more times before giving up.
+func (u *releaseUploader) uploadToMirror(ctx context.Context, name string, file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	body := u.tracker.track(name, file, info.Size())
+	defer u.tracker.untrack(name)
+
+	for i := 0; i <= u.retries; i++ {
+		if i > 0 {
+			if err := waitToRetry(ctx, u.backoff, i); err != nil {
+				return err
+			}
+			u.log.Infof("Trying again to mirror %s", name)
+			_, err = body.Seek(0, 0)
+			if err != nil {
+				return fmt.Errorf("seeking to beginning of file: %w", err)
+			}
+		}
+		u.log.Infof("Mirroring %s to S3... (attempt %d)", name, i+1)
+		err = u.mirror.Upload(ctx, name, body, info.Size())
+		if err == nil {
+			return nil
+		}
+		u.log.Warnf("Error mirroring %s: %v", name, err)
+	}
+	return err
+}
+
+// uploadToRelease uploads file to the release with the given
+// name, trying up to u.retries more times before giving up,
+// waiting longer before each retry. An upload whose
+// size (or, if u.verify, SHA-256) doesn't match file is
+// deleted and tried again, since uploads are occasionally
+// truncated. It returns the file whose contents the release
+// has as the asset, or nil if it has none.
+//
+// If the release already has an asset with the name, it is
+// replaced if u.replace is set or the asset describes the
+// build (see describesBuild); otherwise, it is downloaded and
+// kept, since builds aren't reproducible, and the download is
+// returned. The signature of a kept asset is never replaced,
+// nor uploaded if missing, as it must be of the kept asset;
+// its checksum file is only uploaded if missing.
+func (u *releaseUploader) uploadToRelease(ctx context.Context, name string, file *os.File) (*os.File, error) {
+	base := strings.TrimSuffix(strings.TrimSuffix(name, ".asc"), assetChecksumExt)
+	u.mu.Lock()
+	existing, exists := u.existing[name]
+	_, baseKept := u.kept[base]
+	u.mu.Unlock()
+
+	if base != name && baseKept {
+		if exists {
+			u.log.Infof("Skipping %s: it describes the existing asset %s, which was kept", name, base)
+			return nil, nil
+		}
+		if strings.HasSuffix(name, ".asc") {
+			u.log.Warnf("Not uploading %s: the existing asset %s was kept, and it has no signature; replace it to sign it", name, base)
+			return nil, nil
+		}
+	} else if exists {
+		if !u.replace && !describesBuild(name) {
+			kept, err := u.keepExisting(ctx, existing, file)
+			if err == nil {
+				u.log.Infof("Skipping %s: the release already has an asset with that name", name)
+				return kept, nil
+			}
+			if !errors.Is(err, ErrNotSupported) {
+				return nil, fmt.Errorf("downloading existing asset: %w", err)
+			}
+			u.log.Infof("Replacing existing asset %s: %s can't download it to keep it", name, u.provider.Name())
+		} else {
+			u.log.Infof("Replacing existing asset %s", name)
+		}
+		err := u.provider.DeleteAsset(ctx, u.release, existing)
+		if err != nil {
+			return nil, fmt.Errorf("deleting existing asset: %w", err)
+		}
+		u.mu.Lock()
+		delete(u.existing, name)
+		u.mu.Unlock()
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	body := u.tracker.track(name, file, info.Size())
+	defer u.tracker.untrack(name)
+
+	for i := 0; i <= u.retries; i++ {
+		if i > 0 {
+			if err := waitToRetry(ctx, u.backoff, i); err != nil {
+				return nil, err
+			}
+			u.log.Infof("Trying again to upload %s", name)
+			_, err = body.Seek(0, 0)
+			if err != nil {
+				return nil, fmt.Errorf("seeking to beginning of file: %w", err)
+			}
+		}
+		u.log.Infof("Uploading %s... (attempt %d)", name, i+1)
+		var asset Asset
+		asset, err = u.provider.UploadAsset(ctx, u.release, name, body, info.Size())
+		if err != nil {
+			u.log.Warnf("Error uploading %s: %v", name, err)
+			continue
+		}
+		err = u.verifyUpload(ctx, asset, file)
+		if err == nil {
+			return file, nil
+		}
+		u.log.Warnf("Uploaded %s does not match the local file: %v; deleting it", name, err)
+		if delErr := u.provider.DeleteAsset(ctx, u.release, asset); delErr != nil {
+			return nil, fmt.Errorf("deleting bad upload of %s: %w", name, delErr)
+		}
+	}
+	return nil, err
+}
+
+// keepExisting downloads existing, an asset that the release
+// already has, beside file, which was built to replace it, and
+// records it as kept, described as the release has it. It
+// returns the download, open at its beginning.
+func (u *releaseUploader) keepExisting(ctx context.Context, existing Asset, file *os.File) (*os.File, error) {
+	rc, err := u.provider.DownloadAsset(ctx, u.release, existing)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	path := file.Name() + ".existing"
+	kept, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(kept, h), rc)
+	if err == nil {
+		_, err = kept.Seek(0, 0)
+	}
+	if err != nil {
+		kept.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	u.mu.Lock()
+	u.kept[existing.Name] = existingCopy{
+		info: AssetInfo{
+			Name:   existing.Name,
+			Size:   size,
+			SHA256: hex.EncodeToString(h.Sum(nil)),
+		},
+		path: path,
+	}
+	u.mu.Unlock()
+	return kept, nil
+}
+
+// verifyUpload checks that asset, as the provider stored
+// it, is the same size as file, and if u.verify, that it
+// has the same SHA-256. It leaves file's offset undefined.
+func (u *releaseUploader) verifyUpload(ctx context.Context, asset Asset, file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if asset.Size != 0 && asset.Size != info.Size() {
+		return fmt.Errorf("size is %d bytes, expected %d", asset.Size, info.Size())
+	}
+	if !u.verify {
+		return nil
+	}
+
+	rc, err := u.provider.DownloadAsset(ctx, u.release, asset)
+	if errors.Is(err, ErrNotSupported) {
+		u.log.Debugf("Not verifying %s: %s can't download it", asset.Name, u.provider.Name())
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("downloading to verify: %w", err)
+	}
+	defer rc.Close()
+	remote := sha256.New()
+	if _, err := io.Copy(remote, rc); err != nil {
+		return fmt.Errorf("downloading to verify: %w", err)
+	}
+
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		return err
+	}
+	local := sha256.New()
+	if _, err := io.Copy(local, file); err != nil {
+		return err
+	}
+	if !bytes.Equal(remote.Sum(nil), local.Sum(nil)) {
+		return fmt.Errorf("SHA-256 is %x, expected %x", remote.Sum(nil), local.Sum(nil))
+	}
+	return nil
+}
+
+// uploadChecksums writes a checksums file listing the SHA-256
+// of each of assets into dir, in the format used by sha256sum,
+// and uploads it with uploader. If assets are being signed, its
+// signature is uploaded too.
+func (d *Deployer) uploadChecksums(ctx context.Context, uploader *releaseUploader, assets []AssetInfo, dir string) error {
+	return d.uploadFile(ctx, uploader, dir, checksumsFilename, checksumsFile(assets))
+}
+
+// checksumsFile returns the contents of a checksums file
+// listing the SHA-256 of each of assets, sorted by name.
+func checksumsFile(assets []AssetInfo) []byte {
+	sorted := make([]AssetInfo, len(assets))
+	copy(sorted, assets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var sb strings.Builder
+	for _, asset := range sorted {
+		fmt.Fprintf(&sb, "%s  %s\n", asset.SHA256, asset.Name)
+	}
+	return []byte(sb.String())
+}
+
+// uploadAssetChecksum uploads a file named for asset with
+// the extension .sha256, which has its SHA-256 in the same
+// format as the checksums file, with uploader. The file is
+// written in dir first, and removed after uploading.
+func uploadAssetChecksum(ctx context.Context, uploader *releaseUploader, asset AssetInfo, dir string) error {
+	name := asset.Name + assetChecksumExt
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, checksumsFile([]AssetInfo{asset}), 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return uploader.upload(ctx, name, file)
+}
+
+// uploadFile writes data to a file with the given name in
+// dir and uploads it with uploader, along with its signature
+// if assets are being signed.
+func (d *Deployer) uploadFile(ctx context.Context, uploader *releaseUploader, dir, name string, data []byte) error {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	var sigFile *os.File
+	if d.SignAssets {
+		sigFile, err = d.signFile(path)
+		if err != nil {
+			return fmt.Errorf("signing: %w", err)
+		}
+		defer sigFile.Close()
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = uploader.upload(ctx, name, file)
+	if err != nil {
+		return err
+	}
+
+	if sigFile != nil {
+		return uploader.upload(ctx, filepath.Base(sigFile.Name()), sigFile)
+	}
+	return nil
+}